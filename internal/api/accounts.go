@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/mail"
+	"github.com/tommarien/movie-land/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 12
+	// bcrypt ignores everything beyond 72 bytes
+	maxPasswordLength = 72
+)
+
+// dummyPasswordHash is compared against when the user does not exist,
+// so the response time does not reveal which email addresses are known.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("movie-land-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword validates the password like a password reset does and
+// hashes it, for users created outside the API.
+func HashPassword(password string) ([]byte, error) {
+	v := validator.New()
+	v.Required("password", password)
+	v.MinLength("password", password, minPasswordLength)
+	v.MaxLength("password", password, maxPasswordLength)
+
+	if !v.IsValid() {
+		return nil, errors.New(strings.Join(v.GetErrors(), ", "))
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// accounts handles the password login and the mailed token flows
+// to verify email addresses and reset passwords.
+type accounts struct {
+	cfg      *config.Config
+	users    UserStore
+	tokens   UserTokenStore
+	sessions *sessionManager
+	mail     *mailSender
+	lockout  *lockout
+}
+
+func newAccounts(cfg *config.Config, users UserStore, tokens UserTokenStore, sessions *sessionManager, mail *mailSender, lockout *lockout) *accounts {
+	return &accounts{
+		cfg:      cfg,
+		users:    users,
+		tokens:   tokens,
+		sessions: sessions,
+		mail:     mail,
+		lockout:  lockout,
+	}
+}
+
+type loginInput struct {
+	Email    string `json:"email" openapi:"required"`
+	Password string `json:"password" openapi:"required"`
+}
+
+type loginResponse struct {
+	Data        *UserDto `json:"data"`
+	MFARequired bool     `json:"mfa_required"`
+}
+
+type emailInput struct {
+	Email string `json:"email" openapi:"required"`
+}
+
+type tokenInput struct {
+	Token string `json:"token" openapi:"required"`
+}
+
+type passwordResetInput struct {
+	Token    string `json:"token" openapi:"required"`
+	Password string `json:"password" openapi:"required"`
+}
+
+func (a *accounts) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var input loginInput
+
+	err := readJSON(w, r, &input)
+	if err != nil {
+		handleBadRequest(w, err.Error(), nil)
+		return
+	}
+
+	v := validator.New()
+	v.Required("email", input.Email)
+	v.Required("password", input.Password)
+
+	if !v.IsValid() {
+		handleBadRequest(w, "", v.GetErrors())
+		return
+	}
+
+	email := strings.ToLower(input.Email)
+
+	attempt := newAttempt(r, email, 0)
+
+	if !a.lockout.allow(w, r, &attempt) {
+		return
+	}
+
+	user, err := a.users.GetUserByEmail(r.Context(), email)
+	if err != nil && !errors.Is(err, datastore.ErrUserNotFound) {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	if user == nil || user.PasswordHash == nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(input.Password))
+		a.handleLoginFailed(w, r, attempt)
+		return
+	}
+
+	attempt.userID = user.ID
+
+	if bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(input.Password)) != nil {
+		a.handleLoginFailed(w, r, attempt)
+		return
+	}
+
+	if err = a.lockout.succeed(r.Context(), attempt); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	if !user.EmailVerifiedAt.Valid {
+		handleForbidden(w, "email address is not verified")
+		return
+	}
+
+	if err = a.sessions.create(r.Context(), w, user); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	// with two-factor authentication enabled the session stays pending until
+	// the code is posted to /auth/2fa/verify
+	err = writeJSON(w, http.StatusOK, loginResponse{
+		Data:        mapUser(user),
+		MFARequired: a.sessions.mfaRequired(user),
+	}, nil)
+
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+}
+
+func (a *accounts) handleLoginFailed(w http.ResponseWriter, r *http.Request, attempt attempt) {
+	if err := a.lockout.fail(r.Context(), attempt, datastore.AuthEventLoginFailed); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	handleUnauthorized(w, "invalid email or password")
+}
+
+// tokenMail describes a kind of mailed token and the page its link points to.
+type tokenMail struct {
+	purpose string
+	ttl     time.Duration
+	path    string
+}
+
+func (a *accounts) handleEmailVerificationRequest(w http.ResponseWriter, r *http.Request) {
+	a.handleTokenRequest(w, r, tokenMail{
+		purpose: datastore.TokenPurposeEmailVerification,
+		ttl:     a.cfg.Auth.EmailVerificationTTL,
+		path:    "/verify-email",
+	})
+}
+
+func (a *accounts) handlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	a.handleTokenRequest(w, r, tokenMail{
+		purpose: datastore.TokenPurposePasswordReset,
+		ttl:     a.cfg.Auth.PasswordResetTTL,
+		path:    "/reset-password",
+	})
+}
+
+// handleTokenRequest mails a token to the user with the requested email address.
+// It always answers 202 Accepted, so it does not reveal which addresses are known.
+func (a *accounts) handleTokenRequest(w http.ResponseWriter, r *http.Request, tm tokenMail) {
+	var input emailInput
+
+	err := readJSON(w, r, &input)
+	if err != nil {
+		handleBadRequest(w, err.Error(), nil)
+		return
+	}
+
+	v := validator.New()
+	v.Required("email", input.Email)
+	v.Email("email", input.Email)
+
+	if !v.IsValid() {
+		handleBadRequest(w, "", v.GetErrors())
+		return
+	}
+
+	user, err := a.users.GetUserByEmail(r.Context(), strings.ToLower(input.Email))
+	switch {
+	case errors.Is(err, datastore.ErrUserNotFound):
+	case err != nil:
+		handleInternalServerError(w, r, err)
+		return
+	case tm.purpose == datastore.TokenPurposeEmailVerification && user.EmailVerifiedAt.Valid:
+		// nothing left to verify
+	default:
+		if err = a.issueToken(r.Context(), user, tm); err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+	}
+
+	statusCode := http.StatusAccepted
+
+	err = writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": "if the email address is known, a message is on its way",
+	}, nil)
+
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+}
+
+// issueToken stores a new token for the user and mails a link holding it,
+// unless the user already received too many of them recently.
+func (a *accounts) issueToken(ctx context.Context, user *datastore.User, tm tokenMail) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	err = a.tokens.IssueUserToken(ctx, &datastore.UserToken{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Purpose:   tm.purpose,
+		ExpiresAt: time.Now().Add(tm.ttl),
+	}, a.cfg.Mail.RateLimit, time.Now().Add(-a.cfg.Mail.RateLimitWindow))
+	if errors.Is(err, datastore.ErrUserTokenLimitReached) {
+		slog.WarnContext(ctx, "mail: rate limit reached", "user_id", user.ID, "purpose", tm.purpose)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	msg, err := mail.Render(user.Email, tm.purpose, map[string]any{
+		"Link":      strings.TrimSuffix(a.cfg.PublicURL, "/") + tm.path + "?token=" + url.QueryEscape(token),
+		"ExpiresIn": tm.ttl.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	a.mail.send(msg)
+
+	return nil
+}
+
+func (a *accounts) handleEmailVerificationConfirm(w http.ResponseWriter, r *http.Request) {
+	var input tokenInput
+
+	err := readJSON(w, r, &input)
+	if err != nil {
+		handleBadRequest(w, err.Error(), nil)
+		return
+	}
+
+	v := validator.New()
+	v.Required("token", input.Token)
+
+	if !v.IsValid() {
+		handleBadRequest(w, "", v.GetErrors())
+		return
+	}
+
+	err = a.tokens.ConfirmEmailVerification(r.Context(), hashToken(input.Token))
+	if err != nil {
+		if errors.Is(err, datastore.ErrUserTokenNotFound) {
+			handleBadRequest(w, "token is invalid or expired", nil)
+			return
+		}
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *accounts) handlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	var input passwordResetInput
+
+	err := readJSON(w, r, &input)
+	if err != nil {
+		handleBadRequest(w, err.Error(), nil)
+		return
+	}
+
+	v := validator.New()
+	v.Required("token", input.Token)
+	v.Required("password", input.Password)
+	v.MinLength("password", input.Password, minPasswordLength)
+	v.MaxLength("password", input.Password, maxPasswordLength)
+
+	if !v.IsValid() {
+		handleBadRequest(w, "", v.GetErrors())
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	_, err = a.tokens.ResetPassword(r.Context(), hashToken(input.Token), passwordHash)
+	if err != nil {
+		if errors.Is(err, datastore.ErrUserTokenNotFound) {
+			handleBadRequest(w, "token is invalid or expired", nil)
+			return
+		}
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,507 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type mockUserTokenStore struct {
+	issueUserTokenFunc           func(context.Context, *datastore.UserToken, int, time.Time) error
+	confirmEmailVerificationFunc func(context.Context, []byte) error
+	resetPasswordFunc            func(context.Context, []byte, []byte) (int, error)
+}
+
+func (m *mockUserTokenStore) IssueUserToken(ctx context.Context, token *datastore.UserToken, limit int, since time.Time) error {
+	if m.issueUserTokenFunc != nil {
+		return m.issueUserTokenFunc(ctx, token, limit, since)
+	}
+	return errors.New("No issueUserToken call expected")
+}
+
+func (m *mockUserTokenStore) ConfirmEmailVerification(ctx context.Context, tokenHash []byte) error {
+	if m.confirmEmailVerificationFunc != nil {
+		return m.confirmEmailVerificationFunc(ctx, tokenHash)
+	}
+	return datastore.ErrUserTokenNotFound
+}
+
+func (m *mockUserTokenStore) ResetPassword(ctx context.Context, tokenHash []byte, passwordHash []byte) (int, error) {
+	if m.resetPasswordFunc != nil {
+		return m.resetPasswordFunc(ctx, tokenHash, passwordHash)
+	}
+	return 0, datastore.ErrUserTokenNotFound
+}
+
+// recordingMailer keeps the messages it was asked to send.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+type accountsTestEnv struct {
+	mux       *http.ServeMux
+	mailer    *recordingMailer
+	mail      *mailSender
+	sessions  *memorySessionStore
+	throttles *memoryThrottleStore
+}
+
+func newAccountsTestEnv(t *testing.T, users UserStore, tokens UserTokenStore) *accountsTestEnv {
+	t.Helper()
+
+	cfg := &config.Config{
+		PublicURL: "https://movie-land.test/",
+		Auth: config.AuthConfig{
+			EmailVerificationTTL: 24 * time.Hour,
+			PasswordResetTTL:     time.Hour,
+		},
+		Mail: config.MailConfig{
+			RateLimit:       3,
+			RateLimitWindow: time.Hour,
+		},
+	}
+
+	env := &accountsTestEnv{
+		mux:       http.NewServeMux(),
+		mailer:    &recordingMailer{},
+		sessions:  newMemorySessionStore(),
+		throttles: newMemoryThrottleStore(),
+	}
+	env.mail = newMailSender(env.mailer)
+
+	sessions := newSessionManager(env.sessions, config.SessionConfig{TTL: time.Hour}, true)
+	lockout, _ := newTestLockout(env.throttles)
+	registerAuthRoutes(env.mux, sessions, newAccounts(cfg, users, tokens, sessions, env.mail, lockout), nil, nil)
+
+	return env
+}
+
+func (env *accountsTestEnv) post(t *testing.T, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal request body: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", target, bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+
+	env.mux.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// sentMessages waits for all pending mails and returns them.
+func (env *accountsTestEnv) sentMessages(t *testing.T) []mail.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := env.mail.wait(ctx); err != nil {
+		t.Fatalf("pending mails were not sent: %v", err)
+	}
+
+	return env.mailer.messages
+}
+
+func TestPostLogin(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifiedUser := &datastore.User{
+		ID:              1,
+		Email:           "jane@example.com",
+		PasswordHash:    passwordHash,
+		EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	unverifiedUser := &datastore.User{
+		ID:           2,
+		Email:        "john@example.com",
+		PasswordHash: passwordHash,
+	}
+
+	totpUser := &datastore.User{
+		ID:              3,
+		Email:           "joe@example.com",
+		PasswordHash:    passwordHash,
+		EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		TOTPEnabledAt:   sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	users := &mockUserStore{
+		getUserByEmailFunc: func(ctx context.Context, email string) (*datastore.User, error) {
+			for _, u := range []*datastore.User{verifiedUser, unverifiedUser, totpUser} {
+				if u.Email == email {
+					return u, nil
+				}
+			}
+			return nil, datastore.ErrUserNotFound
+		},
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]any
+		expectedStatus int
+		expectedData   any
+	}{
+		{
+			name:           "returns status 400 when the password is missing",
+			requestBody:    map[string]any{"email": "jane@example.com"},
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]any{
+				"status":  float64(400),
+				"message": "bad request",
+				"errors":  []any{"password is required"},
+			},
+		},
+		{
+			name:           "returns status 401 for an unknown email address",
+			requestBody:    map[string]any{"email": "nobody@example.com", "password": "correct horse battery"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedData:   map[string]any{"status": float64(401), "message": "invalid email or password"},
+		},
+		{
+			name:           "returns status 401 for a wrong password",
+			requestBody:    map[string]any{"email": "jane@example.com", "password": "wrong"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedData:   map[string]any{"status": float64(401), "message": "invalid email or password"},
+		},
+		{
+			name:           "returns status 403 when the email address is not verified",
+			requestBody:    map[string]any{"email": "john@example.com", "password": "correct horse battery"},
+			expectedStatus: http.StatusForbidden,
+			expectedData:   map[string]any{"status": float64(403), "message": "email address is not verified"},
+		},
+		{
+			name:           "returns status 200 with the user",
+			requestBody:    map[string]any{"email": "Jane@Example.com", "password": "correct horse battery"},
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]any{
+				"data": map[string]any{
+					"id":                 float64(1),
+					"email":              "jane@example.com",
+					"roles":              []any{},
+					"two_factor_enabled": false,
+				},
+				"mfa_required": false,
+			},
+		},
+		{
+			name:           "returns status 200 requiring the second factor when two-factor authentication is enabled",
+			requestBody:    map[string]any{"email": "joe@example.com", "password": "correct horse battery"},
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]any{
+				"data": map[string]any{
+					"id":                 float64(3),
+					"email":              "joe@example.com",
+					"roles":              []any{},
+					"two_factor_enabled": true,
+				},
+				"mfa_required": true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newAccountsTestEnv(t, users, &mockUserTokenStore{})
+
+			rec := env.post(t, "/auth/login", tt.requestBody)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status code %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			result := parseGenreResponse(t, rec.Body.Bytes())
+
+			if diff := cmp.Diff(tt.expectedData, result); diff != "" {
+				t.Errorf("data mismatch (-want +got):\n%s", diff)
+			}
+
+			if wantSession := rec.Code == http.StatusOK; wantSession != (len(env.sessions.sessions) == 1) {
+				t.Errorf("expected a session to be created: %v, got %d sessions", wantSession, len(env.sessions.sessions))
+			}
+		})
+	}
+}
+
+func TestPostPasswordReset(t *testing.T) {
+	user := &datastore.User{ID: 1, Email: "jane@example.com"}
+
+	users := &mockUserStore{
+		getUserByEmailFunc: func(ctx context.Context, email string) (*datastore.User, error) {
+			if email == user.Email {
+				return user, nil
+			}
+			return nil, datastore.ErrUserNotFound
+		},
+	}
+
+	t.Run("mails a reset link to a known address", func(t *testing.T) {
+		var stored *datastore.UserToken
+		env := newAccountsTestEnv(t, users, &mockUserTokenStore{
+			issueUserTokenFunc: func(ctx context.Context, token *datastore.UserToken, limit int, since time.Time) error {
+				stored = token
+				return nil
+			},
+		})
+
+		rec := env.post(t, "/auth/password-reset", map[string]any{"email": "jane@example.com"})
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rec.Code)
+		}
+
+		messages := env.sentMessages(t)
+		if len(messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(messages))
+		}
+
+		if messages[0].To != "jane@example.com" {
+			t.Errorf("expected message to jane@example.com, got %q", messages[0].To)
+		}
+
+		link := extractLink(t, messages[0].Body, "https://movie-land.test/reset-password?token=")
+		token := link.Query().Get("token")
+
+		if stored == nil || !bytes.Equal(stored.TokenHash, hashToken(token)) {
+			t.Fatal("expected the hash of the mailed token to be stored")
+		}
+
+		if stored.Purpose != datastore.TokenPurposePasswordReset {
+			t.Errorf("expected purpose %q, got %q", datastore.TokenPurposePasswordReset, stored.Purpose)
+		}
+
+		if time.Until(stored.ExpiresAt).Round(time.Minute) != time.Hour {
+			t.Errorf("expected token to expire in 1h, got %v", time.Until(stored.ExpiresAt))
+		}
+	})
+
+	t.Run("does not reveal unknown addresses", func(t *testing.T) {
+		env := newAccountsTestEnv(t, users, &mockUserTokenStore{})
+
+		rec := env.post(t, "/auth/password-reset", map[string]any{"email": "nobody@example.com"})
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rec.Code)
+		}
+
+		if messages := env.sentMessages(t); len(messages) != 0 {
+			t.Fatalf("expected no messages, got %d", len(messages))
+		}
+	})
+
+	t.Run("stops mailing once the rate limit is reached", func(t *testing.T) {
+		env := newAccountsTestEnv(t, users, &mockUserTokenStore{
+			issueUserTokenFunc: func(ctx context.Context, token *datastore.UserToken, limit int, since time.Time) error {
+				return datastore.ErrUserTokenLimitReached
+			},
+		})
+
+		rec := env.post(t, "/auth/password-reset", map[string]any{"email": "jane@example.com"})
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rec.Code)
+		}
+
+		if messages := env.sentMessages(t); len(messages) != 0 {
+			t.Fatalf("expected no messages, got %d", len(messages))
+		}
+	})
+
+	t.Run("returns status 400 for an invalid email address", func(t *testing.T) {
+		env := newAccountsTestEnv(t, users, &mockUserTokenStore{})
+
+		rec := env.post(t, "/auth/password-reset", map[string]any{"email": "not an email"})
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+}
+
+func TestPostEmailVerification(t *testing.T) {
+	t.Run("does not mail users that are verified already", func(t *testing.T) {
+		env := newAccountsTestEnv(t, &mockUserStore{
+			getUserByEmailFunc: func(ctx context.Context, email string) (*datastore.User, error) {
+				return &datastore.User{
+					ID:              1,
+					Email:           email,
+					EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+				}, nil
+			},
+		}, &mockUserTokenStore{})
+
+		rec := env.post(t, "/auth/email-verification", map[string]any{"email": "jane@example.com"})
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rec.Code)
+		}
+
+		if messages := env.sentMessages(t); len(messages) != 0 {
+			t.Fatalf("expected no messages, got %d", len(messages))
+		}
+	})
+
+	t.Run("mails a verification link to unverified users", func(t *testing.T) {
+		env := newAccountsTestEnv(t, &mockUserStore{
+			getUserByEmailFunc: func(ctx context.Context, email string) (*datastore.User, error) {
+				return &datastore.User{ID: 1, Email: email}, nil
+			},
+		}, &mockUserTokenStore{
+			issueUserTokenFunc: func(ctx context.Context, token *datastore.UserToken, limit int, since time.Time) error {
+				return nil
+			},
+		})
+
+		env.post(t, "/auth/email-verification", map[string]any{"email": "jane@example.com"})
+
+		messages := env.sentMessages(t)
+		if len(messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(messages))
+		}
+
+		extractLink(t, messages[0].Body, "https://movie-land.test/verify-email?token=")
+	})
+}
+
+func TestPostConfirmTokens(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		requestBody    map[string]any
+		tokens         *mockUserTokenStore
+		expectedStatus int
+		expectedData   any
+	}{
+		{
+			name:           "returns status 400 for an unknown verification token",
+			target:         "/auth/email-verification/confirm",
+			requestBody:    map[string]any{"token": "unknown"},
+			tokens:         &mockUserTokenStore{},
+			expectedStatus: http.StatusBadRequest,
+			expectedData:   map[string]any{"status": float64(400), "message": "token is invalid or expired"},
+		},
+		{
+			name:        "returns status 204 for a valid verification token",
+			target:      "/auth/email-verification/confirm",
+			requestBody: map[string]any{"token": "valid"},
+			tokens: &mockUserTokenStore{
+				confirmEmailVerificationFunc: func(ctx context.Context, tokenHash []byte) error {
+					if !bytes.Equal(tokenHash, hashToken("valid")) {
+						return datastore.ErrUserTokenNotFound
+					}
+					return nil
+				},
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "returns status 400 when the new password is too short",
+			target:         "/auth/password-reset/confirm",
+			requestBody:    map[string]any{"token": "valid", "password": "short"},
+			tokens:         &mockUserTokenStore{},
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]any{
+				"status":  float64(400),
+				"message": "bad request",
+				"errors":  []any{"password must be at least 12 characters"},
+			},
+		},
+		{
+			name:           "returns status 400 for an unknown reset token",
+			target:         "/auth/password-reset/confirm",
+			requestBody:    map[string]any{"token": "unknown", "password": "correct horse battery"},
+			tokens:         &mockUserTokenStore{},
+			expectedStatus: http.StatusBadRequest,
+			expectedData:   map[string]any{"status": float64(400), "message": "token is invalid or expired"},
+		},
+		{
+			name:        "returns status 204 and stores the hashed password for a valid reset token",
+			target:      "/auth/password-reset/confirm",
+			requestBody: map[string]any{"token": "valid", "password": "correct horse battery"},
+			tokens: &mockUserTokenStore{
+				resetPasswordFunc: func(ctx context.Context, tokenHash []byte, passwordHash []byte) (int, error) {
+					if !bytes.Equal(tokenHash, hashToken("valid")) {
+						return 0, datastore.ErrUserTokenNotFound
+					}
+					if bcrypt.CompareHashAndPassword(passwordHash, []byte("correct horse battery")) != nil {
+						return 0, errors.New("password was not hashed")
+					}
+					return 1, nil
+				},
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newAccountsTestEnv(t, &mockUserStore{}, tt.tokens)
+
+			rec := env.post(t, tt.target, tt.requestBody)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status code %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body)
+			}
+
+			if tt.expectedData == nil {
+				return
+			}
+
+			result := parseGenreResponse(t, rec.Body.Bytes())
+
+			if diff := cmp.Diff(tt.expectedData, result); diff != "" {
+				t.Errorf("data mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func extractLink(t *testing.T, body, prefix string) *url.URL {
+	t.Helper()
+
+	start := strings.Index(body, prefix)
+	if start == -1 {
+		t.Fatalf("expected body to contain a link starting with %q, got:\n%s", prefix, body)
+	}
+
+	link, _, _ := strings.Cut(body[start:], "\n")
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("failed to parse link %q: %v", link, err)
+	}
+
+	return u
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/metrics"
+	"github.com/tommarien/movie-land/internal/validator"
+)
+
+// newAdminHandler serves the operators on the admin listener: pprof, the
+// effective config with its secrets redacted, the statistics of the database
+// pool and the log level, which can be changed without a restart.
+func newAdminHandler(rt *config.Runtime, pool metrics.Stater, level *slog.LevelVar) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("GET /config", handleAdminConfig(rt))
+	mux.HandleFunc("GET /pool", handleAdminPool(pool))
+	mux.HandleFunc("GET /log-level", handleLogLevelGet(level))
+	mux.HandleFunc("PUT /log-level", handleLogLevelPut(level))
+
+	return chain(mux, recoverPanics, limitBodies(mux, rt.Current().Server))
+}
+
+func handleAdminConfig(rt *config.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := writeJSON(w, http.StatusOK, map[string]any{
+			"data": rt.Current().Dump(),
+		}, nil)
+		if err != nil {
+			handleInternalServerError(w, r, err)
+		}
+	}
+}
+
+type PoolStatsDto struct {
+	AcquiredConns           int32  `json:"acquired_conns"`
+	IdleConns               int32  `json:"idle_conns"`
+	ConstructingConns       int32  `json:"constructing_conns"`
+	TotalConns              int32  `json:"total_conns"`
+	MaxConns                int32  `json:"max_conns"`
+	AcquireCount            int64  `json:"acquire_count"`
+	AcquireDuration         string `json:"acquire_duration"`
+	EmptyAcquireCount       int64  `json:"empty_acquire_count"`
+	EmptyAcquireWaitTime    string `json:"empty_acquire_wait_time"`
+	CanceledAcquireCount    int64  `json:"canceled_acquire_count"`
+	NewConnsCount           int64  `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64  `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64  `json:"max_idle_destroy_count"`
+}
+
+func handleAdminPool(pool metrics.Stater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stat := pool.Stat()
+
+		err := writeJSON(w, http.StatusOK, map[string]any{
+			"data": &PoolStatsDto{
+				AcquiredConns:           stat.AcquiredConns(),
+				IdleConns:               stat.IdleConns(),
+				ConstructingConns:       stat.ConstructingConns(),
+				TotalConns:              stat.TotalConns(),
+				MaxConns:                stat.MaxConns(),
+				AcquireCount:            stat.AcquireCount(),
+				AcquireDuration:         stat.AcquireDuration().String(),
+				EmptyAcquireCount:       stat.EmptyAcquireCount(),
+				EmptyAcquireWaitTime:    stat.EmptyAcquireWaitTime().String(),
+				CanceledAcquireCount:    stat.CanceledAcquireCount(),
+				NewConnsCount:           stat.NewConnsCount(),
+				MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+				MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+			},
+		}, nil)
+		if err != nil {
+			handleInternalServerError(w, r, err)
+		}
+	}
+}
+
+type LogLevelDto struct {
+	Level string `json:"level"`
+}
+
+type logLevelInput struct {
+	Level string `json:"level"`
+}
+
+func handleLogLevelGet(level *slog.LevelVar) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := writeJSON(w, http.StatusOK, map[string]any{
+			"data": &LogLevelDto{Level: level.Level().String()},
+		}, nil)
+		if err != nil {
+			handleInternalServerError(w, r, err)
+		}
+	}
+}
+
+// handleLogLevelPut changes the level of the logger until the next restart,
+// it accepts one of debug, info, warn or error.
+func handleLogLevelPut(level *slog.LevelVar) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input logLevelInput
+		if err := readJSON(w, r, &input); err != nil {
+			handleBadRequest(w, err.Error(), nil)
+			return
+		}
+
+		v := validator.New()
+		v.Required("level", input.Level)
+		v.In("level", strings.ToLower(input.Level), "debug", "info", "warn", "error")
+
+		if !v.IsValid() {
+			handleBadRequest(w, "", v.GetErrors())
+			return
+		}
+
+		var next slog.Level
+		if err := next.UnmarshalText([]byte(input.Level)); err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		previous := level.Level()
+		level.Set(next)
+		slog.WarnContext(r.Context(), "changed log level", "from", previous, "to", next)
+
+		err := writeJSON(w, http.StatusOK, map[string]any{
+			"data": &LogLevelDto{Level: next.String()},
+		}, nil)
+		if err != nil {
+			handleInternalServerError(w, r, err)
+		}
+	}
+}
@@ -5,26 +5,44 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/tommarien/movie-land/internal/config"
 	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/mail"
+	"github.com/tommarien/movie-land/internal/metrics"
+	"github.com/tommarien/movie-land/internal/ratelimit"
+	"github.com/tommarien/movie-land/internal/tlsconfig"
+	"github.com/tommarien/movie-land/migrations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-const gracefulShutDownTimeout = 30 * time.Second
-
 type Api struct {
-	cfg   *config.Config
-	store *datastore.Store
+	rt       *config.Runtime
+	cfg      *config.Config
+	store    *datastore.Store
+	mail     *mailSender
+	metrics  *metrics.Metrics
+	logLevel *slog.LevelVar
 }
 
-func New(cfg *config.Config, store *datastore.Store) *Api {
+// New returns the API, logLevel is the level of the default logger which the
+// admin listener and reloads of the runtime config can change. The settings
+// a reload does not apply are read once, from the config current at the start.
+func New(rt *config.Runtime, store *datastore.Store, mailer mail.Mailer, metrics *metrics.Metrics, logLevel *slog.LevelVar) *Api {
 	return &Api{
-		cfg:   cfg,
-		store: store,
+		rt:       rt,
+		cfg:      rt.Current(),
+		store:    store,
+		mail:     newMailSender(mailer),
+		metrics:  metrics,
+		logLevel: logLevel,
 	}
 }
 
@@ -32,49 +50,286 @@ func (api *Api) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 	registerRoutes(mux, api.store)
 
-	svr := &http.Server{
+	sessions := newSessionManager(api.store, api.cfg.Session, api.cfg.Auth.TOTPEnabled())
+
+	var oidc *oidcAuth
+	if api.cfg.OIDC.Enabled() {
+		var err error
+		oidc, err = newOIDCAuth(ctx, api.cfg.OIDC, api.store, sessions)
+		if err != nil {
+			return fmt.Errorf("api: could not configure oidc: %w", err)
+		}
+	}
+
+	lockout := newLockout(api.cfg.Lockout, api.store)
+	accounts := newAccounts(api.cfg, api.store, api.store, sessions, api.mail, lockout)
+
+	var twoFactor *twoFactor
+	if api.cfg.Auth.TOTPEnabled() {
+		var err error
+		twoFactor, err = newTwoFactor(api.cfg.Auth, api.store, sessions, lockout)
+		if err != nil {
+			return fmt.Errorf("api: could not configure two-factor authentication: %w", err)
+		}
+	}
+
+	registerAuthRoutes(mux, sessions, accounts, twoFactor, oidc)
+	registerUserRoutes(mux, sessions, api.store, lockout)
+	registerAuditRoutes(mux, sessions, api.store)
+	registerCatalogRoutes(mux, sessions, api.store)
+
+	versions, err := migrations.Versions()
+	if err != nil {
+		return fmt.Errorf("api: could not determine schema version: %w", err)
+	}
+
+	health := newHealth(api.cfg.Health, api.store, versions)
+	registerHealthRoutes(mux, health)
+
+	ipResolver, err := newClientIPResolver(api.cfg.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("api: could not configure trusted proxies: %w", err)
+	}
+
+	var reloader *tlsconfig.Reloader
+	if api.cfg.TLS.Enabled() {
+		reloader, err = tlsconfig.New(api.cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("api: could not configure tls: %w", err)
+		}
+	}
+
+	// the REST and gRPC API take from the same buckets
+	rateLimiter := newRateLimiter(api.rt, api.newLimiter(), mux)
+
+	middlewares := []middleware{
+		requestIDs,
+		traceRequests(mux),
+		ipResolver.middleware,
+		clientIdentities(api.cfg.TLS.ClientIdentities).middleware,
+		accessLog(mux),
+		api.metrics.Middleware(mux),
+		recoverPanics,
+		cors(api.rt),
+		features(mux, api.rt),
+	}
+	if api.cfg.Server.MaxConcurrentRequests > 0 {
+		middlewares = append(middlewares, limitConcurrency(api.cfg.Server.MaxConcurrentRequests))
+	}
+	middlewares = append(middlewares,
+		timeouts(mux, api.cfg.Server),
+		limitBodies(mux, api.cfg.Server),
+	)
+	if len(api.cfg.Database.ReplicaURLs) > 0 {
+		// a replica serving reads lags MaxLag at most, as of its last check
+		window := api.cfg.Database.ReplicaMaxLag + api.cfg.Database.ReplicaCheckInterval
+		middlewares = append(middlewares, readYourWrites(window, api.cfg.Session.CookieSecure))
+	}
+	middlewares = append(middlewares,
+		sessions.loadSession,
+		rateLimiter.middleware,
+	)
+	if api.cfg.Idempotency.Enabled {
+		middlewares = append(middlewares, newIdempotency(api.cfg.Idempotency, api.store, mux, api.cfg.Server.RouteBodyLimits).middleware)
+	}
+	middlewares = append(middlewares, auditInfo)
+
+	svr := configureServer(&http.Server{
 		Addr:    fmt.Sprintf(":%d", api.cfg.Port),
-		Handler: mux,
+		Handler: chain(mux, middlewares...),
+	}, api.cfg.Server)
+	if reloader != nil {
+		svr.TLSConfig = reloader.Config()
 	}
 
-	errChan := make(chan error)
-	shutdownCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	servers := []*http.Server{svr}
+
+	if api.cfg.Metrics.Enabled {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", api.metrics.Handler())
+
+		servers = append(servers, configureServer(&http.Server{
+			Addr:    fmt.Sprintf(":%d", api.cfg.Metrics.Port),
+			Handler: metricsMux,
+		}, api.cfg.Server))
+	}
+
+	if api.cfg.Admin.Enabled {
+		admin := configureServer(&http.Server{
+			Addr:    api.cfg.Admin.Addr,
+			Handler: newAdminHandler(api.rt, api.store, api.logLevel),
+		}, api.cfg.Server)
+		// profiles and traces take as long as they are asked to
+		admin.WriteTimeout = 0
+
+		servers = append(servers, admin)
+	}
+
+	var grpcSvr *grpcServer
+	if api.cfg.GRPC.Enabled {
+		var opts []grpc.ServerOption
+		if reloader != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.Config())))
+		}
+		grpcSvr = newGRPCServer(api.store, []grpcInterceptor{
+			grpcRequestIDs,
+			clientIdentities(api.cfg.TLS.ClientIdentities).grpcInterceptor,
+			rateLimiter.grpcInterceptor,
+			grpcAuditInfo,
+		}, opts...)
+	}
 
-	go func() {
-		// close the error channel when this goroutine ends
-		defer close(errChan)
+	// buffered so servers failing after the first one do not block
+	errChan := make(chan error, len(servers)+1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 
-		slog.Info("started listening", "port", api.cfg.Port)
-		if err := svr.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			errChan <- err
+	api.rt.OnReload(func(previous, current *config.Config) {
+		if current.LogLevel != previous.LogLevel {
+			api.logLevel.Set(current.LogLevel)
 		}
-	}()
+	})
+
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+
+	go api.rt.Watch(watchCtx)
+	go api.store.MonitorReplicas(watchCtx)
+	if reloader != nil {
+		go reloader.Watch(watchCtx)
+	}
+	go reloadOnHangup(watchCtx, api.rt, reloader)
+
+	for _, s := range servers {
+		go func() {
+			slog.Info("started listening", "addr", s.Addr, "tls", s.TLSConfig != nil)
+
+			var err error
+			if s.TLSConfig != nil {
+				err = s.ListenAndServeTLS("", "")
+			} else {
+				err = s.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errChan <- err
+			}
+		}()
+	}
+
+	if grpcSvr != nil {
+		go func() {
+			addr := fmt.Sprintf(":%d", api.cfg.GRPC.Port)
+
+			lis, err := net.Listen("tcp", addr)
+			if err != nil {
+				errChan <- err
+				return
+			}
+
+			slog.Info("started listening", "addr", addr, "protocol", "grpc", "tls", reloader != nil)
+			if err := grpcSvr.serve(lis); err != nil {
+				errChan <- err
+			}
+		}()
+	}
 
 	select {
 	case err := <-errChan:
 		return fmt.Errorf("api: could not start: %w", err)
 
-	case <-shutdownCtx.Done():
-		slog.Info("received a signal to shutdown")
-		stop() // stop receiving signals, next ones will be handled by default behavior
+	case <-ctx.Done():
+		slog.Info("context canceled, shutting down")
+
+	case sig := <-signals:
+		slog.Info("received a signal to shutdown", "signal", sig)
+		signal.Stop(signals) // stop receiving signals, next ones will be handled by default behavior
+
+		// orchestrators send SIGTERM, keep serving with a failing readiness
+		// until their load balancers stopped routing here
+		if sig == syscall.SIGTERM && api.cfg.Health.DrainDelay > 0 {
+			health.drain()
+			if grpcSvr != nil {
+				grpcSvr.drain()
+			}
+			slog.Info("draining before shutdown", "delay", api.cfg.Health.DrainDelay)
+
+			select {
+			case <-time.After(api.cfg.Health.DrainDelay):
+			case <-ctx.Done():
+			}
+		}
 	}
 
-	slog.Info("gracefully shutting down", "timeout", gracefulShutDownTimeout)
+	slog.Info("gracefully shutting down", "timeout", api.cfg.Server.ShutdownTimeout)
 
 	// Important to use a new context here,
-	// as the shutdownCtx is already done when a signal is received
-	ctx, cancel := context.WithTimeout(context.Background(), gracefulShutDownTimeout)
+	// as ctx may already be done
+	ctx, cancel := context.WithTimeout(context.Background(), api.cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	err := svr.Shutdown(ctx)
-	switch {
-	case errors.Is(err, context.DeadlineExceeded):
-		slog.Warn("graceful shutdown timed out, forcing exit")
-		return svr.Close()
-	case err != nil:
-		return fmt.Errorf("api: shutdown error: %w", err)
+	if grpcSvr != nil {
+		if err := grpcSvr.shutdown(ctx); err != nil {
+			slog.Warn("graceful shutdown of grpc timed out, canceled the running calls")
+		}
+	}
+
+	// every server gets shut down, whatever happened to the ones before
+	var errs []error
+	for _, s := range servers {
+		err = s.Shutdown(ctx)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			slog.Warn("graceful shutdown timed out, forcing exit", "addr", s.Addr)
+			if err = s.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("api: close error: %w", err))
+			}
+		case err != nil:
+			errs = append(errs, fmt.Errorf("api: shutdown error: %w", err))
+		}
+	}
+
+	// handlers may have queued mails right before the server closed
+	if err = api.mail.wait(ctx); err != nil {
+		slog.Warn("timed out waiting for pending mails", "err", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// reloadOnHangup reloads the runtime config, and the certificates when
+// serving TLS, on SIGHUP until the context is done.
+func reloadOnHangup(ctx context.Context, rt *config.Runtime, reloader *tlsconfig.Reloader) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			slog.Info("received a signal to reload the config")
+			if err := rt.Reload(); err != nil {
+				slog.Error("could not reload the config, keeping the one in use", "err", err)
+			}
+
+			if reloader == nil {
+				continue
+			}
+			if err := reloader.Reload(); err != nil {
+				slog.Error("could not reload tls files, serving the previous ones", "err", err)
+			}
+		}
+	}
+}
+
+func (api *Api) newLimiter() ratelimit.Limiter {
+	cfg := api.cfg.RateLimit
+
+	if cfg.Backend == config.RateLimitBackendPostgres {
+		return ratelimit.NewPostgresLimiter(api.store, max(cfg.ReadPeriod, cfg.WritePeriod))
 	}
 
-	return nil
+	return ratelimit.NewMemoryLimiter()
 }
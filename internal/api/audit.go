@@ -0,0 +1,167 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+type AuditEventDto struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	RequestID  string          `json:"request_id,omitempty"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// auditInfo attaches who makes the request to its context, so the store can
+// record it with the mutations. It expects to run after
+// requestIDs and sessionManager.loadSession.
+func auditInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := datastore.AuditInfo{
+			RequestID: requestIDFromContext(r.Context()),
+			IPAddress: clientIP(r),
+		}
+
+		if session := sessionFromContext(r.Context()); session != nil && !session.MFAPending {
+			info.ActorID = sql.NullInt64{Int64: int64(session.UserID), Valid: true}
+		}
+
+		next.ServeHTTP(w, r.WithContext(datastore.WithAuditInfo(r.Context(), info)))
+	})
+}
+
+func handleAuditIndex(store AuditStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		filter := datastore.AuditEventFilter{
+			EntityType: query.Get("entity_type"),
+			EntityID:   query.Get("entity_id"),
+			Limit:      defaultAuditPageSize,
+		}
+
+		var errs []string
+
+		if v := query.Get("actor_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id <= 0 {
+				errs = append(errs, "actor_id must be a positive integer")
+			}
+			filter.ActorID = id
+		}
+
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &filter.Since}, {"until", &filter.Until}} {
+			if v := query.Get(p.name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					errs = append(errs, p.name+" must be an RFC 3339 timestamp")
+				}
+				*p.dst = t
+			}
+		}
+
+		if v := query.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxAuditPageSize {
+				errs = append(errs, "limit must be between 1 and "+strconv.Itoa(maxAuditPageSize))
+			}
+			filter.Limit = limit
+		}
+
+		if v := query.Get("cursor"); v != "" {
+			id, err := decodeAuditCursor(v)
+			if err != nil {
+				errs = append(errs, "cursor is invalid")
+			}
+			filter.BeforeID = id
+		}
+
+		if len(errs) > 0 {
+			handleBadRequest(w, "", errs)
+			return
+		}
+
+		// one extra event tells whether there is a next page
+		pageSize := filter.Limit
+		filter.Limit++
+
+		events, err := store.ListAuditEvents(r.Context(), filter)
+		if err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		response := map[string]any{}
+
+		if len(events) > pageSize {
+			events = events[:pageSize]
+			response["next_cursor"] = encodeAuditCursor(events[pageSize-1].ID)
+		}
+
+		data := make([]*AuditEventDto, 0, len(events))
+		for _, e := range events {
+			data = append(data, mapAuditEvent(e))
+		}
+		response["data"] = data
+
+		err = writeJSON(w, http.StatusOK, response, nil)
+
+		if err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+	}
+}
+
+func encodeAuditCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeAuditCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(b), 10, 64)
+}
+
+func mapAuditEvent(event *datastore.AuditEvent) *AuditEventDto {
+	dto := &AuditEventDto{
+		ID:         event.ID,
+		Action:     event.Action,
+		EntityType: event.EntityType,
+		EntityID:   event.EntityID,
+		Before:     event.Before,
+		After:      event.After,
+		RequestID:  event.RequestID.String,
+		IPAddress:  event.IPAddress.String,
+		CreatedAt:  event.CreatedAt,
+	}
+
+	if event.ActorID.Valid {
+		dto.ActorID = &event.ActorID.Int64
+	}
+
+	return dto
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+type mockAuditStore struct {
+	filters []datastore.AuditEventFilter
+	events  []*datastore.AuditEvent
+}
+
+// ListAuditEvents pages through the events like the store does, newest first.
+func (m *mockAuditStore) ListAuditEvents(ctx context.Context, filter datastore.AuditEventFilter) ([]*datastore.AuditEvent, error) {
+	m.filters = append(m.filters, filter)
+
+	var events []*datastore.AuditEvent
+	for _, e := range m.events {
+		if filter.BeforeID != 0 && e.ID >= filter.BeforeID {
+			continue
+		}
+		if len(events) == filter.Limit {
+			break
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func TestGetAudit(t *testing.T) {
+	createdAt := time.Date(2025, 10, 14, 9, 45, 0, 0, time.UTC)
+
+	var events []*datastore.AuditEvent
+	for id := int64(3); id > 0; id-- {
+		events = append(events, &datastore.AuditEvent{
+			ID:         id,
+			ActorID:    sql.NullInt64{Int64: 1, Valid: true},
+			Action:     datastore.AuditActionCreate,
+			EntityType: datastore.AuditEntityGenre,
+			EntityID:   "1",
+			After:      json.RawMessage(`{"id":1}`),
+			CreatedAt:  createdAt,
+		})
+	}
+
+	tests := []struct {
+		name           string
+		roles          []string
+		target         string
+		expectedStatus int
+		expectedFilter *datastore.AuditEventFilter
+		expectedIDs    []int64
+		expectedNext   bool
+		expectedBody   map[string]any
+	}{
+		{
+			name:           "returns status 403 for a non admin",
+			target:         "/api/v1/audit",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "returns the events newest first",
+			roles:          []string{datastore.RoleAdmin},
+			target:         "/api/v1/audit",
+			expectedStatus: http.StatusOK,
+			expectedFilter: &datastore.AuditEventFilter{Limit: defaultAuditPageSize + 1},
+			expectedIDs:    []int64{3, 2, 1},
+		},
+		{
+			name:           "passes the filters to the store",
+			roles:          []string{datastore.RoleAdmin},
+			target:         "/api/v1/audit?entity_type=genre&entity_id=1&actor_id=1&since=2025-10-01T00:00:00Z&until=2025-11-01T00:00:00Z",
+			expectedStatus: http.StatusOK,
+			expectedFilter: &datastore.AuditEventFilter{
+				EntityType: "genre",
+				EntityID:   "1",
+				ActorID:    1,
+				Since:      time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+				Until:      time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC),
+				Limit:      defaultAuditPageSize + 1,
+			},
+			expectedIDs: []int64{3, 2, 1},
+		},
+		{
+			name:           "returns a cursor when there is a next page",
+			roles:          []string{datastore.RoleAdmin},
+			target:         "/api/v1/audit?limit=2",
+			expectedStatus: http.StatusOK,
+			expectedFilter: &datastore.AuditEventFilter{Limit: 3},
+			expectedIDs:    []int64{3, 2},
+			expectedNext:   true,
+		},
+		{
+			name:           "continues after the cursor",
+			roles:          []string{datastore.RoleAdmin},
+			target:         "/api/v1/audit?limit=2&cursor=" + encodeAuditCursor(2),
+			expectedStatus: http.StatusOK,
+			expectedFilter: &datastore.AuditEventFilter{BeforeID: 2, Limit: 3},
+			expectedIDs:    []int64{1},
+		},
+		{
+			name:           "returns status 400 for invalid parameters",
+			roles:          []string{datastore.RoleAdmin},
+			target:         "/api/v1/audit?actor_id=x&since=yesterday&limit=500&cursor=!",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]any{
+				"status":  float64(http.StatusBadRequest),
+				"message": "bad request",
+				"errors": []any{
+					"actor_id must be a positive integer",
+					"since must be an RFC 3339 timestamp",
+					"limit must be between 1 and 200",
+					"cursor is invalid",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := &datastore.User{ID: 1, Email: "jane@example.com", Roles: tt.roles}
+			sessions := newSessionManager(newMemorySessionStore(admin), config.SessionConfig{TTL: time.Hour}, false)
+			store := &mockAuditStore{events: events}
+
+			mux := http.NewServeMux()
+			registerAuditRoutes(mux, sessions, store)
+
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.AddCookie(login(t, sessions, admin))
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body)
+			}
+
+			if tt.expectedFilter != nil {
+				if diff := cmp.Diff([]datastore.AuditEventFilter{*tt.expectedFilter}, store.filters); diff != "" {
+					t.Errorf("filter mismatch (-want +got):\n%s", diff)
+				}
+			}
+
+			if tt.expectedBody != nil {
+				var body map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tt.expectedBody, body); diff != "" {
+					t.Errorf("body mismatch (-want +got):\n%s", diff)
+				}
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Data       []AuditEventDto `json:"data"`
+				NextCursor *string         `json:"next_cursor"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int64
+			for _, e := range body.Data {
+				ids = append(ids, e.ID)
+			}
+			if diff := cmp.Diff(tt.expectedIDs, ids); diff != "" {
+				t.Errorf("ids mismatch (-want +got):\n%s", diff)
+			}
+
+			if got := body.NextCursor != nil; got != tt.expectedNext {
+				t.Errorf("expected next cursor %v, got %v", tt.expectedNext, got)
+			}
+		})
+	}
+}
+
+func TestAuditInfo(t *testing.T) {
+	user := &datastore.User{ID: 1, Email: "jane@example.com"}
+	sessions := newSessionManager(newMemorySessionStore(user), config.SessionConfig{TTL: time.Hour}, false)
+
+	tests := []struct {
+		name      string
+		loggedIn  bool
+		requestID string
+		expected  datastore.AuditInfo
+	}{
+		{
+			name:      "records the ip address of anonymous requests",
+			requestID: "abc-123",
+			expected:  datastore.AuditInfo{RequestID: "abc-123", IPAddress: "192.0.2.1"},
+		},
+		{
+			name:      "records the user and request id",
+			loggedIn:  true,
+			requestID: "abc-123",
+			expected: datastore.AuditInfo{
+				ActorID:   sql.NullInt64{Int64: 1, Valid: true},
+				RequestID: "abc-123",
+				IPAddress: "192.0.2.1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got datastore.AuditInfo
+
+			handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = datastore.AuditInfoFromContext(r.Context())
+			}), requestIDs, sessions.loadSession, auditInfo)
+
+			req := httptest.NewRequest("POST", "/api/v1/genres", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.loggedIn {
+				req.AddCookie(login(t, sessions, user))
+			}
+			req.Header.Set("X-Request-ID", tt.requestID)
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("audit info mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
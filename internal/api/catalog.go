@@ -0,0 +1,396 @@
+package api
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/validator"
+)
+
+const mediaTypeGzip = "application/gzip"
+
+// catalogMediaTypes are the formats of an export and an import, NDJSON is
+// served to clients that accept anything.
+var catalogMediaTypes = []string{mediaTypeNDJSON, mediaTypeGzip}
+
+// maxImportEntryBytes limits a line of NDJSON and a file of a tarball, the
+// size of the import itself is limited by the limitBodies middleware.
+const maxImportEntryBytes = 64 << 10
+
+const catalogTypeGenre = "genre"
+
+var (
+	errCatalogMediaType = errors.New("api: catalog media type must be " + strings.Join(catalogMediaTypes, " or "))
+	errNotGzip          = errors.New("api: import is not a gzipped tarball")
+)
+
+// catalogEntryDto is a line of an NDJSON export, the type tells what data is.
+type catalogEntryDto struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type ImportResultDto struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// importError is an invalid entry of an import, the messages tell where it is.
+type importError struct {
+	errs []string
+}
+
+func (e *importError) Error() string {
+	return "invalid import: " + strings.Join(e.errs, ", ")
+}
+
+func newImportError(position string, messages ...string) *importError {
+	errs := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		errs = append(errs, position+": "+msg)
+	}
+	return &importError{errs: errs}
+}
+
+// handleExport streams every entity of the catalog straight from the store,
+// as NDJSON or as a gzipped tarball with a JSON file per entity. Nothing is
+// sent before the first entity, so failing to start the export still gets a
+// 500, failing after it aborts the response.
+func handleExport(store CatalogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		mediaType, ok := negotiate(r.Header.Get("Accept"), catalogMediaTypes)
+		if !ok {
+			handleNotAcceptable(w, "supported media types are "+strings.Join(catalogMediaTypes, ", "))
+			return
+		}
+
+		start := func() {
+			filename := "catalog.ndjson"
+			if mediaType == mediaTypeGzip {
+				filename = "catalog.tar.gz"
+			}
+
+			w.Header().Set("Content-Type", mediaType)
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusOK)
+		}
+
+		count, err := exportCatalog(r.Context(), store, w, mediaType, start)
+		if err != nil {
+			if count == 0 {
+				handleInternalServerError(w, r, err)
+				return
+			}
+
+			slog.ErrorContext(r.Context(), "could not write export", "err", err, "exported", count)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// ExportCatalog writes every entity of the catalog to w like
+// GET /api/v1/export does, mediaType is application/x-ndjson or
+// application/gzip. It returns the number of entities written.
+func ExportCatalog(ctx context.Context, store CatalogStore, w io.Writer, mediaType string) (int, error) {
+	if !slices.Contains(catalogMediaTypes, mediaType) {
+		return 0, errCatalogMediaType
+	}
+
+	return exportCatalog(ctx, store, w, mediaType, func() {})
+}
+
+// exportCatalog calls start right before writing the first entity, or on
+// closing an empty export.
+func exportCatalog(ctx context.Context, store CatalogStore, w io.Writer, mediaType string, start func()) (int, error) {
+	exporter := newCatalogExporter(w, mediaType, start)
+
+	err := store.ExportGenres(ctx, func(genre *datastore.Genre) error {
+		return exporter.write(catalogTypeGenre, genre.Slug, mapGenre(genre))
+	})
+	if err != nil {
+		return exporter.count, err
+	}
+
+	return exporter.count, exporter.close()
+}
+
+type catalogExporter struct {
+	w     io.Writer
+	start func()
+	count int
+
+	gzip *gzip.Writer
+	tar  *tar.Writer
+	json *json.Encoder
+}
+
+func newCatalogExporter(w io.Writer, mediaType string, start func()) *catalogExporter {
+	e := &catalogExporter{w: w, start: start}
+
+	if mediaType == mediaTypeGzip {
+		e.gzip = gzip.NewWriter(w)
+		e.tar = tar.NewWriter(e.gzip)
+	} else {
+		e.json = json.NewEncoder(w)
+	}
+
+	return e
+}
+
+// write adds an entity, a tarball stores it as <type>s/<name>.json.
+func (e *catalogExporter) write(typ, name string, data any) error {
+	if e.count == 0 {
+		e.start()
+	}
+	e.count++
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if e.json != nil {
+		return e.json.Encode(catalogEntryDto{Type: typ, Data: b})
+	}
+
+	err = e.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     typ + "s/" + name + ".json",
+		Mode:     0o644,
+		Size:     int64(len(b)),
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = e.tar.Write(b)
+	return err
+}
+
+// close ends the export, an empty catalog is exported as an empty file.
+func (e *catalogExporter) close() error {
+	if e.count == 0 {
+		e.start()
+	}
+
+	if e.tar == nil {
+		return nil
+	}
+
+	if err := e.tar.Close(); err != nil {
+		return err
+	}
+	return e.gzip.Close()
+}
+
+// handleImport upserts the entities of an export by their slug, in a single
+// transaction so an invalid entity leaves the catalog as it was. Importing
+// the same export again changes nothing.
+func handleImport(store CatalogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		result, err := ImportCatalog(r.Context(), store, r.Body, mediaType)
+		if err != nil {
+			var importErr *importError
+
+			switch {
+			case errors.Is(err, errCatalogMediaType):
+				handleUnsupportedMediaType(w, "supported media types are "+strings.Join(catalogMediaTypes, ", "))
+			case errors.Is(err, errNotGzip):
+				handleBadRequest(w, "body is not a gzipped tarball", nil)
+			case errors.As(err, &importErr):
+				handleBadRequest(w, "invalid import", importErr.errs)
+			default:
+				handleInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, map[string]any{
+			"data": ImportResultDto{
+				Created:   result.Created,
+				Updated:   result.Updated,
+				Unchanged: result.Unchanged,
+			},
+		}, nil)
+
+		if err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+	}
+}
+
+// ImportCatalog upserts the entities of an export read from r like
+// POST /api/v1/import does, mediaType is application/x-ndjson or
+// application/gzip.
+func ImportCatalog(ctx context.Context, store CatalogStore, r io.Reader, mediaType string) (*datastore.ImportResult, error) {
+	var next func() (*datastore.Genre, error)
+
+	switch mediaType {
+	case mediaTypeNDJSON:
+		next = ndjsonImporter(r)
+	case mediaTypeGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errNotGzip
+		}
+		defer gz.Close()
+		next = tarImporter(gz)
+	default:
+		return nil, errCatalogMediaType
+	}
+
+	return store.ImportGenres(ctx, next)
+}
+
+// ndjsonImporter reads the genres of an NDJSON export a line at a time,
+// blank lines are skipped.
+func ndjsonImporter(body io.Reader) func() (*datastore.Genre, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportEntryBytes)
+
+	line := 0
+
+	return func() (*datastore.Genre, error) {
+		for scanner.Scan() {
+			line++
+
+			b := bytes.TrimSpace(scanner.Bytes())
+			if len(b) == 0 {
+				continue
+			}
+
+			position := "line " + strconv.Itoa(line)
+
+			var entry catalogEntryDto
+			if err := decodeImportJSON(b, &entry); err != nil {
+				return nil, newImportError(position, err.Error())
+			}
+
+			if entry.Type != catalogTypeGenre {
+				return nil, newImportError(position, fmt.Sprintf("unknown type %q", entry.Type))
+			}
+
+			return importGenre(position, entry.Data)
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, newImportError("line "+strconv.Itoa(line+1), readErrorMessage(err))
+		}
+
+		return nil, io.EOF
+	}
+}
+
+// tarImporter reads the genres of a tarball export, a file at a time.
+// Directories are skipped, other files are rejected.
+func tarImporter(body io.Reader) func() (*datastore.Genre, error) {
+	tr := tar.NewReader(body)
+
+	return func() (*datastore.Genre, error) {
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			if err != nil {
+				return nil, newImportError("tarball", readErrorMessage(err))
+			}
+
+			if hdr.Typeflag == tar.TypeDir {
+				continue
+			}
+
+			position := hdr.Name
+
+			dir, file := path.Split(path.Clean(hdr.Name))
+			if hdr.Typeflag != tar.TypeReg || dir != catalogTypeGenre+"s/" || path.Ext(file) != ".json" {
+				return nil, newImportError(position, "unknown entry")
+			}
+
+			if hdr.Size > maxImportEntryBytes {
+				return nil, newImportError(position, "must not be larger than "+strconv.Itoa(maxImportEntryBytes)+" bytes")
+			}
+
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, newImportError(position, readErrorMessage(err))
+			}
+
+			return importGenre(position, b)
+		}
+	}
+}
+
+// importGenre validates a genre of an export like a created one, its ID is
+// ignored as genres are imported by their slug.
+func importGenre(position string, data []byte) (*datastore.Genre, error) {
+	var dto GenreDto
+	if err := decodeImportJSON(data, &dto); err != nil {
+		return nil, newImportError(position, err.Error())
+	}
+
+	input := genreInput{Slug: dto.Slug, Name: dto.Name}
+
+	v := validator.New()
+	input.validate(v)
+
+	if !v.IsValid() {
+		return nil, newImportError(position, v.GetErrors()...)
+	}
+
+	genre := input.genre()
+	genre.CreatedAt = dto.CreatedAt
+
+	return genre, nil
+}
+
+func decodeImportJSON(b []byte, dst any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return errors.New("contains invalid JSON: " + err.Error())
+	}
+	if dec.More() {
+		return errors.New("must contain a single JSON object")
+	}
+
+	return nil
+}
+
+func readErrorMessage(err error) string {
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesError):
+		return "body must not be larger than " + strconv.FormatInt(maxBytesError.Limit, 10) + " bytes"
+	case errors.Is(err, bufio.ErrTooLong):
+		return "must not be longer than " + strconv.Itoa(maxImportEntryBytes) + " bytes"
+	default:
+		return "could not read body: " + err.Error()
+	}
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+type mockCatalogStore struct {
+	genres    []*datastore.Genre
+	exportErr error
+	// failAfter fails the export after that many genres
+	failAfter int
+
+	imported []*datastore.Genre
+}
+
+func (m *mockCatalogStore) ExportGenres(ctx context.Context, fn func(*datastore.Genre) error) error {
+	if m.exportErr != nil && m.failAfter == 0 {
+		return m.exportErr
+	}
+
+	for i, g := range m.genres {
+		if m.exportErr != nil && i == m.failAfter {
+			return m.exportErr
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportGenres upserts into the genres of the mock by slug, like the store
+// does, so importing twice changes nothing.
+func (m *mockCatalogStore) ImportGenres(ctx context.Context, next func() (*datastore.Genre, error)) (*datastore.ImportResult, error) {
+	result := &datastore.ImportResult{}
+	var imported []*datastore.Genre
+
+	for {
+		genre, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, genre)
+	}
+
+	for _, genre := range imported {
+		var existing *datastore.Genre
+		for _, g := range m.genres {
+			if g.Slug == genre.Slug {
+				existing = g
+			}
+		}
+
+		switch {
+		case existing == nil:
+			m.genres = append(m.genres, genre)
+			result.Created++
+		case existing.Name != genre.Name:
+			existing.Name = genre.Name
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	m.imported = append(m.imported, imported...)
+	return result, nil
+}
+
+func catalogGenres() []*datastore.Genre {
+	createdAt := time.Date(2025, 10, 14, 9, 45, 0, 0, time.UTC)
+
+	return []*datastore.Genre{
+		{ID: 2, Slug: "comedy", Name: sql.NullString{String: "Comedy", Valid: true}, CreatedAt: createdAt},
+		{ID: 1, Slug: "drama", CreatedAt: createdAt},
+	}
+}
+
+func serveCatalog(t *testing.T, store *mockCatalogStore, roles []string, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	admin := &datastore.User{ID: 1, Email: "jane@example.com", Roles: roles}
+	sessions := newSessionManager(newMemorySessionStore(admin), config.SessionConfig{TTL: time.Hour}, false)
+
+	mux := http.NewServeMux()
+	registerCatalogRoutes(mux, sessions, store)
+
+	req.AddCookie(login(t, sessions, admin))
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetExport(t *testing.T) {
+	admin := []string{datastore.RoleAdmin}
+
+	t.Run("returns status 403 for a non admin", func(t *testing.T) {
+		rec := serveCatalog(t, &mockCatalogStore{}, nil, httptest.NewRequest("GET", "/api/v1/export", nil))
+
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("streams the genres as NDJSON", func(t *testing.T) {
+		rec := serveCatalog(t, &mockCatalogStore{genres: catalogGenres()}, admin, httptest.NewRequest("GET", "/api/v1/export", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+		}
+
+		expectedHeaders := map[string]string{
+			"Content-Type":        mediaTypeNDJSON,
+			"Content-Disposition": `attachment; filename="catalog.ndjson"`,
+			"Vary":                "Accept",
+		}
+		for name, expected := range expectedHeaders {
+			if got := rec.Header().Get(name); got != expected {
+				t.Errorf("expected %s %q, got %q", name, expected, got)
+			}
+		}
+
+		expected := `{"type":"genre","data":{"id":2,"slug":"comedy","name":"Comedy","created_at":"2025-10-14T09:45:00Z"}}
+{"type":"genre","data":{"id":1,"slug":"drama","created_at":"2025-10-14T09:45:00Z"}}
+`
+		if diff := cmp.Diff(expected, rec.Body.String()); diff != "" {
+			t.Errorf("body mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("streams the genres as a gzipped tarball", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/export", nil)
+		req.Header.Set("Accept", mediaTypeGzip)
+
+		rec := serveCatalog(t, &mockCatalogStore{genres: catalogGenres()}, admin, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="catalog.tar.gz"` {
+			t.Errorf("expected the tarball as attachment, got %q", got)
+		}
+
+		gz, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+
+		files := map[string]string{}
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[hdr.Name] = string(b)
+		}
+
+		expected := map[string]string{
+			"genres/comedy.json": `{"id":2,"slug":"comedy","name":"Comedy","created_at":"2025-10-14T09:45:00Z"}`,
+			"genres/drama.json":  `{"id":1,"slug":"drama","created_at":"2025-10-14T09:45:00Z"}`,
+		}
+		if diff := cmp.Diff(expected, files); diff != "" {
+			t.Errorf("files mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("returns status 406 for an unsupported media type", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/export", nil)
+		req.Header.Set("Accept", mediaTypeXML)
+
+		rec := serveCatalog(t, &mockCatalogStore{}, admin, req)
+
+		if rec.Code != http.StatusNotAcceptable {
+			t.Fatalf("expected status %d, got %d", http.StatusNotAcceptable, rec.Code)
+		}
+	})
+
+	t.Run("returns status 500 when the export fails to start", func(t *testing.T) {
+		store := &mockCatalogStore{genres: catalogGenres(), exportErr: errors.New("boom")}
+
+		rec := serveCatalog(t, store, admin, httptest.NewRequest("GET", "/api/v1/export", nil))
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+		}
+	})
+
+	t.Run("aborts the response when the export fails halfway", func(t *testing.T) {
+		store := &mockCatalogStore{genres: catalogGenres(), exportErr: errors.New("boom"), failAfter: 1}
+
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Errorf("expected the handler to abort, got %v", err)
+			}
+		}()
+
+		serveCatalog(t, store, admin, httptest.NewRequest("GET", "/api/v1/export", nil))
+	})
+}
+
+func TestPostImport(t *testing.T) {
+	admin := []string{datastore.RoleAdmin}
+
+	ndjson := `{"type":"genre","data":{"id":2,"slug":"comedy","name":"Comedies","created_at":"2025-10-14T09:45:00Z"}}
+
+{"type":"genre","data":{"slug":"thriller","name":"Thriller"}}
+`
+
+	tests := []struct {
+		name           string
+		roles          []string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedBody   map[string]any
+	}{
+		{
+			name:           "returns status 403 for a non admin",
+			contentType:    mediaTypeNDJSON,
+			body:           ndjson,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "upserts the genres by slug",
+			roles:          admin,
+			contentType:    mediaTypeNDJSON,
+			body:           ndjson,
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]any{
+				"data": map[string]any{"created": float64(1), "updated": float64(1), "unchanged": float64(0)},
+			},
+		},
+		{
+			name:           "returns status 400 for an invalid genre",
+			roles:          admin,
+			contentType:    mediaTypeNDJSON,
+			body:           ndjson + `{"type":"genre","data":{"slug":"Not A Slug"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]any{
+				"status":  float64(http.StatusBadRequest),
+				"message": "invalid import",
+				"errors":  []any{"line 4: slug must contain only lowercase letters and hyphens"},
+			},
+		},
+		{
+			name:           "returns status 400 for an unknown type",
+			roles:          admin,
+			contentType:    mediaTypeNDJSON,
+			body:           `{"type":"movie","data":{}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]any{
+				"status":  float64(http.StatusBadRequest),
+				"message": "invalid import",
+				"errors":  []any{`line 1: unknown type "movie"`},
+			},
+		},
+		{
+			name:           "returns status 400 for invalid JSON",
+			roles:          admin,
+			contentType:    mediaTypeNDJSON,
+			body:           `{"type":"genre","data":{"slug":"drama","rating":5}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]any{
+				"status":  float64(http.StatusBadRequest),
+				"message": "invalid import",
+				"errors":  []any{`line 1: contains invalid JSON: json: unknown field "rating"`},
+			},
+		},
+		{
+			name:           "returns status 400 for a body that is not gzipped",
+			roles:          admin,
+			contentType:    mediaTypeGzip,
+			body:           ndjson,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "returns status 415 for an unsupported media type",
+			roles:          admin,
+			contentType:    mediaTypeJSON,
+			body:           `{}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockCatalogStore{genres: catalogGenres()}
+
+			req := httptest.NewRequest("POST", "/api/v1/import", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rec := serveCatalog(t, store, tt.roles, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body)
+			}
+
+			if tt.expectedBody != nil {
+				var body map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tt.expectedBody, body); diff != "" {
+					t.Errorf("body mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	admin := []string{datastore.RoleAdmin}
+
+	for _, mediaType := range catalogMediaTypes {
+		t.Run(mediaType, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/export", nil)
+			req.Header.Set("Accept", mediaType)
+
+			exported := serveCatalog(t, &mockCatalogStore{genres: catalogGenres()}, admin, req)
+			if exported.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, exported.Code)
+			}
+
+			store := &mockCatalogStore{genres: catalogGenres()}
+
+			req = httptest.NewRequest("POST", "/api/v1/import", bytes.NewReader(exported.Body.Bytes()))
+			req.Header.Set("Content-Type", mediaType)
+
+			rec := serveCatalog(t, store, admin, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+			}
+
+			var body struct {
+				Data ImportResultDto `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(ImportResultDto{Unchanged: 2}, body.Data); diff != "" {
+				t.Errorf("result mismatch (-want +got):\n%s", diff)
+			}
+
+			// the IDs of an export are not imported
+			expected := catalogGenres()
+			for _, g := range expected {
+				g.ID = 0
+			}
+			if diff := cmp.Diff(expected, store.imported); diff != "" {
+				t.Errorf("imported mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+
+	"github.com/tommarien/movie-land/internal/logging"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const clientIdentityContextKey contextKey = "client_identity"
+
+// clientIdentities maps the CN or a SAN of a verified client certificate onto
+// the identity of an internal caller. Requests of callers it knows carry their
+// identity in the context and the log records.
+type clientIdentities map[string]string
+
+func (ids clientIdentities) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity := ids.identify(r.TLS.VerifiedChains[0][0])
+		if identity == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), clientIdentityContextKey, identity)
+		ctx = logging.WithAttrs(ctx, slog.String("client_identity", identity))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// grpcInterceptor identifies the internal callers of the gRPC API like
+// middleware does for the REST API.
+func (ids clientIdentities) grpcInterceptor(ctx context.Context, method string) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return ctx, nil
+	}
+
+	identity := ids.identify(info.State.VerifiedChains[0][0])
+	if identity == "" {
+		return ctx, nil
+	}
+
+	ctx = context.WithValue(ctx, clientIdentityContextKey, identity)
+	ctx = logging.WithAttrs(ctx, slog.String("client_identity", identity))
+	return ctx, nil
+}
+
+// identify tries the SANs before the CN, which is deprecated for names.
+func (ids clientIdentities) identify(cert *x509.Certificate) string {
+	var names []string
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	names = append(names, cert.Subject.CommonName)
+
+	for _, name := range names {
+		if identity, ok := ids[name]; ok && name != "" {
+			return identity
+		}
+	}
+
+	return ""
+}
+
+// clientIdentityFromContext returns the identity of the internal caller, an
+// empty string for other clients.
+func clientIdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(clientIdentityContextKey).(string)
+	return identity
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientIdentities(t *testing.T) {
+	ids := clientIdentities{
+		"spiffe://corp/billing": "billing",
+		"ingest.internal":       "ingest",
+		"Reporting":             "reporting",
+	}
+
+	spiffe, _ := url.Parse("spiffe://corp/billing")
+
+	tests := []struct {
+		name        string
+		state       *tls.ConnectionState
+		expectedID  string
+		expectedKey string
+	}{
+		{
+			name:        "ignores plaintext requests",
+			expectedKey: "ip:192.0.2.1",
+		},
+		{
+			name: "identifies the caller by a URI SAN",
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{URIs: []*url.URL{spiffe}, Subject: pkix.Name{CommonName: "Reporting"}},
+			}}},
+			expectedID:  "billing",
+			expectedKey: "client:billing",
+		},
+		{
+			name: "identifies the caller by a DNS SAN",
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{DNSNames: []string{"ingest.internal"}},
+			}}},
+			expectedID:  "ingest",
+			expectedKey: "client:ingest",
+		},
+		{
+			name: "identifies the caller by the CN",
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{Subject: pkix.Name{CommonName: "Reporting"}},
+			}}},
+			expectedID:  "reporting",
+			expectedKey: "client:reporting",
+		},
+		{
+			name: "ignores unknown callers",
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{DNSNames: []string{"unknown.internal"}},
+			}}},
+			expectedKey: "ip:192.0.2.1",
+		},
+		{
+			name: "ignores certificates that were not verified",
+			state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{DNSNames: []string{"ingest.internal"}},
+			}},
+			expectedKey: "ip:192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID, gotKey string
+			h := ids.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotID = clientIdentityFromContext(r.Context())
+				gotKey = clientKey(r)
+			}))
+
+			req := httptest.NewRequest("GET", "/api/v1/genres", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.TLS = tt.state
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotID != tt.expectedID {
+				t.Errorf("expected identity %q, got %q", tt.expectedID, gotID)
+			}
+			if gotKey != tt.expectedKey {
+				t.Errorf("expected client key %q, got %q", tt.expectedKey, gotKey)
+			}
+		})
+	}
+}
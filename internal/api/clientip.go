@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const clientIPContextKey contextKey = "client_ip"
+
+// clientIPResolver determines the IP address of the client, X-Forwarded-For is
+// only followed through the configured trusted proxies as anyone can send it.
+type clientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+func newClientIPResolver(trustedProxies []string) (*clientIPResolver, error) {
+	res := &clientIPResolver{}
+
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, err
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		res.trusted = append(res.trusted, prefix)
+	}
+
+	return res, nil
+}
+
+func (res *clientIPResolver) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPContextKey, res.resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// resolve walks X-Forwarded-For from right to left while the hops are trusted
+// proxies, the first untrusted hop is the client.
+func (res *clientIPResolver) resolve(r *http.Request) string {
+	remote := remoteIP(r)
+	if !res.isTrusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+
+		client = hop
+		if !res.isTrusted(hop) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (res *clientIPResolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP address resolved by clientIPResolver,
+// or the address of the connection when it did not run.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
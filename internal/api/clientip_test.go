@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	res, err := newClientIPResolver([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIP   string
+	}{
+		{
+			name:       "uses the connection without X-Forwarded-For",
+			remoteAddr: "198.51.100.7:5000",
+			expectedIP: "198.51.100.7",
+		},
+		{
+			name:         "ignores X-Forwarded-For from an untrusted peer",
+			remoteAddr:   "198.51.100.7:5000",
+			forwardedFor: []string{"203.0.113.9"},
+			expectedIP:   "198.51.100.7",
+		},
+		{
+			name:         "follows X-Forwarded-For from a trusted proxy",
+			remoteAddr:   "192.0.2.1:5000",
+			forwardedFor: []string{"203.0.113.9"},
+			expectedIP:   "203.0.113.9",
+		},
+		{
+			name:         "skips trusted proxies from right to left",
+			remoteAddr:   "10.1.2.3:5000",
+			forwardedFor: []string{"1.1.1.1, 203.0.113.9", "10.0.0.5"},
+			expectedIP:   "203.0.113.9",
+		},
+		{
+			name:         "stops at a malformed hop",
+			remoteAddr:   "10.1.2.3:5000",
+			forwardedFor: []string{"203.0.113.9, bogus, 10.0.0.5"},
+			expectedIP:   "10.0.0.5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			if got := res.resolve(req); got != tt.expectedIP {
+				t.Errorf("expected client IP %s, got %s", tt.expectedIP, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+const primaryCookieName = "movieland_primary"
+
+// readYourWrites sends the reads of writing requests to the primary, and
+// marks their client with a cookie so its reads keep going to the primary
+// for the window the replicas may lag behind. Clients then see their own
+// writes, the others may read slightly stale data from a replica.
+func readYourWrites(window time.Duration, secure bool) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				if _, err := r.Cookie(primaryCookieName); err != nil {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+			default:
+				// set before the handler writes, a failed write marks the client as well
+				http.SetCookie(w, &http.Cookie{
+					Name:     primaryCookieName,
+					Value:    "1",
+					Path:     "/",
+					MaxAge:   int(window.Seconds()),
+					HttpOnly: true,
+					Secure:   secure,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			next.ServeHTTP(w, r.WithContext(datastore.WithPrimary(r.Context())))
+		})
+	}
+}
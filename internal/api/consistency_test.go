@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	var primary bool
+	handler := readYourWrites(15*time.Second, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primary = datastore.ReadsPrimary(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name            string
+		method          string
+		cookie          bool
+		expectedPrimary bool
+		expectedCookie  string
+	}{
+		{name: "reads from replicas", method: "GET"},
+		{name: "writes mark the client", method: "POST", expectedPrimary: true, expectedCookie: "movieland_primary=1; Path=/; Max-Age=15; HttpOnly; Secure; SameSite=Lax"},
+		{name: "marked clients read from the primary", method: "GET", cookie: true, expectedPrimary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/genres", nil)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: primaryCookieName, Value: "1"})
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if primary != tt.expectedPrimary {
+				t.Errorf("expected primary %t, got %t", tt.expectedPrimary, primary)
+			}
+			if got := rr.Header().Get("Set-Cookie"); got != tt.expectedCookie {
+				t.Errorf("expected cookie %q, got %q", tt.expectedCookie, got)
+			}
+		})
+	}
+}
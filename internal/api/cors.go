@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+// corsExposedHeaders are the response headers scripts on other origins may
+// read, next to the ones browsers always expose.
+var corsExposedHeaders = strings.Join([]string{
+	"X-Request-ID",
+	"Location",
+	"Retry-After",
+	"RateLimit-Policy",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"Idempotent-Replayed",
+}, ", ")
+
+// cors lets browsers on the allowed origins of the runtime config call the
+// API with credentials, it answers their preflight requests itself. Requests
+// of other origins are served without CORS headers, so browsers block them.
+func cors(rt *config.Runtime) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := rt.Current().CORS
+
+			origin := r.Header.Get("Origin")
+			if origin == "" || len(cfg.AllowedOrigins) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			// the response differs per origin, caches should keep them apart
+			h.Add("Vary", "Origin")
+
+			if !slices.Contains(cfg.AllowedOrigins, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", "GET, POST, PUT")
+				h.Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key, X-Request-ID")
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+func TestCORS(t *testing.T) {
+	rt := config.NewRuntime(&config.Config{CORS: config.CORSConfig{
+		AllowedOrigins: []string{"https://admin.example.com"},
+		MaxAge:         10 * time.Minute,
+	}}, nil)
+
+	handler := cors(rt)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name            string
+		method          string
+		header          map[string]string
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "allows the allowed origins",
+			method:         "GET",
+			header:         map[string]string{"Origin": "https://admin.example.com"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Vary":                             "Origin",
+				"Access-Control-Allow-Origin":      "https://admin.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    corsExposedHeaders,
+				"Access-Control-Allow-Methods":     "",
+			},
+		},
+		{
+			name:   "answers preflight requests",
+			method: "OPTIONS",
+			header: map[string]string{
+				"Origin":                        "https://admin.example.com",
+				"Access-Control-Request-Method": "POST",
+			},
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Vary":                             "Origin",
+				"Access-Control-Allow-Origin":      "https://admin.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "",
+				"Access-Control-Allow-Methods":     "GET, POST, PUT",
+				"Access-Control-Allow-Headers":     "Content-Type, Idempotency-Key, X-Request-ID",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:           "leaves out the headers for other origins",
+			method:         "GET",
+			header:         map[string]string{"Origin": "https://evil.example.com"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:           "leaves out the headers without an origin",
+			method:         "GET",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Vary":                        "",
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/genres", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			got := make(map[string]string)
+			for k := range tt.expectedHeaders {
+				got[k] = rr.Header().Get(k)
+			}
+			if diff := cmp.Diff(tt.expectedHeaders, got); diff != "" {
+				t.Errorf("headers mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"POST /graphql", "GET /api/v1/export", "GET /api/v1/genres"} {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	rt := config.NewRuntime(&config.Config{Features: map[string]bool{config.FeatureGraphQL: false}}, nil)
+	handler := features(mux, rt)(mux)
+
+	tests := []struct {
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{method: "POST", target: "/graphql", expectedStatus: http.StatusNotFound},
+		{method: "GET", target: "/api/v1/export", expectedStatus: http.StatusNoContent},
+		{method: "GET", target: "/api/v1/genres", expectedStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -3,10 +3,11 @@ package api
 import (
 	"log/slog"
 	"net/http"
+	"time"
 )
 
 func handleInternalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	slog.Error("unhandled error", "method", r.Method, "url", r.URL, "err", err)
+	slog.ErrorContext(r.Context(), "unhandled error", "method", r.Method, "url", r.URL, "err", err)
 	w.WriteHeader(http.StatusInternalServerError)
 }
 
@@ -52,3 +53,101 @@ func handleBadRequest(w http.ResponseWriter, message string, errors []string) {
 
 	writeJSON(w, http.StatusBadRequest, response, nil)
 }
+
+func handleUnauthorized(w http.ResponseWriter, message string) {
+	if message == "" {
+		message = "unauthorized"
+	}
+
+	statusCode := http.StatusUnauthorized
+
+	writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": message,
+	}, nil)
+}
+
+func handleForbidden(w http.ResponseWriter, message string) {
+	if message == "" {
+		message = "forbidden"
+	}
+
+	statusCode := http.StatusForbidden
+
+	writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": message,
+	}, nil)
+}
+
+func handleNotAcceptable(w http.ResponseWriter, message string) {
+	if message == "" {
+		message = "not acceptable"
+	}
+
+	statusCode := http.StatusNotAcceptable
+
+	writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": message,
+	}, nil)
+}
+
+func handleTooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	if message == "" {
+		message = "too many requests"
+	}
+
+	statusCode := http.StatusTooManyRequests
+
+	writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": message,
+	}, http.Header{"Retry-After": []string{retryAfterSeconds(retryAfter)}})
+}
+
+func handleUnsupportedMediaType(w http.ResponseWriter, message string) {
+	if message == "" {
+		message = "unsupported media type"
+	}
+
+	statusCode := http.StatusUnsupportedMediaType
+
+	writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": message,
+	}, nil)
+}
+
+func handleUnprocessableEntity(w http.ResponseWriter, message string) {
+	if message == "" {
+		message = "unprocessable entity"
+	}
+
+	statusCode := http.StatusUnprocessableEntity
+
+	writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": message,
+	}, nil)
+}
+
+// handleServiceUnavailable answers requests the server cannot serve right now,
+// a retryAfter of 0 leaves out the Retry-After header.
+func handleServiceUnavailable(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	if message == "" {
+		message = "service unavailable"
+	}
+
+	statusCode := http.StatusServiceUnavailable
+
+	var headers http.Header
+	if retryAfter > 0 {
+		headers = http.Header{"Retry-After": []string{retryAfterSeconds(retryAfter)}}
+	}
+
+	writeJSON(w, statusCode, map[string]any{
+		"status":  statusCode,
+		"message": message,
+	}, headers)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+// featureRoutes are the routes of the features that can be turned off.
+var featureRoutes = map[string]string{
+	"GET /graphql":        config.FeatureGraphQL,
+	"POST /graphql":       config.FeatureGraphQL,
+	"GET /api/v1/export":  config.FeatureCatalog,
+	"POST /api/v1/import": config.FeatureCatalog,
+}
+
+// features answers the routes of features turned off in the runtime config
+// as if they did not exist.
+func features(mux *http.ServeMux, rt *config.Runtime) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			if feature, ok := featureRoutes[pattern]; ok && !rt.Current().FeatureEnabled(feature) {
+				handleNotFound(w, "")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
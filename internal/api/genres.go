@@ -2,22 +2,48 @@ package api
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/tommarien/movie-land/internal/datastore"
 	"github.com/tommarien/movie-land/internal/validator"
 )
 
+// the page sizes of the paginated genre listings of the GraphQL and gRPC APIs
+const (
+	defaultGenrePageSize = 20
+	maxGenrePageSize     = 100
+)
+
 type GenreDto struct {
-	ID        int       `json:"id"`
-	Slug      string    `json:"slug"`
-	Name      string    `json:"name,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int       `json:"id" xml:"id"`
+	Slug      string    `json:"slug" xml:"slug"`
+	Name      string    `json:"name,omitempty" xml:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+}
+
+func (dto *GenreDto) csvHeader() []string {
+	return []string{"id", "slug", "name", "created_at"}
+}
+
+func (dto *GenreDto) csvRecord() []string {
+	return []string{strconv.Itoa(dto.ID), dto.Slug, dto.Name, dto.CreatedAt.Format(time.RFC3339Nano)}
+}
+
+type genreInput struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
 }
 
 func handleGenreGet(store GenreStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		rd, ok := negotiateRenderer(w, r, "genres", "genre")
+		if !ok {
+			return
+		}
+
 		id, err := getIntParam(r, "id")
 		if err != nil {
 			handleNotFound(w, "genre not found")
@@ -34,9 +60,7 @@ func handleGenreGet(store GenreStore) http.HandlerFunc {
 			return
 		}
 
-		err = writeJSON(w, http.StatusOK, map[string]any{
-			"data": mapGenre(genre),
-		}, nil)
+		err = rd.one(http.StatusOK, mapGenre(genre))
 
 		if err != nil {
 			handleInternalServerError(w, r, err)
@@ -47,35 +71,29 @@ func handleGenreGet(store GenreStore) http.HandlerFunc {
 
 func handleGenreIndex(store GenreStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		genres, err := store.ListGenres(r.Context())
-		if err != nil {
-			handleInternalServerError(w, r, err)
+		rd, ok := negotiateRenderer(w, r, "genres", "genre")
+		if !ok {
 			return
 		}
 
-		data := make([]*GenreDto, 0, len(genres))
-		for _, g := range genres {
-			dto := mapGenre(g)
-			data = append(data, dto)
+		sent, err := renderEach(rd, http.StatusOK, func(fn func(*datastore.Genre) error) error {
+			return store.EachGenre(r.Context(), fn)
+		}, mapGenre)
+		if err != nil && !sent {
+			handleInternalServerError(w, r, err)
+			return
 		}
 
-		err = writeJSON(w, http.StatusOK, map[string]any{
-			"data": data,
-		}, nil)
-
+		// the status is sent, the client can only notice the response is cut short
 		if err != nil {
-			handleInternalServerError(w, r, err)
-			return
+			slog.ErrorContext(r.Context(), "could not write genres", "err", err)
 		}
 	}
 }
 
 func handleGenrePost(store GenreStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var input struct {
-			Slug string `json:"slug"`
-			Name string `json:"name"`
-		}
+		var input genreInput
 
 		err := readJSON(w, r, &input)
 		if err != nil {
@@ -84,24 +102,14 @@ func handleGenrePost(store GenreStore) http.HandlerFunc {
 		}
 
 		v := validator.New()
-		v.Required("slug", input.Slug)
-		v.MaxLength("slug", input.Slug, 40)
-		v.Slug("slug", input.Slug)
-		v.MaxLength("name", input.Name, 40)
+		input.validate(v)
 
 		if !v.IsValid() {
 			handleBadRequest(w, "", v.GetErrors())
 			return
 		}
 
-		genre := &datastore.Genre{
-			Slug: input.Slug,
-		}
-
-		if input.Name != "" {
-			genre.Name.String = input.Name
-			genre.Name.Valid = true
-		}
+		genre := input.genre()
 
 		err = store.InsertGenre(r.Context(), genre)
 		if err != nil {
@@ -124,6 +132,27 @@ func handleGenrePost(store GenreStore) http.HandlerFunc {
 	}
 }
 
+// validate applies the rules of genres, shared by the REST and GraphQL endpoints.
+func (input *genreInput) validate(v *validator.Validator) {
+	v.Required("slug", input.Slug)
+	v.MaxLength("slug", input.Slug, 40)
+	v.Slug("slug", input.Slug)
+	v.MaxLength("name", input.Name, 40)
+}
+
+func (input *genreInput) genre() *datastore.Genre {
+	genre := &datastore.Genre{
+		Slug: input.Slug,
+	}
+
+	if input.Name != "" {
+		genre.Name.String = input.Name
+		genre.Name.Valid = true
+	}
+
+	return genre
+}
+
 func mapGenre(genre *datastore.Genre) *GenreDto {
 	dto := &GenreDto{
 		ID:        genre.ID,
@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
@@ -20,13 +21,28 @@ type mockGenreStore struct {
 	listGenresFunc  func(context.Context) ([]*datastore.Genre, error)
 	getGenreFunc    func(context.Context, int) (*datastore.Genre, error)
 	insertGenreFunc func(context.Context, *datastore.Genre) error
+	updateGenreFunc func(context.Context, *datastore.Genre) error
+	listPageFunc    func(context.Context, datastore.GenreFilter) ([]*datastore.Genre, error)
+	byIDsFunc       func(context.Context, []int) ([]*datastore.Genre, error)
+	bySlugsFunc     func(context.Context, []string) ([]*datastore.Genre, error)
 }
 
-func (m *mockGenreStore) ListGenres(ctx context.Context) ([]*datastore.Genre, error) {
-	if m.listGenresFunc != nil {
-		return m.listGenresFunc(ctx)
+func (m *mockGenreStore) EachGenre(ctx context.Context, fn func(*datastore.Genre) error) error {
+	if m.listGenresFunc == nil {
+		return nil
 	}
-	return []*datastore.Genre{}, nil
+
+	genres, err := m.listGenresFunc(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, genre := range genres {
+		if err = fn(genre); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m *mockGenreStore) GetGenre(ctx context.Context, ID int) (*datastore.Genre, error) {
@@ -44,6 +60,34 @@ func (m *mockGenreStore) InsertGenre(ctx context.Context, genre *datastore.Genre
 	return errors.New("No insertGenre call expected")
 }
 
+func (m *mockGenreStore) UpdateGenre(ctx context.Context, genre *datastore.Genre) error {
+	if m.updateGenreFunc != nil {
+		return m.updateGenreFunc(ctx, genre)
+	}
+	return errors.New("No updateGenre call expected")
+}
+
+func (m *mockGenreStore) ListGenresPage(ctx context.Context, filter datastore.GenreFilter) ([]*datastore.Genre, error) {
+	if m.listPageFunc != nil {
+		return m.listPageFunc(ctx, filter)
+	}
+	return []*datastore.Genre{}, nil
+}
+
+func (m *mockGenreStore) GetGenresByIDs(ctx context.Context, IDs []int) ([]*datastore.Genre, error) {
+	if m.byIDsFunc != nil {
+		return m.byIDsFunc(ctx, IDs)
+	}
+	return []*datastore.Genre{}, nil
+}
+
+func (m *mockGenreStore) GetGenresBySlugs(ctx context.Context, slugs []string) ([]*datastore.Genre, error) {
+	if m.bySlugsFunc != nil {
+		return m.bySlugsFunc(ctx, slugs)
+	}
+	return []*datastore.Genre{}, nil
+}
+
 func parseGenreResponse(t *testing.T, body []byte) map[string]any {
 	t.Helper()
 	var result map[string]any
@@ -70,6 +114,13 @@ func TestGetGenres(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedData:   []any{},
 		},
+		{
+			name: "returns status 500 when the genres cannot be read",
+			mockFunc: func(ctx context.Context) ([]*datastore.Genre, error) {
+				return nil, errors.New("database error")
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
 		{
 			name: "returns list of genres with valid data",
 			mockFunc: func(ctx context.Context) ([]*datastore.Genre, error) {
@@ -170,6 +221,141 @@ func TestGetGenres(t *testing.T) {
 	}
 }
 
+func TestGetGenresRepresentations(t *testing.T) {
+	fixedTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	genres := []*datastore.Genre{
+		{ID: 1, Slug: "action", Name: sql.NullString{String: "Action", Valid: true}, CreatedAt: fixedTime},
+		{ID: 2, Slug: "drama", Name: sql.NullString{String: "=HYPERLINK(1)", Valid: true}, CreatedAt: fixedTime},
+	}
+
+	tests := []struct {
+		name                string
+		accept              string
+		genres              []*datastore.Genre
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "returns JSON by default",
+			genres:              genres[:1],
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        `{"data":[{"id":1,"slug":"action","name":"Action","created_at":"2024-01-01T12:00:00Z"}]}`,
+		},
+		{
+			name:                "returns an empty JSON list",
+			genres:              []*datastore.Genre{},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        `{"data":[]}`,
+		},
+		{
+			name:                "returns CSV with a header row and defused formulas",
+			accept:              "text/csv",
+			genres:              genres,
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody: "id,slug,name,created_at\n" +
+				"1,action,Action,2024-01-01T12:00:00Z\n" +
+				"2,drama,'=HYPERLINK(1),2024-01-01T12:00:00Z\n",
+		},
+		{
+			name:                "returns the CSV header row for an empty list",
+			accept:              "text/csv",
+			genres:              []*datastore.Genre{},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody:        "id,slug,name,created_at\n",
+		},
+		{
+			name:                "returns XML",
+			accept:              "application/xml",
+			genres:              genres[:1],
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedBody: xml.Header +
+				"<genres><genre><id>1</id><slug>action</slug><name>Action</name><created_at>2024-01-01T12:00:00Z</created_at></genre></genres>",
+		},
+		{
+			name:                "returns NDJSON",
+			accept:              "application/x-ndjson",
+			genres:              genres,
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"id":1,"slug":"action","name":"Action","created_at":"2024-01-01T12:00:00Z"}` + "\n" +
+				`{"id":2,"slug":"drama","name":"=HYPERLINK(1)","created_at":"2024-01-01T12:00:00Z"}` + "\n",
+		},
+		{
+			name:                "returns status 406 for an unsupported media type",
+			accept:              "text/html",
+			expectedStatus:      http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+			expectedBody:        `{"message":"supported media types are application/json, text/csv, application/xml, application/x-ndjson","status":406}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			registerRoutes(mux, &mockGenreStore{
+				listGenresFunc: func(ctx context.Context) ([]*datastore.Genre, error) {
+					return tt.genres, nil
+				},
+			})
+
+			req := httptest.NewRequest("GET", "/api/v1/genres", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status code %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			if contentType := rec.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.expectedContentType, contentType)
+			}
+
+			if vary := rec.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("expected Vary 'Accept', got %q", vary)
+			}
+
+			if diff := cmp.Diff(tt.expectedBody, rec.Body.String()); diff != "" {
+				t.Errorf("body mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetGenreAsXML(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux, &mockGenreStore{
+		getGenreFunc: func(ctx context.Context, ID int) (*datastore.Genre, error) {
+			return &datastore.Genre{ID: ID, Slug: "drama", CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}, nil
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/genres/2", nil)
+	req.Header.Set("Accept", "text/html;q=0.9, application/xml")
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	expected := xml.Header + "<genre><id>2</id><slug>drama</slug><created_at>2024-01-01T12:00:00Z</created_at></genre>"
+	if diff := cmp.Diff(expected, rec.Body.String()); diff != "" {
+		t.Errorf("body mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestGetGenre(t *testing.T) {
 	fixedTime := time.Date(2025, 12, 6, 12, 0, 0, 0, time.UTC)
 
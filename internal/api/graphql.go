@@ -0,0 +1,731 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/validator"
+)
+
+const (
+	// maxGraphQLDepth is the deepest nesting of fields a query may select
+	maxGraphQLDepth = 8
+	// maxGraphQLComplexity bounds the number of fields a query may resolve,
+	// counting the fields below a paginated field once per requested item
+	maxGraphQLComplexity = 1000
+)
+
+type graphQLRequest struct {
+	Query         string         `json:"query" openapi:"required"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// graphQLResponse documents the body of the GraphQL endpoint.
+type graphQLResponse struct {
+	Data   map[string]any    `json:"data,omitempty"`
+	Errors []graphQLErrorDto `json:"errors,omitempty"`
+}
+
+type graphQLErrorDto struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// graphQLError is an error for the client, its code ends up in the extensions
+// of the error in the response.
+type graphQLError struct {
+	message string
+	code    string
+	errors  []string
+}
+
+func (e *graphQLError) Error() string {
+	return e.message
+}
+
+func (e *graphQLError) Extensions() map[string]any {
+	extensions := map[string]any{"code": e.code}
+	if len(e.errors) > 0 {
+		extensions["errors"] = e.errors
+	}
+	return extensions
+}
+
+func badUserInput(message string, errs []string) error {
+	return &graphQLError{message: message, code: "BAD_USER_INPUT", errors: errs}
+}
+
+// graphQLInternalError logs the error and hides its details from the client.
+func graphQLInternalError(ctx context.Context, err error) error {
+	slog.ErrorContext(ctx, "unhandled graphql error", "err", err)
+	return errors.New("internal server error")
+}
+
+// handleGraphQL executes queries sent with GET and queries and mutations
+// sent with POST, against the schema in graphQLSchema.
+func handleGraphQL(store GenreStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schema, err := graphQLSchema()
+		if err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		var req graphQLRequest
+
+		if r.Method == http.MethodGet {
+			query := r.URL.Query()
+			req.Query = query.Get("query")
+			req.OperationName = query.Get("operationName")
+
+			if v := query.Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					handleBadRequest(w, "variables must be a JSON object", nil)
+					return
+				}
+			}
+		} else if err := readJSON(w, r, &req); err != nil {
+			handleBadRequest(w, err.Error(), nil)
+			return
+		}
+
+		if req.Query == "" {
+			handleBadRequest(w, "query must be provided", nil)
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{
+			Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+		})
+		if err != nil {
+			writeGraphQL(w, r, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		if validation := graphql.ValidateDocument(&schema, doc, nil); !validation.IsValid {
+			writeGraphQL(w, r, &graphql.Result{Errors: validation.Errors})
+			return
+		}
+
+		// mutations change state, GET requests must not
+		if r.Method == http.MethodGet {
+			if op := selectOperation(doc, req.OperationName); op != nil && op.Operation != ast.OperationTypeQuery {
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+					"status":  http.StatusMethodNotAllowed,
+					"message": "mutations must be sent with POST",
+				}, http.Header{"Allow": {http.MethodPost}})
+				return
+			}
+		}
+
+		if err := checkQueryLimits(doc, req.Variables); err != nil {
+			writeGraphQL(w, r, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       withGraphQLContext(r.Context(), newGraphQLContext(store)),
+		})
+
+		writeGraphQL(w, r, result)
+	}
+}
+
+func writeGraphQL(w http.ResponseWriter, r *http.Request, result *graphql.Result) {
+	err := writeJSON(w, http.StatusOK, result, nil)
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+}
+
+// selectOperation returns the operation a request executes, nil when the
+// document does not tell.
+func selectOperation(doc *ast.Document, operationName string) *ast.OperationDefinition {
+	var selected *ast.OperationDefinition
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if operationName == "" {
+			if selected != nil {
+				return nil
+			}
+			selected = op
+			continue
+		}
+
+		if op.Name != nil && op.Name.Value == operationName {
+			return op
+		}
+	}
+
+	return selected
+}
+
+// graphQLContext holds the store and the batch loaders of one request.
+type graphQLContext struct {
+	store        GenreStore
+	genresByID   *batchLoader[int, *datastore.Genre]
+	genresBySlug *batchLoader[string, *datastore.Genre]
+}
+
+func newGraphQLContext(store GenreStore) *graphQLContext {
+	return &graphQLContext{
+		store: store,
+		genresByID: newBatchLoader(func(ctx context.Context, IDs []int) (map[int]*datastore.Genre, error) {
+			genres, err := store.GetGenresByIDs(ctx, IDs)
+			if err != nil {
+				return nil, err
+			}
+
+			byID := make(map[int]*datastore.Genre, len(genres))
+			for _, g := range genres {
+				byID[g.ID] = g
+			}
+			return byID, nil
+		}),
+		genresBySlug: newBatchLoader(func(ctx context.Context, slugs []string) (map[string]*datastore.Genre, error) {
+			genres, err := store.GetGenresBySlugs(ctx, slugs)
+			if err != nil {
+				return nil, err
+			}
+
+			bySlug := make(map[string]*datastore.Genre, len(genres))
+			for _, g := range genres {
+				bySlug[g.Slug] = g
+			}
+			return bySlug, nil
+		}),
+	}
+}
+
+type graphQLContextKey struct{}
+
+func withGraphQLContext(ctx context.Context, gqlCtx *graphQLContext) context.Context {
+	return context.WithValue(ctx, graphQLContextKey{}, gqlCtx)
+}
+
+func graphQLContextFrom(ctx context.Context) *graphQLContext {
+	gqlCtx, _ := ctx.Value(graphQLContextKey{}).(*graphQLContext)
+	return gqlCtx
+}
+
+// batchLoader collects the keys requested while the executor resolves one
+// level of the query, and fetches them all with a single call once the
+// first of the values is needed. Results are cached for the request.
+type batchLoader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]batchResult[V]
+}
+
+type batchResult[V any] struct {
+	value V
+	err   error
+}
+
+func newBatchLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		fetch:   fetch,
+		results: map[K]batchResult[V]{},
+	}
+}
+
+// load queues the key and returns a thunk, the executor of graphql-go only
+// calls thunks after resolving the fields around them.
+func (l *batchLoader[K, V]) load(ctx context.Context, key K) func() (any, error) {
+	l.mu.Lock()
+	if _, ok := l.results[key]; !ok {
+		l.pending = append(l.pending, key)
+		// mark the key as queued so it is fetched once
+		l.results[key] = batchResult[V]{}
+	}
+	l.mu.Unlock()
+
+	return func() (any, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			keys := l.pending
+			l.pending = nil
+
+			values, err := l.fetch(ctx, keys)
+			for _, k := range keys {
+				l.results[k] = batchResult[V]{value: values[k], err: err}
+			}
+		}
+
+		result := l.results[key]
+		return result.value, result.err
+	}
+}
+
+var graphQLSchema = sync.OnceValues(buildGraphQLSchema)
+
+func buildGraphQLSchema() (graphql.Schema, error) {
+	genreType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Genre",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(*datastore.Genre).ID, nil
+				},
+			},
+			"slug": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(*datastore.Genre).Slug, nil
+				},
+			},
+			"name": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					name := p.Source.(*datastore.Genre).Name
+					if !name.Valid {
+						return nil, nil
+					}
+					return name.String, nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(*datastore.Genre).CreatedAt, nil
+				},
+			},
+		},
+	})
+
+	genreEdgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "GenreEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return encodeGenreCursor(p.Source.(*datastore.Genre).Slug), nil
+				},
+			},
+			"node": &graphql.Field{
+				Type: graphql.NewNonNull(genreType),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(*genreConnection).hasNextPage, nil
+				},
+			},
+			"endCursor": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					genres := p.Source.(*genreConnection).genres
+					if len(genres) == 0 {
+						return nil, nil
+					}
+					return encodeGenreCursor(genres[len(genres)-1].Slug), nil
+				},
+			},
+		},
+	})
+
+	genreConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "GenreConnection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(genreEdgeType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(*genreConnection).genres, nil
+				},
+			},
+			"nodes": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(genreType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(*genreConnection).genres, nil
+				},
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(pageInfoType),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	genreFilterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "GenreFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"search": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "Matches part of the slug or name, case insensitive",
+			},
+		},
+	})
+
+	genreInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "GenreInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"slug": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"name": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"genre": &graphql.Field{
+				Type:        genreType,
+				Description: "Looks up a genre by either its id or slug",
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.ID},
+					"slug": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveGenre,
+			},
+			"genres": &graphql.Field{
+				Type:        graphql.NewNonNull(genreConnectionType),
+				Description: "Pages through the genres ordered by slug",
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: genreFilterType},
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultGenrePageSize},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveGenres,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createGenre": &graphql.Field{
+				Type: graphql.NewNonNull(genreType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(genreInputType)},
+				},
+				Resolve: resolveCreateGenre,
+			},
+			"updateGenre": &graphql.Field{
+				Type: graphql.NewNonNull(genreType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(genreInputType)},
+				},
+				Resolve: resolveUpdateGenre,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+type genreConnection struct {
+	genres      []*datastore.Genre
+	hasNextPage bool
+}
+
+func resolveGenre(p graphql.ResolveParams) (any, error) {
+	gqlCtx := graphQLContextFrom(p.Context)
+
+	id, hasID := p.Args["id"].(string)
+	slug, hasSlug := p.Args["slug"].(string)
+
+	switch {
+	case hasID == hasSlug:
+		return nil, badUserInput("provide either id or slug", nil)
+	case hasID:
+		// ids that are not numbers match no genre, like on the REST endpoint
+		genreID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, nil
+		}
+		return gqlCtx.genresByID.load(p.Context, genreID), nil
+	default:
+		return gqlCtx.genresBySlug.load(p.Context, slug), nil
+	}
+}
+
+func resolveGenres(p graphql.ResolveParams) (any, error) {
+	gqlCtx := graphQLContextFrom(p.Context)
+
+	first, _ := p.Args["first"].(int)
+	if first < 1 || first > maxGenrePageSize {
+		return nil, badUserInput(fmt.Sprintf("first must be between 1 and %d", maxGenrePageSize), nil)
+	}
+
+	// one extra genre tells whether there is a next page
+	filter := datastore.GenreFilter{Limit: first + 1}
+
+	if f, ok := p.Args["filter"].(map[string]any); ok {
+		filter.Search, _ = f["search"].(string)
+	}
+
+	if after, ok := p.Args["after"].(string); ok {
+		slug, err := decodeGenreCursor(after)
+		if err != nil {
+			return nil, badUserInput("after is not a valid cursor", nil)
+		}
+		filter.AfterSlug = slug
+	}
+
+	genres, err := gqlCtx.store.ListGenresPage(p.Context, filter)
+	if err != nil {
+		return nil, graphQLInternalError(p.Context, err)
+	}
+
+	connection := &genreConnection{genres: genres}
+	if len(genres) > first {
+		connection.genres = genres[:first]
+		connection.hasNextPage = true
+	}
+
+	return connection, nil
+}
+
+func resolveCreateGenre(p graphql.ResolveParams) (any, error) {
+	gqlCtx := graphQLContextFrom(p.Context)
+
+	genre, err := genreFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gqlCtx.store.InsertGenre(p.Context, genre)
+	if err != nil {
+		if errors.Is(err, datastore.ErrGenreSlugExists) {
+			return nil, &graphQLError{message: "genre with this slug already exists", code: "CONFLICT"}
+		}
+		return nil, graphQLInternalError(p.Context, err)
+	}
+
+	return genre, nil
+}
+
+func resolveUpdateGenre(p graphql.ResolveParams) (any, error) {
+	gqlCtx := graphQLContextFrom(p.Context)
+
+	notFound := &graphQLError{message: "genre not found", code: "NOT_FOUND"}
+
+	id, err := strconv.Atoi(p.Args["id"].(string))
+	if err != nil {
+		return nil, notFound
+	}
+
+	genre, err := genreFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	genre.ID = id
+
+	err = gqlCtx.store.UpdateGenre(p.Context, genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, datastore.ErrGenreNotFound):
+			return nil, notFound
+		case errors.Is(err, datastore.ErrGenreSlugExists):
+			return nil, &graphQLError{message: "genre with this slug already exists", code: "CONFLICT"}
+		}
+		return nil, graphQLInternalError(p.Context, err)
+	}
+
+	return genre, nil
+}
+
+// genreFromArgs validates the input argument with the rules of the REST endpoint.
+func genreFromArgs(args map[string]any) (*datastore.Genre, error) {
+	var input genreInput
+
+	if fields, ok := args["input"].(map[string]any); ok {
+		input.Slug, _ = fields["slug"].(string)
+		input.Name, _ = fields["name"].(string)
+	}
+
+	v := validator.New()
+	input.validate(v)
+
+	if !v.IsValid() {
+		return nil, badUserInput("invalid input", v.GetErrors())
+	}
+
+	return input.genre(), nil
+}
+
+func encodeGenreCursor(slug string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(slug))
+}
+
+func decodeGenreCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// checkQueryLimits rejects operations nesting fields deeper than
+// maxGraphQLDepth or exceeding maxGraphQLComplexity, before any resolver runs.
+func checkQueryLimits(doc *ast.Document, variables map[string]any) error {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		defaults := map[string]ast.Value{}
+		for _, def := range op.VariableDefinitions {
+			if def.DefaultValue != nil {
+				defaults[def.Variable.Name.Value] = def.DefaultValue
+			}
+		}
+
+		a := &queryAnalysis{fragments: fragments, variables: variables, defaults: defaults}
+		complexity := a.selectionSet(op.SelectionSet, 1)
+
+		if a.depth > maxGraphQLDepth {
+			return queryTooComplex(fmt.Sprintf("query depth %d exceeds the limit of %d", a.depth, maxGraphQLDepth))
+		}
+		if complexity > maxGraphQLComplexity {
+			return queryTooComplex(fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, maxGraphQLComplexity))
+		}
+	}
+
+	return nil
+}
+
+func queryTooComplex(message string) error {
+	return gqlerrors.FormattedError{
+		Message:    message,
+		Extensions: map[string]any{"code": "QUERY_TOO_COMPLEX"},
+	}
+}
+
+type queryAnalysis struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	// defaults holds the default values of the variables of the operation
+	defaults map[string]ast.Value
+	depth    int
+}
+
+// selectionSet returns the complexity of the selections and tracks the
+// deepest field. Introspection fields are left out, the schema bounds them.
+func (a *queryAnalysis) selectionSet(set *ast.SelectionSet, depth int) int {
+	if set == nil {
+		return 0
+	}
+
+	complexity := 0
+
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+
+			a.depth = max(a.depth, depth)
+			complexity += 1 + a.multiplier(s)*a.selectionSet(s.SelectionSet, depth+1)
+		case *ast.InlineFragment:
+			complexity += a.selectionSet(s.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			// validation already rejected unknown and cyclic fragments
+			if fragment, ok := a.fragments[s.Name.Value]; ok {
+				complexity += a.selectionSet(fragment.SelectionSet, depth)
+			}
+		}
+	}
+
+	return complexity
+}
+
+// multiplier is the number of items a field taking a first argument returns
+// at most, the fields below it are resolved once for every item. Without a
+// page size the genres get the one the resolver defaults to.
+func (a *queryAnalysis) multiplier(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+
+		if n, ok := a.intValue(arg.Value); ok {
+			return max(n, 1)
+		}
+		break
+	}
+
+	if field.Name.Value == "genres" {
+		return defaultGenrePageSize
+	}
+
+	return 1
+}
+
+// intValue resolves an integer argument, variables left out of the request
+// take the default of their definition.
+func (a *queryAnalysis) intValue(value ast.Value) (int, bool) {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil
+	case *ast.Variable:
+		switch n := a.variables[v.Name.Value].(type) {
+		case float64:
+			return int(n), true
+		case int:
+			return n, true
+		case nil:
+			if def, ok := a.defaults[v.Name.Value]; ok {
+				return a.intValue(def)
+			}
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,634 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func postGraphQL(t *testing.T, store GenreStore, body string) (int, map[string]any) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, store)
+
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	var result map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to parse JSON response %q: %v", rec.Body, err)
+	}
+
+	return rec.Code, result
+}
+
+func graphQLBody(t *testing.T, query string, variables map[string]any) string {
+	t.Helper()
+
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestGraphQLGenre(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	genres := []*datastore.Genre{
+		{ID: 1, Slug: "action", Name: sql.NullString{String: "Action", Valid: true}, CreatedAt: createdAt},
+		{ID: 2, Slug: "drama", CreatedAt: createdAt},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected map[string]any
+	}{
+		{
+			name:  "looks up a genre by id",
+			query: `{ genre(id: 1) { id slug name createdAt } }`,
+			expected: map[string]any{
+				"data": map[string]any{
+					"genre": map[string]any{"id": "1", "slug": "action", "name": "Action", "createdAt": "2024-01-01T12:00:00Z"},
+				},
+			},
+		},
+		{
+			name:  "looks up a genre by slug",
+			query: `{ genre(slug: "drama") { id name } }`,
+			expected: map[string]any{
+				"data": map[string]any{
+					"genre": map[string]any{"id": "2", "name": nil},
+				},
+			},
+		},
+		{
+			name:  "returns null for an unknown genre",
+			query: `{ genre(id: 3) { id } }`,
+			expected: map[string]any{
+				"data": map[string]any{"genre": nil},
+			},
+		},
+		{
+			name:  "returns an error without id or slug",
+			query: `{ genre { id } }`,
+			expected: map[string]any{
+				"data": map[string]any{"genre": nil},
+				"errors": []any{
+					map[string]any{
+						"message":    "provide either id or slug",
+						"locations":  []any{map[string]any{"line": float64(1), "column": float64(3)}},
+						"path":       []any{"genre"},
+						"extensions": map[string]any{"code": "BAD_USER_INPUT"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockGenreStore{
+				byIDsFunc: func(ctx context.Context, IDs []int) ([]*datastore.Genre, error) {
+					var found []*datastore.Genre
+					for _, g := range genres {
+						for _, id := range IDs {
+							if g.ID == id {
+								found = append(found, g)
+							}
+						}
+					}
+					return found, nil
+				},
+				bySlugsFunc: func(ctx context.Context, slugs []string) ([]*datastore.Genre, error) {
+					var found []*datastore.Genre
+					for _, g := range genres {
+						for _, slug := range slugs {
+							if g.Slug == slug {
+								found = append(found, g)
+							}
+						}
+					}
+					return found, nil
+				},
+			}
+
+			status, result := postGraphQL(t, store, graphQLBody(t, tt.query, nil))
+
+			if status != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+			}
+
+			if diff := cmp.Diff(tt.expected, result); diff != "" {
+				t.Errorf("result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGraphQLBatchesGenreLookups(t *testing.T) {
+	var calls [][]int
+
+	store := &mockGenreStore{
+		byIDsFunc: func(ctx context.Context, IDs []int) ([]*datastore.Genre, error) {
+			calls = append(calls, IDs)
+
+			var found []*datastore.Genre
+			for _, id := range IDs {
+				found = append(found, &datastore.Genre{ID: id, Slug: "genre-" + strconv.Itoa(id)})
+			}
+			return found, nil
+		},
+	}
+
+	query := `{
+		a: genre(id: 1) { slug }
+		b: genre(id: 2) { slug }
+		c: genre(id: 1) { id }
+	}`
+
+	_, result := postGraphQL(t, store, graphQLBody(t, query, nil))
+
+	// the executor resolves the fields of a query in no particular order
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 store call, got %d: %v", len(calls), calls)
+	}
+
+	if diff := cmp.Diff([]int{1, 2}, calls[0], cmpopts.SortSlices(func(a, b int) bool { return a < b })); diff != "" {
+		t.Errorf("ids mismatch (-want +got):\n%s", diff)
+	}
+
+	expected := map[string]any{
+		"data": map[string]any{
+			"a": map[string]any{"slug": "genre-1"},
+			"b": map[string]any{"slug": "genre-2"},
+			"c": map[string]any{"id": "1"},
+		},
+	}
+	if diff := cmp.Diff(expected, result); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGraphQLGenres(t *testing.T) {
+	slugs := []string{"action", "comedy", "drama"}
+
+	tests := []struct {
+		name           string
+		query          string
+		variables      map[string]any
+		expectedFilter *datastore.GenreFilter
+		expected       map[string]any
+	}{
+		{
+			name:           "returns the first page with the default page size",
+			query:          `{ genres { nodes { slug } pageInfo { hasNextPage endCursor } } }`,
+			expectedFilter: &datastore.GenreFilter{Limit: defaultGenrePageSize + 1},
+			expected: map[string]any{
+				"data": map[string]any{
+					"genres": map[string]any{
+						"nodes": []any{
+							map[string]any{"slug": "action"},
+							map[string]any{"slug": "comedy"},
+							map[string]any{"slug": "drama"},
+						},
+						"pageInfo": map[string]any{"hasNextPage": false, "endCursor": encodeGenreCursor("drama")},
+					},
+				},
+			},
+		},
+		{
+			name:           "returns a next page when there are more genres",
+			query:          `query($first: Int) { genres(first: $first, filter: {search: "a"}) { edges { cursor node { slug } } pageInfo { hasNextPage } } }`,
+			variables:      map[string]any{"first": 2},
+			expectedFilter: &datastore.GenreFilter{Search: "a", Limit: 3},
+			expected: map[string]any{
+				"data": map[string]any{
+					"genres": map[string]any{
+						"edges": []any{
+							map[string]any{"cursor": encodeGenreCursor("action"), "node": map[string]any{"slug": "action"}},
+							map[string]any{"cursor": encodeGenreCursor("comedy"), "node": map[string]any{"slug": "comedy"}},
+						},
+						"pageInfo": map[string]any{"hasNextPage": true},
+					},
+				},
+			},
+		},
+		{
+			name:           "continues after the cursor",
+			query:          `{ genres(first: 2, after: "` + encodeGenreCursor("comedy") + `") { nodes { slug } pageInfo { hasNextPage } } }`,
+			expectedFilter: &datastore.GenreFilter{AfterSlug: "comedy", Limit: 3},
+			expected: map[string]any{
+				"data": map[string]any{
+					"genres": map[string]any{
+						"nodes":    []any{map[string]any{"slug": "drama"}},
+						"pageInfo": map[string]any{"hasNextPage": false},
+					},
+				},
+			},
+		},
+		{
+			name:  "returns an error for an invalid page size",
+			query: `{ genres(first: 0) { nodes { slug } } }`,
+			expected: map[string]any{
+				"data": nil,
+				"errors": []any{
+					map[string]any{
+						"message":    "first must be between 1 and 100",
+						"locations":  []any{map[string]any{"line": float64(1), "column": float64(3)}},
+						"path":       []any{"genres"},
+						"extensions": map[string]any{"code": "BAD_USER_INPUT"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filters []datastore.GenreFilter
+
+			_, result := postGraphQL(t, pagedGenreStore(slugs, &filters), graphQLBody(t, tt.query, tt.variables))
+
+			if tt.expectedFilter != nil {
+				if diff := cmp.Diff([]datastore.GenreFilter{*tt.expectedFilter}, filters); diff != "" {
+					t.Errorf("filter mismatch (-want +got):\n%s", diff)
+				}
+			}
+
+			if diff := cmp.Diff(tt.expected, result); diff != "" {
+				t.Errorf("result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         string
+		insertErr     error
+		updateErr     error
+		expectedGenre *datastore.Genre
+		expected      map[string]any
+	}{
+		{
+			name:          "creates a genre",
+			query:         `mutation { createGenre(input: {slug: "action", name: "Action"}) { id slug name } }`,
+			expectedGenre: &datastore.Genre{ID: 1, Slug: "action", Name: sql.NullString{String: "Action", Valid: true}, CreatedAt: createdAt},
+			expected: map[string]any{
+				"data": map[string]any{
+					"createGenre": map[string]any{"id": "1", "slug": "action", "name": "Action"},
+				},
+			},
+		},
+		{
+			name:  "rejects an invalid genre",
+			query: `mutation { createGenre(input: {slug: "Not a slug"}) { id } }`,
+			expected: map[string]any{
+				"data": nil,
+				"errors": []any{
+					map[string]any{
+						"message":   "invalid input",
+						"locations": []any{map[string]any{"line": float64(1), "column": float64(12)}},
+						"path":      []any{"createGenre"},
+						"extensions": map[string]any{
+							"code":   "BAD_USER_INPUT",
+							"errors": []any{"slug must contain only lowercase letters and hyphens"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:      "returns a conflict for a slug in use",
+			query:     `mutation { createGenre(input: {slug: "action"}) { id } }`,
+			insertErr: datastore.ErrGenreSlugExists,
+			expected: map[string]any{
+				"data": nil,
+				"errors": []any{
+					map[string]any{
+						"message":    "genre with this slug already exists",
+						"locations":  []any{map[string]any{"line": float64(1), "column": float64(12)}},
+						"path":       []any{"createGenre"},
+						"extensions": map[string]any{"code": "CONFLICT"},
+					},
+				},
+			},
+		},
+		{
+			name:          "updates a genre",
+			query:         `mutation { updateGenre(id: 2, input: {slug: "drama"}) { id slug name } }`,
+			expectedGenre: &datastore.Genre{ID: 2, Slug: "drama", CreatedAt: createdAt},
+			expected: map[string]any{
+				"data": map[string]any{
+					"updateGenre": map[string]any{"id": "2", "slug": "drama", "name": nil},
+				},
+			},
+		},
+		{
+			name:      "returns not found for an unknown genre",
+			query:     `mutation { updateGenre(id: 3, input: {slug: "drama"}) { id } }`,
+			updateErr: datastore.ErrGenreNotFound,
+			expected: map[string]any{
+				"data": nil,
+				"errors": []any{
+					map[string]any{
+						"message":    "genre not found",
+						"locations":  []any{map[string]any{"line": float64(1), "column": float64(12)}},
+						"path":       []any{"updateGenre"},
+						"extensions": map[string]any{"code": "NOT_FOUND"},
+					},
+				},
+			},
+		},
+		{
+			name:      "hides internal errors",
+			query:     `mutation { updateGenre(id: 3, input: {slug: "drama"}) { id } }`,
+			updateErr: errors.New("connection refused"),
+			expected: map[string]any{
+				"data": nil,
+				"errors": []any{
+					map[string]any{
+						"message":   "internal server error",
+						"locations": []any{map[string]any{"line": float64(1), "column": float64(12)}},
+						"path":      []any{"updateGenre"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLogs(t)
+
+			var got *datastore.Genre
+
+			store := &mockGenreStore{
+				insertGenreFunc: func(ctx context.Context, genre *datastore.Genre) error {
+					if tt.insertErr != nil {
+						return tt.insertErr
+					}
+					genre.ID = 1
+					genre.CreatedAt = createdAt
+					got = genre
+					return nil
+				},
+				updateGenreFunc: func(ctx context.Context, genre *datastore.Genre) error {
+					if tt.updateErr != nil {
+						return tt.updateErr
+					}
+					genre.CreatedAt = createdAt
+					got = genre
+					return nil
+				},
+			}
+
+			_, result := postGraphQL(t, store, graphQLBody(t, tt.query, nil))
+
+			if diff := cmp.Diff(tt.expectedGenre, got); diff != "" {
+				t.Errorf("genre mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.expected, result); diff != "" {
+				t.Errorf("result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		expected  string
+	}{
+		{
+			name:  "accepts queries within the limits",
+			query: `{ genres { edges { node { slug } } pageInfo { ...a } } } fragment a on PageInfo { hasNextPage ... on PageInfo { endCursor } }`,
+		},
+		{
+			name:     "rejects too complex queries",
+			query:    `{ genres(first: 100) { edges { cursor node { id slug name createdAt } } nodes { id slug name createdAt } } }`,
+			expected: "query complexity 1201 exceeds the limit of 1000",
+		},
+		{
+			name:      "counts the page size of variables",
+			query:     `query($first: Int) { a: genres(first: $first) { nodes { id slug name createdAt } } b: genres(first: $first) { nodes { id slug name createdAt } } }`,
+			variables: map[string]any{"first": 100},
+			expected:  "query complexity 1002 exceeds the limit of 1000",
+		},
+		{
+			name:     "counts the default of variables left out",
+			query:    `query($first: Int = 100) { a: genres(first: $first) { nodes { id slug name createdAt } } b: genres(first: $first) { nodes { id slug name createdAt } } }`,
+			expected: "query complexity 1002 exceeds the limit of 1000",
+		},
+		{
+			name: "counts the default page size for variables left out without a default",
+			query: `query($first: Int) {
+				a: genres(first: $first) { ...page } b: genres(first: $first) { ...page } c: genres(first: $first) { ...page }
+				d: genres(first: $first) { ...page } e: genres(first: $first) { ...page } f: genres(first: $first) { ...page }
+				g: genres(first: $first) { ...page } h: genres(first: $first) { ...page } i: genres(first: $first) { ...page }
+				j: genres(first: $first) { ...page }
+			} fragment page on GenreConnection { nodes { id slug name createdAt } }`,
+			expected: "query complexity 1010 exceeds the limit of 1000",
+		},
+		{
+			name:     "counts the fields of fragments",
+			query:    `{ a: genres(first: 100) { ...page } b: genres(first: 100) { ...page } } fragment page on GenreConnection { nodes { id slug name createdAt } }`,
+			expected: "query complexity 1002 exceeds the limit of 1000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := postGraphQL(t, &mockGenreStore{}, graphQLBody(t, tt.query, tt.variables))
+
+			errs, _ := result["errors"].([]any)
+			if tt.expected == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+
+			if len(errs) != 1 {
+				t.Fatalf("expected 1 error, got %v", result)
+			}
+
+			expected := map[string]any{
+				"message":    tt.expected,
+				"locations":  nil,
+				"extensions": map[string]any{"code": "QUERY_TOO_COMPLEX"},
+			}
+			if diff := cmp.Diff(expected, errs[0]); diff != "" {
+				t.Errorf("error mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckQueryLimits(t *testing.T) {
+	// the genre schema is too shallow to exceed the depth limit, so the
+	// documents are checked without validating them against it
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:  "accepts the deepest query allowed",
+			query: `{ a { b { c { d { e { f { g { h } } } } } } } }`,
+		},
+		{
+			name:     "rejects queries nested too deep",
+			query:    `{ a { b { c { d { e { f { g { h { i } } } } } } } } }`,
+			expected: "query depth 9 exceeds the limit of 8",
+		},
+		{
+			name:     "follows fragments",
+			query:    `{ a { b { c { d { ...e } } } } } fragment e on E { e { ... on F { f { g { h { i } } } } } }`,
+			expected: "query depth 9 exceeds the limit of 8",
+		},
+		{
+			name:  "ignores introspection",
+			query: `{ __schema { types { fields { type { ofType { ofType { ofType { ofType { name } } } } } } } } }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = checkQueryLimits(doc, nil)
+
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.expected {
+				t.Errorf("expected error %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGraphQLHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedBody   map[string]any
+	}{
+		{
+			name:           "executes queries sent with GET",
+			method:         "GET",
+			target:         "/graphql?query=" + url.QueryEscape(`query($id: ID) { genre(id: $id) { id } }`) + "&variables=" + url.QueryEscape(`{"id":"1"}`),
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]any{"data": map[string]any{"genre": nil}},
+		},
+		{
+			name:           "refuses mutations sent with GET",
+			method:         "GET",
+			target:         "/graphql?query=" + url.QueryEscape(`mutation { createGenre(input: {slug: "action"}) { id } }`),
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody: map[string]any{
+				"status":  float64(http.StatusMethodNotAllowed),
+				"message": "mutations must be sent with POST",
+			},
+		},
+		{
+			name:           "returns status 400 without a query",
+			method:         "POST",
+			target:         "/graphql",
+			body:           `{"variables": {}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]any{
+				"status":  float64(http.StatusBadRequest),
+				"message": "query must be provided",
+			},
+		},
+		{
+			name:           "reports syntax errors",
+			method:         "POST",
+			target:         "/graphql",
+			body:           `{"query": "{ genre("}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]any{
+				"data": nil,
+				"errors": []any{
+					map[string]any{
+						"message":   "Syntax Error GraphQL request (1:9) Expected Name, found EOF\n\n1: { genre(\n           ^\n",
+						"locations": []any{map[string]any{"line": float64(1), "column": float64(9)}},
+					},
+				},
+			},
+		},
+		{
+			name:           "reports validation errors",
+			method:         "POST",
+			target:         "/graphql",
+			body:           `{"query": "{ genre(id: 1) { title } }"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]any{
+				"data": nil,
+				"errors": []any{
+					map[string]any{
+						"message":   `Cannot query field "title" on type "Genre".`,
+						"locations": []any{map[string]any{"line": float64(1), "column": float64(18)}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			registerRoutes(mux, &mockGenreStore{})
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body)
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.expectedBody, body); diff != "" {
+				t.Errorf("body mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
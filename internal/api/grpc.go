@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/validator"
+	movielandv1 "github.com/tommarien/movie-land/proto/movieland/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer serves the gRPC API with the standard health service and
+// reflection, so tools like grpcurl can discover the services. The calls pass
+// the interceptors, see grpcInterceptors.
+type grpcServer struct {
+	server *grpc.Server
+	health *grpchealth.Server
+}
+
+func newGRPCServer(store GenreStore, interceptors []grpcInterceptor, opts ...grpc.ServerOption) *grpcServer {
+	server := grpc.NewServer(append(grpcInterceptors(interceptors...), opts...)...)
+
+	movielandv1.RegisterGenreServiceServer(server, &genreService{store: store})
+
+	health := grpchealth.NewServer()
+	health.SetServingStatus(movielandv1.GenreService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, health)
+
+	reflection.Register(server)
+
+	return &grpcServer{server: server, health: health}
+}
+
+func (s *grpcServer) serve(lis net.Listener) error {
+	return s.server.Serve(lis)
+}
+
+// drain reports all services as not serving, while still serving them.
+func (s *grpcServer) drain() {
+	s.health.Shutdown()
+}
+
+// shutdown waits for the running calls to complete, and cancels them when
+// the context is done first.
+func (s *grpcServer) shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// genreService implements the GenreService of the gRPC API.
+type genreService struct {
+	movielandv1.UnimplementedGenreServiceServer
+	store GenreStore
+}
+
+func (s *genreService) GetGenre(ctx context.Context, req *movielandv1.GetGenreRequest) (*movielandv1.GetGenreResponse, error) {
+	genre, err := s.store.GetGenre(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, genreStatus(ctx, err)
+	}
+
+	return &movielandv1.GetGenreResponse{Genre: mapGenreMessage(genre)}, nil
+}
+
+func (s *genreService) ListGenres(ctx context.Context, req *movielandv1.ListGenresRequest) (*movielandv1.ListGenresResponse, error) {
+	pageSize := int(req.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultGenrePageSize
+	}
+	if pageSize < 0 || pageSize > maxGenrePageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d", maxGenrePageSize)
+	}
+
+	// one extra genre tells whether there is a next page
+	filter := datastore.GenreFilter{Search: req.GetSearch(), Limit: pageSize + 1}
+
+	if token := req.GetPageToken(); token != "" {
+		slug, err := decodeGenreCursor(token)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "page_token is invalid")
+		}
+		filter.AfterSlug = slug
+	}
+
+	genres, err := s.store.ListGenresPage(ctx, filter)
+	if err != nil {
+		return nil, genreStatus(ctx, err)
+	}
+
+	res := &movielandv1.ListGenresResponse{}
+
+	if len(genres) > pageSize {
+		genres = genres[:pageSize]
+		res.NextPageToken = encodeGenreCursor(genres[pageSize-1].Slug)
+	}
+
+	res.Genres = make([]*movielandv1.Genre, 0, len(genres))
+	for _, g := range genres {
+		res.Genres = append(res.Genres, mapGenreMessage(g))
+	}
+
+	return res, nil
+}
+
+// StreamGenres reads the genres a page at a time, so no more than a page is
+// held in memory however many genres there are.
+func (s *genreService) StreamGenres(req *movielandv1.StreamGenresRequest, stream grpc.ServerStreamingServer[movielandv1.StreamGenresResponse]) error {
+	ctx := stream.Context()
+
+	filter := datastore.GenreFilter{Search: req.GetSearch(), Limit: maxGenrePageSize}
+
+	for {
+		genres, err := s.store.ListGenresPage(ctx, filter)
+		if err != nil {
+			return genreStatus(ctx, err)
+		}
+
+		for _, g := range genres {
+			if err := stream.Send(&movielandv1.StreamGenresResponse{Genre: mapGenreMessage(g)}); err != nil {
+				return err
+			}
+		}
+
+		if len(genres) < filter.Limit {
+			return nil
+		}
+		filter.AfterSlug = genres[len(genres)-1].Slug
+	}
+}
+
+func (s *genreService) CreateGenre(ctx context.Context, req *movielandv1.CreateGenreRequest) (*movielandv1.CreateGenreResponse, error) {
+	input := genreInput{Slug: req.GetSlug(), Name: req.GetName()}
+
+	if err := validateGenreMessage(&input); err != nil {
+		return nil, err
+	}
+
+	genre := input.genre()
+
+	err := s.store.InsertGenre(ctx, genre)
+	if err != nil {
+		return nil, genreStatus(ctx, err)
+	}
+
+	return &movielandv1.CreateGenreResponse{Genre: mapGenreMessage(genre)}, nil
+}
+
+func (s *genreService) UpdateGenre(ctx context.Context, req *movielandv1.UpdateGenreRequest) (*movielandv1.UpdateGenreResponse, error) {
+	input := genreInput{Slug: req.GetSlug(), Name: req.GetName()}
+
+	if err := validateGenreMessage(&input); err != nil {
+		return nil, err
+	}
+
+	genre := input.genre()
+	genre.ID = int(req.GetId())
+
+	err := s.store.UpdateGenre(ctx, genre)
+	if err != nil {
+		return nil, genreStatus(ctx, err)
+	}
+
+	return &movielandv1.UpdateGenreResponse{Genre: mapGenreMessage(genre)}, nil
+}
+
+// validateGenreMessage applies the rules of the REST endpoint.
+func validateGenreMessage(input *genreInput) error {
+	v := validator.New()
+	input.validate(v)
+
+	if !v.IsValid() {
+		return status.Error(codes.InvalidArgument, "invalid genre: "+strings.Join(v.GetErrors(), ", "))
+	}
+
+	return nil
+}
+
+// genreStatus maps the errors of the store onto gRPC status codes, errors the
+// client can do nothing about are logged and hidden.
+func genreStatus(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, datastore.ErrGenreNotFound):
+		return status.Error(codes.NotFound, "genre not found")
+	case errors.Is(err, datastore.ErrGenreSlugExists):
+		return status.Error(codes.AlreadyExists, "genre with this slug already exists")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+
+	slog.ErrorContext(ctx, "unhandled grpc error", "err", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func mapGenreMessage(genre *datastore.Genre) *movielandv1.Genre {
+	return &movielandv1.Genre{
+		Id:         int64(genre.ID),
+		Slug:       genre.Slug,
+		Name:       genre.Name.String,
+		CreateTime: timestamppb.New(genre.CreatedAt),
+	}
+}
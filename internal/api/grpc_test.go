@@ -0,0 +1,456 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/tommarien/movie-land/internal/datastore"
+	movielandv1 "github.com/tommarien/movie-land/proto/movieland/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// dialGRPC serves the gRPC API in process and returns a client connection to it.
+func dialGRPC(t *testing.T, store GenreStore) (*grpcServer, *grpc.ClientConn) {
+	t.Helper()
+
+	return dialGRPCWith(t, store, nil)
+}
+
+// dialGRPCWith is dialGRPC with interceptors and server options.
+func dialGRPCWith(t *testing.T, store GenreStore, interceptors []grpcInterceptor, opts ...grpc.ServerOption) (*grpcServer, *grpc.ClientConn) {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := newGRPCServer(store, interceptors, opts...)
+
+	go server.serve(lis)
+	t.Cleanup(server.server.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return server, conn
+}
+
+func TestGRPCGetGenre(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		err          error
+		expectedCode codes.Code
+		expected     *movielandv1.GetGenreResponse
+	}{
+		{
+			name:         "returns the genre",
+			expectedCode: codes.OK,
+			expected: &movielandv1.GetGenreResponse{
+				Genre: &movielandv1.Genre{Id: 1, Slug: "action", Name: "Action", CreateTime: timestamppb.New(createdAt)},
+			},
+		},
+		{
+			name:         "returns not found for an unknown genre",
+			err:          datastore.ErrGenreNotFound,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "hides internal errors",
+			err:          errors.New("connection refused"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLogs(t)
+
+			var gotID int
+			store := &mockGenreStore{
+				getGenreFunc: func(ctx context.Context, ID int) (*datastore.Genre, error) {
+					gotID = ID
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &datastore.Genre{ID: ID, Slug: "action", Name: sql.NullString{String: "Action", Valid: true}, CreatedAt: createdAt}, nil
+				},
+			}
+
+			_, conn := dialGRPC(t, store)
+			client := movielandv1.NewGenreServiceClient(conn)
+
+			res, err := client.GetGenre(t.Context(), &movielandv1.GetGenreRequest{Id: 1})
+
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s: %v", tt.expectedCode, code, err)
+			}
+
+			if gotID != 1 {
+				t.Errorf("expected id 1, got %d", gotID)
+			}
+
+			if diff := cmp.Diff(tt.expected, res, protocmp.Transform()); diff != "" {
+				t.Errorf("response mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// pagedGenreStore pages through the slugs like the store does.
+func pagedGenreStore(slugs []string, filters *[]datastore.GenreFilter) *mockGenreStore {
+	return &mockGenreStore{
+		listPageFunc: func(ctx context.Context, filter datastore.GenreFilter) ([]*datastore.Genre, error) {
+			*filters = append(*filters, filter)
+
+			var genres []*datastore.Genre
+			for i, slug := range slugs {
+				if slug <= filter.AfterSlug || len(genres) == filter.Limit {
+					continue
+				}
+				genres = append(genres, &datastore.Genre{ID: i + 1, Slug: slug})
+			}
+			return genres, nil
+		},
+	}
+}
+
+func TestGRPCListGenres(t *testing.T) {
+	slugs := []string{"action", "comedy", "drama"}
+
+	tests := []struct {
+		name           string
+		req            *movielandv1.ListGenresRequest
+		expectedCode   codes.Code
+		expectedFilter *datastore.GenreFilter
+		expectedSlugs  []string
+		expectedToken  string
+	}{
+		{
+			name:           "returns the first page with the default page size",
+			req:            &movielandv1.ListGenresRequest{Search: "a"},
+			expectedCode:   codes.OK,
+			expectedFilter: &datastore.GenreFilter{Search: "a", Limit: defaultGenrePageSize + 1},
+			expectedSlugs:  []string{"action", "comedy", "drama"},
+		},
+		{
+			name:           "returns a next page token when there are more genres",
+			req:            &movielandv1.ListGenresRequest{PageSize: 2},
+			expectedCode:   codes.OK,
+			expectedFilter: &datastore.GenreFilter{Limit: 3},
+			expectedSlugs:  []string{"action", "comedy"},
+			expectedToken:  encodeGenreCursor("comedy"),
+		},
+		{
+			name:           "continues after the page token",
+			req:            &movielandv1.ListGenresRequest{PageSize: 2, PageToken: encodeGenreCursor("comedy")},
+			expectedCode:   codes.OK,
+			expectedFilter: &datastore.GenreFilter{AfterSlug: "comedy", Limit: 3},
+			expectedSlugs:  []string{"drama"},
+		},
+		{
+			name:         "rejects a page size over the maximum",
+			req:          &movielandv1.ListGenresRequest{PageSize: maxGenrePageSize + 1},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "rejects an invalid page token",
+			req:          &movielandv1.ListGenresRequest{PageToken: "!"},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filters []datastore.GenreFilter
+
+			_, conn := dialGRPC(t, pagedGenreStore(slugs, &filters))
+			client := movielandv1.NewGenreServiceClient(conn)
+
+			res, err := client.ListGenres(t.Context(), tt.req)
+
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s: %v", tt.expectedCode, code, err)
+			}
+
+			if tt.expectedFilter != nil {
+				if diff := cmp.Diff([]datastore.GenreFilter{*tt.expectedFilter}, filters); diff != "" {
+					t.Errorf("filter mismatch (-want +got):\n%s", diff)
+				}
+			}
+
+			var gotSlugs []string
+			for _, g := range res.GetGenres() {
+				gotSlugs = append(gotSlugs, g.GetSlug())
+			}
+			if diff := cmp.Diff(tt.expectedSlugs, gotSlugs); diff != "" {
+				t.Errorf("slugs mismatch (-want +got):\n%s", diff)
+			}
+
+			if token := res.GetNextPageToken(); token != tt.expectedToken {
+				t.Errorf("expected next page token %q, got %q", tt.expectedToken, token)
+			}
+		})
+	}
+}
+
+func TestGRPCStreamGenres(t *testing.T) {
+	// more than a page, so the stream has to continue after the first one
+	var slugs []string
+	for i := range maxGenrePageSize + 5 {
+		slugs = append(slugs, fmt.Sprintf("genre-%03d", i))
+	}
+
+	var filters []datastore.GenreFilter
+
+	_, conn := dialGRPC(t, pagedGenreStore(slugs, &filters))
+	client := movielandv1.NewGenreServiceClient(conn)
+
+	stream, err := client.StreamGenres(t.Context(), &movielandv1.StreamGenresRequest{Search: "genre"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, res.GetGenre().GetSlug())
+	}
+
+	if diff := cmp.Diff(slugs, got); diff != "" {
+		t.Errorf("slugs mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedFilters := []datastore.GenreFilter{
+		{Search: "genre", Limit: maxGenrePageSize},
+		{Search: "genre", AfterSlug: slugs[maxGenrePageSize-1], Limit: maxGenrePageSize},
+	}
+	if diff := cmp.Diff(expectedFilters, filters); diff != "" {
+		t.Errorf("filters mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGRPCCreateGenre(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		req             *movielandv1.CreateGenreRequest
+		err             error
+		expectedCode    codes.Code
+		expectedMessage string
+		expected        *movielandv1.CreateGenreResponse
+	}{
+		{
+			name:         "creates a genre",
+			req:          &movielandv1.CreateGenreRequest{Slug: "action", Name: "Action"},
+			expectedCode: codes.OK,
+			expected: &movielandv1.CreateGenreResponse{
+				Genre: &movielandv1.Genre{Id: 1, Slug: "action", Name: "Action", CreateTime: timestamppb.New(createdAt)},
+			},
+		},
+		{
+			name:            "rejects an invalid genre",
+			req:             &movielandv1.CreateGenreRequest{Slug: "Not a slug"},
+			expectedCode:    codes.InvalidArgument,
+			expectedMessage: "invalid genre: slug must contain only lowercase letters and hyphens",
+		},
+		{
+			name:            "returns already exists for a slug in use",
+			req:             &movielandv1.CreateGenreRequest{Slug: "action"},
+			err:             datastore.ErrGenreSlugExists,
+			expectedCode:    codes.AlreadyExists,
+			expectedMessage: "genre with this slug already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockGenreStore{
+				insertGenreFunc: func(ctx context.Context, genre *datastore.Genre) error {
+					if tt.err != nil {
+						return tt.err
+					}
+					genre.ID = 1
+					genre.CreatedAt = createdAt
+					return nil
+				},
+			}
+
+			_, conn := dialGRPC(t, store)
+			client := movielandv1.NewGenreServiceClient(conn)
+
+			res, err := client.CreateGenre(t.Context(), tt.req)
+
+			st := status.Convert(err)
+			if st.Code() != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s: %v", tt.expectedCode, st.Code(), err)
+			}
+			if tt.expectedMessage != "" && st.Message() != tt.expectedMessage {
+				t.Errorf("expected message %q, got %q", tt.expectedMessage, st.Message())
+			}
+
+			if diff := cmp.Diff(tt.expected, res, protocmp.Transform()); diff != "" {
+				t.Errorf("response mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGRPCUpdateGenre(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		err           error
+		expectedCode  codes.Code
+		expectedGenre *datastore.Genre
+		expected      *movielandv1.UpdateGenreResponse
+	}{
+		{
+			name:          "updates the genre",
+			expectedCode:  codes.OK,
+			expectedGenre: &datastore.Genre{ID: 2, Slug: "drama", CreatedAt: createdAt},
+			expected: &movielandv1.UpdateGenreResponse{
+				Genre: &movielandv1.Genre{Id: 2, Slug: "drama", CreateTime: timestamppb.New(createdAt)},
+			},
+		},
+		{
+			name:         "returns not found for an unknown genre",
+			err:          datastore.ErrGenreNotFound,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "returns already exists for a slug in use",
+			err:          datastore.ErrGenreSlugExists,
+			expectedCode: codes.AlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *datastore.Genre
+
+			store := &mockGenreStore{
+				updateGenreFunc: func(ctx context.Context, genre *datastore.Genre) error {
+					if tt.err != nil {
+						return tt.err
+					}
+					genre.CreatedAt = createdAt
+					got = genre
+					return nil
+				},
+			}
+
+			_, conn := dialGRPC(t, store)
+			client := movielandv1.NewGenreServiceClient(conn)
+
+			res, err := client.UpdateGenre(t.Context(), &movielandv1.UpdateGenreRequest{Id: 2, Slug: "drama"})
+
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s: %v", tt.expectedCode, code, err)
+			}
+
+			if diff := cmp.Diff(tt.expectedGenre, got); diff != "" {
+				t.Errorf("genre mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.expected, res, protocmp.Transform()); diff != "" {
+				t.Errorf("response mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	server, conn := dialGRPC(t, &mockGenreStore{})
+	client := healthpb.NewHealthClient(conn)
+
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+
+		res, err := client.Check(t.Context(), &healthpb.HealthCheckRequest{
+			Service: movielandv1.GenreService_ServiceDesc.ServiceName,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.GetStatus()
+	}
+
+	if got := check(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected status SERVING, got %s", got)
+	}
+
+	server.drain()
+
+	if got := check(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected status NOT_SERVING while draining, got %s", got)
+	}
+}
+
+func TestGRPCReflection(t *testing.T) {
+	_, conn := dialGRPC(t, &mockGenreStore{})
+	client := reflectionpb.NewServerReflectionClient(conn)
+
+	stream, err := client.ServerReflectionInfo(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var services []string
+	for _, s := range res.GetListServicesResponse().GetService() {
+		services = append(services, s.GetName())
+	}
+
+	expected := []string{
+		"grpc.health.v1.Health",
+		"grpc.reflection.v1.ServerReflection",
+		"grpc.reflection.v1alpha.ServerReflection",
+		"movieland.v1.GenreService",
+	}
+	if diff := cmp.Diff(expected, services, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("services mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcInterceptor is the gRPC counterpart of a middleware, it prepares the
+// context of a call before the handler runs or rejects the call with a status.
+type grpcInterceptor func(ctx context.Context, method string) (context.Context, error)
+
+// grpcInterceptors applies the same protections to the calls of the gRPC API
+// as the middlewares do to the requests of the REST API, the first
+// interceptor runs outermost. Panics of the handlers are recovered within
+// them, so they are logged with what the interceptors added.
+func grpcInterceptors(interceptors ...grpcInterceptor) []grpc.ServerOption {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+
+	for _, ic := range interceptors {
+		unary = append(unary, ic.unary)
+		stream = append(stream, ic.stream)
+	}
+
+	unary = append(unary, recoverUnaryPanics)
+	stream = append(stream, recoverStreamPanics)
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+func (ic grpcInterceptor) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := ic(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (ic grpcInterceptor) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := ic(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextServerStream hands the handler of a stream the prepared context.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// recoverUnaryPanics turns panics of handlers into a logged Internal status,
+// instead of grpc-go crashing the process.
+func recoverUnaryPanics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = grpcPanicStatus(ctx, info.FullMethod, p)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+func recoverStreamPanics(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = grpcPanicStatus(ss.Context(), info.FullMethod, p)
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+func grpcPanicStatus(ctx context.Context, method string, p any) error {
+	slog.ErrorContext(
+		ctx,
+		"panic while serving grpc call",
+		"method", method,
+		"err", fmt.Sprint(p),
+		"stack", string(debug.Stack()),
+	)
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// grpcRequestIDs accepts the x-request-id metadata of the client, or
+// generates one, and echoes it in the response header like requestIDs.
+func grpcRequestIDs(ctx context.Context, method string) (context.Context, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !validRequestID(id) {
+		id = rand.Text()
+	}
+
+	// fails only when the transport is gone, nobody reads the header then
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+
+	ctx = context.WithValue(ctx, requestIDContextKey{}, id)
+	ctx = logging.WithAttrs(ctx, slog.String("request_id", id), slog.String("grpc_method", method))
+	return ctx, nil
+}
+
+// grpcAuditInfo attaches the request id and peer address to the context, so
+// the store can record them with the mutations. Calls have no session, so no
+// actor. It expects to run after grpcRequestIDs.
+func grpcAuditInfo(ctx context.Context, method string) (context.Context, error) {
+	return datastore.WithAuditInfo(ctx, datastore.AuditInfo{
+		RequestID: requestIDFromContext(ctx),
+		IPAddress: grpcPeerIP(ctx),
+	}), nil
+}
+
+// grpcPeerIP returns the IP address the call came from, the gRPC port is not
+// expected to be behind the proxies of TRUSTED_PROXIES.
+func grpcPeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
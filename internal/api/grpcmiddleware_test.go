@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/ratelimit"
+	movielandv1 "github.com/tommarien/movie-land/proto/movieland/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// verifiedCredentials pretends the TLS handshake verified the certificate of
+// the client, the connection itself stays plaintext.
+type verifiedCredentials struct {
+	credentials.TransportCredentials
+	cert *x509.Certificate
+}
+
+func (c verifiedCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, credentials.TLSInfo{
+		State:          tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{c.cert}}},
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+func TestGRPCRecoverPanics(t *testing.T) {
+	logs := captureLogs(t)
+
+	store := &mockGenreStore{
+		getGenreFunc: func(ctx context.Context, id int) (*datastore.Genre, error) {
+			panic("boom")
+		},
+		listPageFunc: func(ctx context.Context, filter datastore.GenreFilter) ([]*datastore.Genre, error) {
+			panic("boom")
+		},
+	}
+
+	_, conn := dialGRPCWith(t, store, []grpcInterceptor{grpcRequestIDs})
+	client := movielandv1.NewGenreServiceClient(conn)
+
+	_, err := client.GetGenre(t.Context(), &movielandv1.GetGenreRequest{Id: 1})
+	if code := status.Code(err); code != codes.Internal {
+		t.Errorf("expected code %s for a unary call, got %s: %v", codes.Internal, code, err)
+	}
+
+	stream, err := client.StreamGenres(t.Context(), &movielandv1.StreamGenresRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); status.Code(err) != codes.Internal {
+		t.Errorf("expected code %s for a stream, got %s: %v", codes.Internal, status.Code(err), err)
+	}
+
+	records := decodeLogs(t, logs)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 log records, got %d", len(records))
+	}
+
+	for _, record := range records {
+		if record["request_id"] == nil || record["stack"] == nil {
+			t.Errorf("expected the panic to be logged with the request id and stack, got %v", record)
+		}
+	}
+}
+
+func TestGRPCRequestIDs(t *testing.T) {
+	var info datastore.AuditInfo
+	store := &mockGenreStore{
+		insertGenreFunc: func(ctx context.Context, genre *datastore.Genre) error {
+			info = datastore.AuditInfoFromContext(ctx)
+			return nil
+		},
+	}
+
+	_, conn := dialGRPCWith(t, store, []grpcInterceptor{grpcRequestIDs, grpcAuditInfo})
+	client := movielandv1.NewGenreServiceClient(conn)
+
+	t.Run("echoes the request id of the client and records it", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(t.Context(), "x-request-id", "abc-123")
+
+		var header metadata.MD
+		if _, err := client.CreateGenre(ctx, &movielandv1.CreateGenreRequest{Slug: "action"}, grpc.Header(&header)); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff([]string{"abc-123"}, header.Get("x-request-id")); diff != "" {
+			t.Errorf("header mismatch (-want +got):\n%s", diff)
+		}
+
+		if info.RequestID != "abc-123" || info.IPAddress == "" {
+			t.Errorf("expected the request id and peer address in the audit info, got %+v", info)
+		}
+	})
+
+	t.Run("generates a request id when the client sends none", func(t *testing.T) {
+		var header metadata.MD
+		if _, err := client.CreateGenre(t.Context(), &movielandv1.CreateGenreRequest{Slug: "action"}, grpc.Header(&header)); err != nil {
+			t.Fatal(err)
+		}
+
+		ids := header.Get("x-request-id")
+		if len(ids) != 1 || ids[0] == "" || ids[0] != info.RequestID {
+			t.Errorf("expected a generated request id matching the audit info %q, got %v", info.RequestID, ids)
+		}
+	})
+}
+
+func TestGRPCClientIdentities(t *testing.T) {
+	ids := clientIdentities{"ingest.internal": "ingest"}
+
+	var identity string
+	store := &mockGenreStore{
+		getGenreFunc: func(ctx context.Context, id int) (*datastore.Genre, error) {
+			identity = clientIdentityFromContext(ctx)
+			return &datastore.Genre{ID: id, Slug: "action"}, nil
+		},
+	}
+
+	_, conn := dialGRPCWith(t, store, []grpcInterceptor{ids.grpcInterceptor}, grpc.Creds(verifiedCredentials{
+		TransportCredentials: insecure.NewCredentials(),
+		cert:                 &x509.Certificate{DNSNames: []string{"ingest.internal"}},
+	}))
+
+	if _, err := movielandv1.NewGenreServiceClient(conn).GetGenre(t.Context(), &movielandv1.GetGenreRequest{Id: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if identity != "ingest" {
+		t.Errorf("expected identity %q, got %q", "ingest", identity)
+	}
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	rt := config.NewRuntime(&config.Config{RateLimit: config.RateLimitConfig{
+		Enabled:       true,
+		ReadRequests:  1,
+		ReadPeriod:    time.Minute,
+		WriteRequests: 1,
+		WritePeriod:   time.Minute,
+		APIKeyHeader:  "X-API-Key",
+		APIKeys:       []string{"key-1"},
+	}}, nil)
+	rl := newRateLimiter(rt, ratelimit.NewMemoryLimiter(), nil)
+
+	store := &mockGenreStore{
+		getGenreFunc: func(ctx context.Context, id int) (*datastore.Genre, error) {
+			return &datastore.Genre{ID: id, Slug: "action"}, nil
+		},
+		insertGenreFunc: func(ctx context.Context, genre *datastore.Genre) error {
+			return nil
+		},
+	}
+
+	_, conn := dialGRPCWith(t, store, []grpcInterceptor{rl.grpcInterceptor})
+	client := movielandv1.NewGenreServiceClient(conn)
+
+	create := func(ctx context.Context) codes.Code {
+		_, err := client.CreateGenre(ctx, &movielandv1.CreateGenreRequest{Slug: "action"})
+		return status.Code(err)
+	}
+
+	t.Run("limits writes separately from reads", func(t *testing.T) {
+		got := []codes.Code{create(t.Context()), create(t.Context())}
+
+		_, err := client.GetGenre(t.Context(), &movielandv1.GetGenreRequest{Id: 1})
+		got = append(got, status.Code(err))
+
+		if diff := cmp.Diff("[OK ResourceExhausted OK]", fmt.Sprint(got)); diff != "" {
+			t.Errorf("codes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("limits an API key apart from the peer", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(t.Context(), "x-api-key", "key-1")
+
+		if diff := cmp.Diff("[OK ResourceExhausted]", fmt.Sprint([]codes.Code{create(ctx), create(ctx)})); diff != "" {
+			t.Errorf("codes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("limits unknown API keys like the peer", func(t *testing.T) {
+		// the writes of the peer ran out in the first subtest
+		var got []codes.Code
+		for _, key := range []string{"made-up-1", "made-up-2"} {
+			got = append(got, create(metadata.AppendToOutgoingContext(t.Context(), "x-api-key", key)))
+		}
+
+		if diff := cmp.Diff("[ResourceExhausted ResourceExhausted]", fmt.Sprint(got)); diff != "" {
+			t.Errorf("codes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("limits streams as reads", func(t *testing.T) {
+		// the read of the first subtest took the only one
+		stream, err := client.StreamGenres(t.Context(), &movielandv1.StreamGenresRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("expected code %s once the reads ran out, got %v", codes.ResourceExhausted, err)
+		}
+	})
+
+	t.Run("does not limit the health checks", func(t *testing.T) {
+		health := healthpb.NewHealthClient(conn)
+
+		for range 3 {
+			if _, err := health.Check(t.Context(), &healthpb.HealthCheckRequest{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusFailed   = "failed"
+	healthStatusDraining = "draining"
+)
+
+// health answers the liveness and readiness probes. Readiness fails when the
+// database is unreachable, its schema is not the one the binary was built
+// for, or the server is draining before shutdown.
+type health struct {
+	store HealthStore
+	// versions are the versions of the migrations the binary was built with,
+	// the last one is the expected schema version
+	versions      []int64
+	schemaVersion int64
+	timeout       time.Duration
+	draining      atomic.Bool
+}
+
+func newHealth(cfg config.HealthConfig, store HealthStore, versions []int64) *health {
+	h := &health{
+		store:    store,
+		versions: versions,
+		timeout:  cfg.CheckTimeout,
+	}
+	if len(versions) > 0 {
+		h.schemaVersion = versions[len(versions)-1]
+	}
+	return h
+}
+
+// isHealthProbe tells whether the request comes from a load balancer or
+// orchestrator probing the health of the server.
+func isHealthProbe(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healtz", "/livez", "/readyz":
+		return true
+	}
+	return false
+}
+
+// drain makes readiness fail from now on.
+func (h *health) drain() {
+	h.draining.Store(true)
+}
+
+type healthCheck struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+	Version  *int64 `json:"version,omitempty"`
+	Expected *int64 `json:"expected,omitempty"`
+	Pending  *int   `json:"pending,omitempty"`
+}
+
+func (h *health) handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": healthStatusOK}, nil)
+}
+
+func (h *health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": healthStatusDraining}, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	checks := map[string]*healthCheck{
+		"database": h.check(ctx, h.checkDatabase),
+		"schema":   h.check(ctx, h.checkSchema),
+	}
+
+	status, code := healthStatusOK, http.StatusOK
+	for _, check := range checks {
+		if check.Status != healthStatusOK {
+			status, code = healthStatusFailed, http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, code, map[string]any{
+		"status": status,
+		"checks": checks,
+	}, nil)
+}
+
+func (h *health) check(ctx context.Context, fn func(context.Context, *healthCheck) error) *healthCheck {
+	start := time.Now()
+
+	check := &healthCheck{Status: healthStatusOK}
+	if err := fn(ctx, check); err != nil {
+		check.Status = healthStatusFailed
+		check.Error = err.Error()
+	}
+	check.Duration = time.Since(start).String()
+
+	return check
+}
+
+// checkDatabase pings the database, like the other checks it responds with a
+// generic error and only logs the details.
+func (h *health) checkDatabase(ctx context.Context, check *healthCheck) error {
+	if err := h.store.Ping(ctx); err != nil {
+		slog.WarnContext(ctx, "readiness: could not ping database", "err", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errors.New("ping timed out")
+		}
+		return errors.New("ping failed")
+	}
+
+	return nil
+}
+
+// checkSchema compares the schema version with the migrations of the binary,
+// reporting how many are pending when the schema is behind.
+func (h *health) checkSchema(ctx context.Context, check *healthCheck) error {
+	check.Expected = &h.schemaVersion
+
+	version, err := h.store.SchemaVersion(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "readiness: could not read schema version", "err", err)
+		if errors.Is(err, datastore.ErrSchemaNotMigrated) {
+			pending := len(h.versions)
+			check.Pending = &pending
+			return errors.New("schema is not migrated")
+		}
+		return errors.New("could not read the schema version")
+	}
+	check.Version = &version
+
+	switch {
+	case version > h.schemaVersion:
+		return fmt.Errorf("schema version %d is newer than %d, the binary is outdated", version, h.schemaVersion)
+	case version < h.schemaVersion:
+		pending := 0
+		for _, v := range h.versions {
+			if v > version {
+				pending++
+			}
+		}
+		check.Pending = &pending
+		return fmt.Errorf("schema version %d is behind %d, migrations are pending", version, h.schemaVersion)
+	}
+
+	return nil
+}
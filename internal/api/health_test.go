@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+type mockHealthStore struct {
+	pingErr       error
+	schemaVersion int64
+	schemaErr     error
+}
+
+func (m *mockHealthStore) Ping(ctx context.Context) error {
+	return m.pingErr
+}
+
+func (m *mockHealthStore) SchemaVersion(ctx context.Context) (int64, error) {
+	return m.schemaVersion, m.schemaErr
+}
+
+func TestGetLivez(t *testing.T) {
+	h := newHealth(config.HealthConfig{CheckTimeout: time.Second}, &mockHealthStore{}, []int64{1})
+	h.drain()
+
+	mux := http.NewServeMux()
+	registerHealthRoutes(mux, h)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/livez", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d while draining, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestGetReadyz(t *testing.T) {
+	tests := []struct {
+		name           string
+		store          *mockHealthStore
+		draining       bool
+		expectedStatus int
+		expectedBody   map[string]any
+	}{
+		{
+			name:           "returns status 200 when all checks pass",
+			store:          &mockHealthStore{schemaVersion: 2},
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]any{
+				"status": "ok",
+				"checks": map[string]any{
+					"database": map[string]any{"status": "ok"},
+					"schema":   map[string]any{"status": "ok", "version": float64(2), "expected": float64(2)},
+				},
+			},
+		},
+		{
+			name:           "returns status 503 when the database is unreachable",
+			store:          &mockHealthStore{pingErr: errors.New("connection refused"), schemaErr: errors.New("connection refused")},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: map[string]any{
+				"status": "failed",
+				"checks": map[string]any{
+					"database": map[string]any{"status": "failed", "error": "ping failed"},
+					"schema":   map[string]any{"status": "failed", "error": "could not read the schema version", "expected": float64(2)},
+				},
+			},
+		},
+		{
+			name:           "returns status 503 when the schema is behind",
+			store:          &mockHealthStore{schemaVersion: 1},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: map[string]any{
+				"status": "failed",
+				"checks": map[string]any{
+					"database": map[string]any{"status": "ok"},
+					"schema":   map[string]any{"status": "failed", "error": "schema version 1 is behind 2, migrations are pending", "version": float64(1), "expected": float64(2), "pending": float64(1)},
+				},
+			},
+		},
+		{
+			name:           "returns status 503 when the schema is not migrated",
+			store:          &mockHealthStore{schemaErr: datastore.ErrSchemaNotMigrated},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: map[string]any{
+				"status": "failed",
+				"checks": map[string]any{
+					"database": map[string]any{"status": "ok"},
+					"schema":   map[string]any{"status": "failed", "error": "schema is not migrated", "expected": float64(2), "pending": float64(2)},
+				},
+			},
+		},
+		{
+			name:           "returns status 503 when the schema is newer",
+			store:          &mockHealthStore{schemaVersion: 3},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: map[string]any{
+				"status": "failed",
+				"checks": map[string]any{
+					"database": map[string]any{"status": "ok"},
+					"schema":   map[string]any{"status": "failed", "error": "schema version 3 is newer than 2, the binary is outdated", "version": float64(3), "expected": float64(2)},
+				},
+			},
+		},
+		{
+			name:           "returns status 503 while draining",
+			store:          &mockHealthStore{schemaVersion: 2},
+			draining:       true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   map[string]any{"status": "draining"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHealth(config.HealthConfig{CheckTimeout: time.Second}, tt.store, []int64{1, 2})
+			if tt.draining {
+				h.drain()
+			}
+
+			mux := http.NewServeMux()
+			registerHealthRoutes(mux, h)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+
+			// durations vary from run to run
+			if checks, ok := body["checks"].(map[string]any); ok {
+				for _, check := range checks {
+					delete(check.(map[string]any), "duration")
+				}
+			}
+
+			if diff := cmp.Diff(tt.expectedBody, body); diff != "" {
+				t.Errorf("body mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencySweepInterval = time.Minute
+	idempotencySweepTimeout  = 10 * time.Second
+	// idempotencyClaimTTL bounds how long a key stays claimed by a request
+	// that never finished, because the server stopped while running it
+	idempotencyClaimTTL = 5 * time.Minute
+	// idempotencyPollInterval is how often a retry checks whether the request
+	// it waits for finished
+	idempotencyPollInterval = 100 * time.Millisecond
+	// idempotencyMaxBodyBytes limits the bodies of requests with a key, as
+	// they are read into memory, and the recorded responses. Routes allowed
+	// larger bodies, like the import, ignore the key.
+	idempotencyMaxBodyBytes   = 1 << 20
+	idempotencyRecordMaxBytes = idempotencyMaxBodyBytes
+)
+
+// replayedHeaders are the response headers stored along with the status and
+// body, the others are set again by the middlewares of the retry.
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// idempotency replays the response to a POST request sent with an
+// Idempotency-Key header to retries with the same key, rather than running
+// them again. Keys are scoped per client and reusing one for a different
+// request is refused. The key is claimed before the request runs, retries
+// arriving while it runs wait for its response, or run it themselves when it
+// failed or its claim expired. A retry giving up waiting, because it timed
+// out, gets a 409. Failed requests, with a 5xx status, can be retried.
+// Routes whose body limit is beyond idempotencyMaxBodyBytes ignore the key
+// rather than buffer their bodies. It expects to run after
+// sessionManager.loadSession.
+type idempotency struct {
+	store      IdempotencyStore
+	mux        *http.ServeMux
+	bodyLimits map[string]int64
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func newIdempotency(cfg config.IdempotencyConfig, store IdempotencyStore, mux *http.ServeMux, bodyLimits map[string]int64) *idempotency {
+	return &idempotency{
+		store:      store,
+		mux:        mux,
+		bodyLimits: bodyLimits,
+		ttl:        cfg.TTL,
+		now:        time.Now,
+	}
+}
+
+func (id *idempotency) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, "/api/v1/") || key == "" || id.largeBodies(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !validIdempotencyKey(key) {
+			handleBadRequest(w, "Idempotency-Key must be at most "+strconv.Itoa(maxIdempotencyKeyLength)+" printable ASCII characters", nil)
+			return
+		}
+
+		// the body is read up front, to tell retries from other requests
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idempotencyMaxBodyBytes))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				handleBadRequest(w, "body must not be larger than "+strconv.Itoa(idempotencyMaxBodyBytes)+" bytes with an Idempotency-Key", nil)
+				return
+			}
+			handleBadRequest(w, "could not read body", nil)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+
+		id.sweep(id.now())
+
+		scope := clientKey(r)
+
+		replay, now, err := id.claim(r.Context(), scope, key, fingerprint)
+		if err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		if replay == nil {
+			id.serve(w, r, next, scope, key, fingerprint, now)
+			return
+		}
+
+		if !bytes.Equal(replay.Fingerprint, fingerprint) {
+			handleUnprocessableEntity(w, "Idempotency-Key was already used for a different request")
+			return
+		}
+
+		if replay.Pending {
+			handleConflict(w, "a request with this Idempotency-Key is still running")
+			return
+		}
+
+		for name, values := range replay.Headers {
+			w.Header()[name] = values
+		}
+		w.Header().Set(idempotentReplayedHeader, "true")
+		w.WriteHeader(replay.Status)
+		w.Write(replay.Body)
+	})
+}
+
+// claim claims the key for the request, or returns the record of the key when
+// it was taken. A pending record of the same request is polled until it
+// completes, is released or expires, so the retry replays its response or
+// runs in its place. It is returned still pending once ctx is done. The time
+// of the claim is returned as well.
+func (id *idempotency) claim(ctx context.Context, scope, key string, fingerprint []byte) (*datastore.IdempotencyRecord, time.Time, error) {
+	ticker := time.NewTicker(idempotencyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		now := id.now()
+
+		replay, err := id.store.ClaimIdempotencyKey(ctx, scope, key, fingerprint, now.Add(min(id.ttl, idempotencyClaimTTL)))
+		if err != nil || replay == nil || !replay.Pending || !bytes.Equal(replay.Fingerprint, fingerprint) {
+			return replay, now, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return replay, now, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// largeBodies reports whether the route of the request allows bodies larger
+// than idempotencyMaxBodyBytes.
+func (id *idempotency) largeBodies(r *http.Request) bool {
+	if len(id.bodyLimits) == 0 {
+		return false
+	}
+
+	_, pattern := id.mux.Handler(r)
+	return id.bodyLimits[pattern] > idempotencyMaxBodyBytes
+}
+
+// serve runs the request that claimed the key and stores its response, or
+// releases the key when it failed so a retry runs it again. The store is
+// updated even when the client went away, the response is sent by then.
+func (id *idempotency) serve(w http.ResponseWriter, r *http.Request, next http.Handler, scope, key string, fingerprint []byte, now time.Time) {
+	ctx := context.WithoutCancel(r.Context())
+
+	served := false
+	defer func() {
+		// the handler panicked
+		if !served {
+			id.release(ctx, scope, key)
+		}
+	}()
+
+	rec := &idempotencyRecorder{ResponseWriter: w}
+	next.ServeHTTP(rec, r)
+	served = true
+
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if status >= http.StatusInternalServerError || rec.truncated {
+		id.release(ctx, scope, key)
+		return
+	}
+
+	headers := map[string][]string{}
+	for _, name := range replayedHeaders {
+		if v := w.Header().Values(name); len(v) > 0 {
+			headers[name] = v
+		}
+	}
+
+	err := id.store.CompleteIdempotencyKey(ctx, scope, key, &datastore.IdempotencyRecord{
+		Fingerprint: fingerprint,
+		Status:      status,
+		Headers:     headers,
+		Body:        rec.body.Bytes(),
+		ExpiresAt:   now.Add(id.ttl),
+	})
+	if err != nil {
+		// retries wait until the claim expires
+		slog.ErrorContext(ctx, "could not store idempotency key", "err", err)
+	}
+}
+
+func (id *idempotency) release(ctx context.Context, scope, key string) {
+	if err := id.store.ReleaseIdempotencyKey(ctx, scope, key); err != nil {
+		slog.ErrorContext(ctx, "could not release idempotency key", "err", err)
+	}
+}
+
+// sweep deletes the expired keys in the background, at most once per interval.
+func (id *idempotency) sweep(now time.Time) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	if now.Sub(id.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	id.lastSweep = now
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), idempotencySweepTimeout)
+		defer cancel()
+
+		if err := id.store.DeleteIdempotencyKeysBefore(ctx, now); err != nil {
+			slog.Warn("could not delete expired idempotency keys", "err", err)
+		}
+	}()
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+
+	for _, c := range key {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestFingerprint hashes what makes a request, so a key reused for another
+// route or body is noticed.
+func requestFingerprint(r *http.Request, body []byte) []byte {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// idempotencyRecorder keeps a copy of the response while writing it, up to
+// idempotencyRecordMaxBytes. Longer responses are not recorded.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	if !rec.truncated {
+		if rec.body.Len()+len(b) > idempotencyRecordMaxBytes {
+			rec.truncated = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,426 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+// memoryIdempotencyStore claims keys like the store does, without expiring
+// them.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*datastore.IdempotencyRecord
+	err     error
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[string]*datastore.IdempotencyRecord{}}
+}
+
+func (m *memoryIdempotencyStore) ClaimIdempotencyKey(ctx context.Context, scope, key string, fingerprint []byte, expiresAt time.Time) (*datastore.IdempotencyRecord, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[scope+":"+key]; ok {
+		return existing, nil
+	}
+
+	m.records[scope+":"+key] = &datastore.IdempotencyRecord{Fingerprint: fingerprint, Pending: true, ExpiresAt: expiresAt}
+	return nil, nil
+}
+
+func (m *memoryIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, scope, key string, record *datastore.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[scope+":"+key] = record
+	return nil
+}
+
+func (m *memoryIdempotencyStore) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, scope+":"+key)
+	return nil
+}
+
+func (m *memoryIdempotencyStore) DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+// countingHandler creates a genre for every call it gets, failing calls
+// after failFor.
+type countingHandler struct {
+	calls   atomic.Int32
+	failFor int32
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := h.calls.Add(1)
+
+	if n <= h.failFor {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var input genreInput
+	if err := readJSON(w, r, &input); err != nil {
+		handleBadRequest(w, err.Error(), nil)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"data": map[string]any{"slug": input.Slug, "call": n},
+	}, http.Header{"Location": {"/api/v1/genres/" + input.Slug}})
+}
+
+func idempotentRequest(key, ip, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/api/v1/genres", strings.NewReader(body))
+	req.RemoteAddr = ip + ":1234"
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	return req
+}
+
+func TestIdempotency(t *testing.T) {
+	type response struct {
+		status   int
+		body     string
+		location string
+		replayed string
+	}
+
+	tests := []struct {
+		name          string
+		failFor       int32
+		requests      []*http.Request
+		expected      []response
+		expectedCalls int32
+	}{
+		{
+			name: "runs requests without a key every time",
+			requests: []*http.Request{
+				idempotentRequest("", "192.0.2.1", `{"slug":"drama"}`),
+				idempotentRequest("", "192.0.2.1", `{"slug":"drama"}`),
+			},
+			expected: []response{
+				{status: http.StatusCreated, body: `{"data":{"call":1,"slug":"drama"}}`, location: "/api/v1/genres/drama"},
+				{status: http.StatusCreated, body: `{"data":{"call":2,"slug":"drama"}}`, location: "/api/v1/genres/drama"},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name: "replays the response to a retry",
+			requests: []*http.Request{
+				idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`),
+				idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`),
+			},
+			expected: []response{
+				{status: http.StatusCreated, body: `{"data":{"call":1,"slug":"drama"}}`, location: "/api/v1/genres/drama"},
+				{status: http.StatusCreated, body: `{"data":{"call":1,"slug":"drama"}}`, location: "/api/v1/genres/drama", replayed: "true"},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name: "returns status 422 when the key is reused for another body",
+			requests: []*http.Request{
+				idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`),
+				idempotentRequest("key-1", "192.0.2.1", `{"slug":"comedy"}`),
+			},
+			expected: []response{
+				{status: http.StatusCreated, body: `{"data":{"call":1,"slug":"drama"}}`, location: "/api/v1/genres/drama"},
+				{status: http.StatusUnprocessableEntity, body: `{"message":"Idempotency-Key was already used for a different request","status":422}`},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name: "scopes the keys per client",
+			requests: []*http.Request{
+				idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`),
+				idempotentRequest("key-1", "192.0.2.2", `{"slug":"drama"}`),
+			},
+			expected: []response{
+				{status: http.StatusCreated, body: `{"data":{"call":1,"slug":"drama"}}`, location: "/api/v1/genres/drama"},
+				{status: http.StatusCreated, body: `{"data":{"call":2,"slug":"drama"}}`, location: "/api/v1/genres/drama"},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name:    "runs a retry of a failed request again",
+			failFor: 1,
+			requests: []*http.Request{
+				idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`),
+				idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`),
+			},
+			expected: []response{
+				{status: http.StatusInternalServerError},
+				{status: http.StatusCreated, body: `{"data":{"call":2,"slug":"drama"}}`, location: "/api/v1/genres/drama"},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name: "returns status 400 for an invalid key",
+			requests: []*http.Request{
+				idempotentRequest("key\x00", "192.0.2.1", `{"slug":"drama"}`),
+			},
+			expected: []response{
+				{status: http.StatusBadRequest, body: `{"message":"Idempotency-Key must be at most 255 printable ASCII characters","status":400}`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &countingHandler{failFor: tt.failFor}
+			id := newIdempotency(config.IdempotencyConfig{TTL: time.Hour}, newMemoryIdempotencyStore(), nil, nil)
+			h := id.middleware(handler)
+
+			var got []response
+			for _, req := range tt.requests {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+
+				got = append(got, response{
+					status:   rec.Code,
+					body:     rec.Body.String(),
+					location: rec.Header().Get("Location"),
+					replayed: rec.Header().Get(idempotentReplayedHeader),
+				})
+			}
+
+			if diff := cmp.Diff(tt.expected, got, cmp.AllowUnexported(response{})); diff != "" {
+				t.Errorf("responses mismatch (-want +got):\n%s", diff)
+			}
+
+			if calls := handler.calls.Load(); calls != tt.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+// pendingSignalingStore tells when a claim found the key pending.
+type pendingSignalingStore struct {
+	*memoryIdempotencyStore
+	pending chan struct{}
+	once    sync.Once
+}
+
+func (s *pendingSignalingStore) ClaimIdempotencyKey(ctx context.Context, scope, key string, fingerprint []byte, expiresAt time.Time) (*datastore.IdempotencyRecord, error) {
+	record, err := s.memoryIdempotencyStore.ClaimIdempotencyKey(ctx, scope, key, fingerprint, expiresAt)
+	if record != nil && record.Pending {
+		s.once.Do(func() { close(s.pending) })
+	}
+	return record, err
+}
+
+func TestIdempotencyConcurrentRetries(t *testing.T) {
+	newHandler := func(store IdempotencyStore, handler http.Handler) (http.Handler, chan struct{}, chan struct{}) {
+		started := make(chan struct{})
+		finish := make(chan struct{})
+
+		return newIdempotency(config.IdempotencyConfig{TTL: time.Hour}, store, nil, nil).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-First") != "" {
+				close(started)
+				<-finish
+			}
+			handler.ServeHTTP(w, r)
+		})), started, finish
+	}
+
+	// runFirst runs the first request until the handler blocks, the returned
+	// func lets it finish and returns its response
+	runFirst := func(h http.Handler, started, finish chan struct{}) func() *httptest.ResponseRecorder {
+		first := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			req := idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`)
+			req.Header.Set("X-First", "true")
+			h.ServeHTTP(first, req)
+		}()
+		<-started
+
+		return func() *httptest.ResponseRecorder {
+			close(finish)
+			<-done
+			return first
+		}
+	}
+
+	t.Run("waits for the response of the request", func(t *testing.T) {
+		handler := &countingHandler{}
+		store := &pendingSignalingStore{memoryIdempotencyStore: newMemoryIdempotencyStore(), pending: make(chan struct{})}
+		h, started, finish := newHandler(store, handler)
+
+		finishFirst := runFirst(h, started, finish)
+
+		retry := httptest.NewRecorder()
+		retried := make(chan struct{})
+		go func() {
+			defer close(retried)
+			h.ServeHTTP(retry, idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`))
+		}()
+
+		<-store.pending
+		first := finishFirst()
+		<-retried
+
+		if first.Code != http.StatusCreated {
+			t.Errorf("expected status %d for the request, got %d", http.StatusCreated, first.Code)
+		}
+
+		if retry.Code != http.StatusCreated || retry.Header().Get(idempotentReplayedHeader) != "true" {
+			t.Errorf("expected the retry to get the replayed status %d, got %d", http.StatusCreated, retry.Code)
+		}
+
+		if body := retry.Body.String(); body != `{"data":{"call":1,"slug":"drama"}}` {
+			t.Errorf("expected the retry to get the first response, got %s", body)
+		}
+
+		if calls := handler.calls.Load(); calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("runs the request when the first one failed", func(t *testing.T) {
+		handler := &countingHandler{failFor: 1}
+		store := &pendingSignalingStore{memoryIdempotencyStore: newMemoryIdempotencyStore(), pending: make(chan struct{})}
+		h, started, finish := newHandler(store, handler)
+
+		finishFirst := runFirst(h, started, finish)
+
+		retry := httptest.NewRecorder()
+		retried := make(chan struct{})
+		go func() {
+			defer close(retried)
+			h.ServeHTTP(retry, idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`))
+		}()
+
+		<-store.pending
+		first := finishFirst()
+		<-retried
+
+		if first.Code != http.StatusInternalServerError {
+			t.Errorf("expected status %d for the request, got %d", http.StatusInternalServerError, first.Code)
+		}
+
+		if body := retry.Body.String(); retry.Code != http.StatusCreated || body != `{"data":{"call":2,"slug":"drama"}}` {
+			t.Errorf("expected the retry to run the request, got %d %s", retry.Code, body)
+		}
+	})
+
+	t.Run("gets a 409 when it stops waiting", func(t *testing.T) {
+		h, started, finish := newHandler(newMemoryIdempotencyStore(), &countingHandler{})
+
+		finishFirst := runFirst(h, started, finish)
+		defer finishFirst()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 2*idempotencyPollInterval)
+		defer cancel()
+
+		retry := httptest.NewRecorder()
+		h.ServeHTTP(retry, idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`).WithContext(ctx))
+
+		if retry.Code != http.StatusConflict {
+			t.Errorf("expected status %d for a retry giving up, got %d", http.StatusConflict, retry.Code)
+		}
+	})
+}
+
+func TestIdempotencyLargeBodies(t *testing.T) {
+	var calls atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/import", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			handleBadRequest(w, err.Error(), nil)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"bytes": n}}, nil)
+	})
+
+	store := newMemoryIdempotencyStore()
+	h := newIdempotency(config.IdempotencyConfig{TTL: time.Hour}, store, mux, map[string]int64{"POST /api/v1/import": 64 << 20}).middleware(mux)
+
+	body := strings.Repeat("x", 2*idempotencyMaxBodyBytes)
+
+	for range 2 {
+		req := httptest.NewRequest("POST", "/api/v1/import", strings.NewReader(body))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if want := fmt.Sprintf(`{"data":{"bytes":%d}}`, len(body)); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Fatalf("expected status %d with %s, got %d with %s", http.StatusOK, want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// the key is ignored, the body is not read into memory to fingerprint it
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 calls, got %d", got)
+	}
+
+	if len(store.records) != 0 {
+		t.Errorf("expected no key to be claimed, got %v", store.records)
+	}
+}
+
+func TestIdempotencyPanic(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	h := newIdempotency(config.IdempotencyConfig{TTL: time.Hour}, store, nil, nil).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() { recover() }()
+		h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`))
+	}()
+
+	if len(store.records) != 0 {
+		t.Errorf("expected the key to be released, got %v", store.records)
+	}
+}
+
+func TestIdempotencyStoreFailure(t *testing.T) {
+	handler := &countingHandler{}
+	store := newMemoryIdempotencyStore()
+	store.err = errors.New("database error")
+
+	h := newIdempotency(config.IdempotencyConfig{TTL: time.Hour}, store, nil, nil).middleware(handler)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("key-1", "192.0.2.1", `{"slug":"drama"}`))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	if calls := handler.calls.Load(); calls != 0 {
+		t.Errorf("expected the request not to run, got %d calls", calls)
+	}
+}
@@ -30,13 +30,10 @@ func writeJSON(w http.ResponseWriter, status int, data any, headers http.Header)
 	return nil
 }
 
-const maxBytes = 1_048_576
-
+// readJSON decodes the body into dst, the size of the body is limited by the
+// limitBodies middleware.
 func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
-	// Limit the size of the request body to 1MB
-	limitedBody := http.MaxBytesReader(w, r.Body, int64(maxBytes))
-
-	dec := json.NewDecoder(limitedBody)
+	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 
 	err := dec.Decode(dst)
@@ -83,8 +80,8 @@ func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
 		// Use the errors.As() function to check whether the error has the type
-		// *http.MaxBytesError. If it does, then it means the request body exceeded our
-		// size limit of 1MB and we return a clear error message.
+		// *http.MaxBytesError. If it does, then it means the request body exceeded the
+		// size limit of its route and we return a clear error message.
 		case errors.As(err, &maxBytesError):
 			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
 
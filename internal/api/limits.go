@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+// configureServer applies the timeouts and header limit of the config to the
+// server.
+func configureServer(s *http.Server, cfg config.ServerConfig) *http.Server {
+	s.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+	s.ReadTimeout = cfg.ReadTimeout
+	s.WriteTimeout = cfg.WriteTimeout
+	s.IdleTimeout = cfg.IdleTimeout
+	s.MaxHeaderBytes = cfg.MaxHeaderBytes
+	return s
+}
+
+// limitBodies limits the request body to the limit of its route, or
+// MaxBodyBytes for routes without one. Reading beyond it fails with an
+// *http.MaxBytesError.
+func limitBodies(mux *http.ServeMux, cfg config.ServerConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := cfg.MaxBodyBytes
+
+			_, pattern := mux.Handler(r)
+			if routeLimit, ok := cfg.RouteBodyLimits[pattern]; ok {
+				limit = routeLimit
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitConcurrency sheds the requests beyond the limit that are served at once
+// with a 503, so a burst cannot exhaust the database pool and memory. The
+// health probes are never shed, a busy server is still alive and ready.
+func limitConcurrency(limit int) middleware {
+	slots := make(chan struct{}, limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthProbe(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				slog.WarnContext(r.Context(), "shedding request, too many concurrent requests", "method", r.Method, "url", r.URL, "limit", limit)
+				handleServiceUnavailable(w, "server is too busy", time.Second)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeouts cancels the context of a request once its route runs longer than
+// its timeout, HandlerTimeout for routes without one, and answers with a 503
+// like http.TimeoutHandler does, only in JSON. The response is not buffered:
+// the 503 is only sent when the handler wrote nothing before the deadline, a
+// response already under way is cut short instead. The handler runs in the
+// goroutine of the request, so it holds its slot of limitConcurrency until it
+// returns. A timeout of 0 serves a route without a deadline.
+func timeouts(mux *http.ServeMux, cfg config.ServerConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := cfg.HandlerTimeout
+
+			_, pattern := mux.Handler(r)
+			if routeTimeout, ok := cfg.RouteTimeouts[pattern]; ok {
+				timeout = routeTimeout
+			}
+
+			rc := http.NewResponseController(w)
+
+			if timeout == 0 {
+				// lift the deadlines of the server as well, the writers may
+				// not support it when not served by net/http
+				_ = rc.SetReadDeadline(time.Time{})
+				_ = rc.SetWriteDeadline(time.Time{})
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// routes allowed to run longer than the others need the deadlines
+			// of the connection to be extended with them
+			if timeout > cfg.HandlerTimeout {
+				now := time.Now()
+				if cfg.ReadTimeout > 0 {
+					_ = rc.SetReadDeadline(now.Add(max(timeout, cfg.ReadTimeout)))
+				}
+				if cfg.WriteTimeout > 0 {
+					_ = rc.SetWriteDeadline(now.Add(timeout + cfg.WriteTimeout - cfg.HandlerTimeout))
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+
+			// unblocks the writes of a response under way, the writer may not
+			// support it when not served by net/http
+			stop := context.AfterFunc(ctx, func() {
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				if tw.wrote && tw.expired() {
+					_ = rc.SetWriteDeadline(time.Now())
+				}
+			})
+			defer stop()
+
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			if !tw.expired() {
+				return
+			}
+
+			slog.WarnContext(r.Context(), "request timed out", "method", r.Method, "url", r.URL, "route", pattern, "timeout", timeout)
+
+			if !tw.wrote {
+				handleServiceUnavailable(w, "request timed out", 0)
+			}
+		})
+	}
+}
+
+// timeoutWriter passes the response of a handler through until its deadline,
+// writes after it fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+
+	mu    sync.Mutex
+	wrote bool
+}
+
+// expired tells whether the deadline passed, rather than the client going away.
+func (tw *timeoutWriter) expired() bool {
+	return errors.Is(tw.ctx.Err(), context.DeadlineExceeded)
+}
+
+// start claims the response for the handler, unless the deadline passed.
+func (tw *timeoutWriter) start() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.expired() {
+		return http.ErrHandlerTimeout
+	}
+	tw.wrote = true
+	return nil
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if tw.start() != nil {
+		return
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if err := tw.start(); err != nil {
+		return 0, err
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+func TestLimitBodies(t *testing.T) {
+	mux := http.NewServeMux()
+	read := func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]any
+		if err := readJSON(w, r, &input); err != nil {
+			handleBadRequest(w, err.Error(), nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	mux.HandleFunc("POST /small", read)
+	mux.HandleFunc("POST /large", read)
+
+	h := limitBodies(mux, config.ServerConfig{
+		MaxBodyBytes:    16,
+		RouteBodyLimits: map[string]int64{"POST /large": 64},
+	})(mux)
+
+	body := `{"name":"` + strings.Repeat("a", 32) + `"}`
+
+	tests := []struct {
+		path    string
+		status  int
+		message string
+	}{
+		{path: "/small", status: http.StatusBadRequest, message: "body must not be larger than 16 bytes"},
+		{path: "/large", status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("POST", tt.path, strings.NewReader(body)))
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+
+			if tt.message != "" {
+				var res ErrorDto
+				if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+					t.Fatal(err)
+				}
+				if res.Message != tt.message {
+					t.Errorf("expected message %q, got %q", tt.message, res.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	h := limitConcurrency(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	}()
+	<-entered
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/genres", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the request to be shed with status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected the probe to be served with status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	close(release)
+	<-done
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/genres", nil))
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected the request to be served once a slot freed up, got %d", rr.Code)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "fast")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "done")
+	})
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+			w.Header().Set("X-Handler", "slow")
+			io.WriteString(w, "done")
+		}
+	}
+	mux.HandleFunc("GET /slow", slow)
+	mux.HandleFunc("GET /slow/allowed", slow)
+	mux.HandleFunc("GET /stream", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("expected a streaming route without a deadline")
+		}
+		if _, ok := w.(*timeoutWriter); ok {
+			t.Error("expected a streaming route to write unbuffered")
+		}
+		io.WriteString(w, "done")
+	})
+	mux.HandleFunc("GET /partial", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "partial")
+		<-r.Context().Done()
+		if _, err := io.WriteString(w, "more"); err != http.ErrHandlerTimeout {
+			t.Errorf("expected writes after the deadline to fail, got %v", err)
+		}
+	})
+	mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	h := timeouts(mux, config.ServerConfig{
+		HandlerTimeout: 20 * time.Millisecond,
+		RouteTimeouts: map[string]time.Duration{
+			"GET /slow/allowed": time.Second,
+			"GET /stream":       0,
+		},
+	})(mux)
+
+	tests := []struct {
+		path    string
+		status  int
+		handler string
+		body    string
+	}{
+		{path: "/fast", status: http.StatusCreated, handler: "fast", body: "done"},
+		{path: "/slow", status: http.StatusServiceUnavailable, body: `{"message":"request timed out","status":503}`},
+		{path: "/slow/allowed", status: http.StatusOK, handler: "slow", body: "done"},
+		{path: "/stream", status: http.StatusOK, body: "done"},
+		{path: "/partial", status: http.StatusOK, body: "partial"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("X-Handler"); got != tt.handler {
+				t.Errorf("expected X-Handler %q, got %q", tt.handler, got)
+			}
+			if diff := cmp.Diff(tt.body, strings.TrimSpace(rr.Body.String())); diff != "" {
+				t.Errorf("body mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("panics in the serving goroutine", func(t *testing.T) {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("expected the panic of the handler, got %v", p)
+			}
+		}()
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+}
+
+func TestTimeoutsHoldConcurrencySlot(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		// ignores the deadline
+		entered <- struct{}{}
+		<-release
+	})
+
+	h := limitConcurrency(1)(timeouts(mux, config.ServerConfig{HandlerTimeout: time.Millisecond})(mux))
+
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/slow", nil))
+	}()
+	<-entered
+	time.Sleep(20 * time.Millisecond)
+
+	shed := httptest.NewRecorder()
+	h.ServeHTTP(shed, httptest.NewRequest("GET", "/api/v1/genres", nil))
+
+	close(release)
+	<-done
+
+	if shed.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the slot to be held past the deadline, got status %d", shed.Code)
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the timed out request to get status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+// lockout protects the authentication routes against guessing, failed attempts
+// slow down further attempts of the same account and IP address until they get
+// locked out for a while. See config.LockoutConfig for the thresholds.
+type lockout struct {
+	cfg   config.LockoutConfig
+	store ThrottleStore
+	now   func() time.Time
+}
+
+func newLockout(cfg config.LockoutConfig, store ThrottleStore) *lockout {
+	return &lockout{
+		cfg:   cfg,
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// attempt identifies who tries to authenticate, the account is keyed by email
+// so unknown addresses are throttled just like known ones. Second factor
+// attempts are keyed by user instead, a password login must not forget them.
+// recorded holds the throttles of its keys once allow counted it.
+type attempt struct {
+	email    string
+	ip       string
+	userID   int
+	mfa      bool
+	recorded []*datastore.AuthThrottle
+}
+
+func newAttempt(r *http.Request, email string, userID int) attempt {
+	return attempt{
+		email:  email,
+		ip:     clientIP(r),
+		userID: userID,
+	}
+}
+
+func newMFAAttempt(r *http.Request, user *datastore.User) attempt {
+	a := newAttempt(r, user.Email, user.ID)
+	a.mfa = true
+	return a
+}
+
+type throttleKey struct {
+	scope     string
+	key       string
+	threshold int
+	event     string
+}
+
+func (l *lockout) keys(a attempt) []throttleKey {
+	return []throttleKey{
+		l.accountKey(a),
+		{scope: datastore.ThrottleScopeIP, key: a.ip, threshold: l.cfg.IPThreshold, event: datastore.AuthEventIPLocked},
+	}
+}
+
+func (l *lockout) accountKey(a attempt) throttleKey {
+	if a.mfa {
+		return throttleKey{scope: datastore.ThrottleScopeMFA, key: strconv.Itoa(a.userID), threshold: l.cfg.AccountThreshold, event: datastore.AuthEventMFALocked}
+	}
+
+	return throttleKey{scope: datastore.ThrottleScopeAccount, key: a.email, threshold: l.cfg.AccountThreshold, event: datastore.AuthEventAccountLocked}
+}
+
+// allow counts the attempt as failed before it is checked and reports whether
+// it may proceed, so concurrent attempts cannot all pass before their failures
+// are recorded. Otherwise it has already responded with status 429 and a
+// Retry-After header.
+func (l *lockout) allow(w http.ResponseWriter, r *http.Request, a *attempt) bool {
+	wait, err := l.record(r.Context(), a)
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return false
+	}
+
+	if wait == 0 {
+		return true
+	}
+
+	if err = l.audit(r.Context(), *a, datastore.AuthEventThrottled); err != nil {
+		handleInternalServerError(w, r, err)
+		return false
+	}
+
+	handleTooManyRequests(w, "too many failed attempts, try again later", wait)
+	return false
+}
+
+// record counts the attempt for each of its keys and returns how long it has
+// to wait, judged by the attempts before it, zero when it may proceed.
+func (l *lockout) record(ctx context.Context, a *attempt) (time.Duration, error) {
+	now := l.now()
+
+	var wait time.Duration
+	a.recorded = nil
+
+	for _, k := range l.keys(*a) {
+		before, after, err := l.store.RecordAuthAttempt(ctx, k.scope, k.key, now, now.Add(-l.cfg.ResetAfter))
+		if err != nil {
+			return 0, err
+		}
+		a.recorded = append(a.recorded, after)
+
+		if before != nil {
+			wait = max(wait, l.delay(before))
+		}
+	}
+
+	return wait, nil
+}
+
+// delay returns the time left until the throttle allows the next attempt.
+func (l *lockout) delay(throttle *datastore.AuthThrottle) time.Duration {
+	now := l.now()
+
+	if throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(now) {
+		return throttle.LockedUntil.Time.Sub(now)
+	}
+
+	if throttle.LastFailedAt.Before(now.Add(-l.cfg.ResetAfter)) {
+		return 0
+	}
+
+	next := throttle.LastFailedAt.Add(l.backoff(throttle.Failures))
+	if next.After(now) {
+		return next.Sub(now)
+	}
+
+	return 0
+}
+
+// backoff doubles the delay with every failure beyond the free attempts.
+func (l *lockout) backoff(failures int) time.Duration {
+	exceeded := failures - l.cfg.FreeAttempts
+	if exceeded < 0 {
+		return 0
+	}
+
+	delay := float64(l.cfg.BaseDelay) * math.Pow(2, float64(exceeded))
+	if delay >= float64(l.cfg.MaxDelay) {
+		return l.cfg.MaxDelay
+	}
+
+	return time.Duration(delay)
+}
+
+// fail records the failure of an attempt allow counted and locks out the
+// account or IP address that reached its threshold.
+func (l *lockout) fail(ctx context.Context, a attempt, event string) error {
+	keys := l.keys(a)
+	if len(a.recorded) != len(keys) {
+		return errors.New("lockout: attempt was not recorded")
+	}
+
+	if err := l.audit(ctx, a, event); err != nil {
+		return err
+	}
+
+	for i, k := range keys {
+		throttle := a.recorded[i]
+		if throttle.Failures < k.threshold || throttle.LockedUntil.Valid {
+			continue
+		}
+
+		if err := l.store.LockAuthThrottle(ctx, k.scope, k.key, l.now().Add(l.cfg.Duration)); err != nil {
+			return err
+		}
+
+		if err := l.audit(ctx, a, k.event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// succeed forgets the failed attempts of the account, or of the second factor
+// for a second factor attempt. The ones of the IP address remain as other
+// accounts may have been guessed from it, only the attempt itself is uncounted.
+func (l *lockout) succeed(ctx context.Context, a attempt) error {
+	k := l.accountKey(a)
+	if err := l.store.ClearAuthThrottle(ctx, k.scope, k.key); err != nil {
+		return err
+	}
+
+	return l.store.ForgiveAuthFailure(ctx, datastore.ThrottleScopeIP, a.ip)
+}
+
+// unlock lifts the lockout of the user on behalf of the actor.
+func (l *lockout) unlock(ctx context.Context, user *datastore.User, actor *datastore.User, ip string) error {
+	if err := l.store.ClearAuthThrottle(ctx, datastore.ThrottleScopeAccount, user.Email); err != nil {
+		return err
+	}
+
+	if err := l.store.ClearAuthThrottle(ctx, datastore.ThrottleScopeMFA, strconv.Itoa(user.ID)); err != nil {
+		return err
+	}
+
+	return l.store.InsertAuthEvent(ctx, &datastore.AuthEvent{
+		Event:     datastore.AuthEventAccountUnlocked,
+		Email:     sql.NullString{String: user.Email, Valid: true},
+		IPAddress: sql.NullString{String: ip, Valid: ip != ""},
+		UserID:    sql.NullInt64{Int64: int64(user.ID), Valid: true},
+		ActorID:   sql.NullInt64{Int64: int64(actor.ID), Valid: true},
+	})
+}
+
+func (l *lockout) audit(ctx context.Context, a attempt, event string) error {
+	return l.store.InsertAuthEvent(ctx, &datastore.AuthEvent{
+		Event:     event,
+		Email:     sql.NullString{String: a.email, Valid: a.email != ""},
+		IPAddress: sql.NullString{String: a.ip, Valid: a.ip != ""},
+		UserID:    sql.NullInt64{Int64: int64(a.userID), Valid: a.userID != 0},
+	})
+}
+
+func handleUserUnlock(users UserStore, lockout *lockout) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getIntParam(r, "id")
+		if err != nil {
+			handleNotFound(w, "user not found")
+			return
+		}
+
+		user, err := users.GetUser(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, datastore.ErrUserNotFound) {
+				handleNotFound(w, "user not found")
+				return
+			}
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		if err = lockout.unlock(r.Context(), user, userFromContext(r.Context()), clientIP(r)); err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// retryAfterSeconds rounds up, clients retrying a bit early would be throttled again.
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
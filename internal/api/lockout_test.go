@@ -0,0 +1,482 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+// memoryThrottleStore mirrors the upsert semantics of the datastore in memory.
+type memoryThrottleStore struct {
+	mu        sync.Mutex
+	throttles map[string]*datastore.AuthThrottle
+	events    []*datastore.AuthEvent
+}
+
+func newMemoryThrottleStore() *memoryThrottleStore {
+	return &memoryThrottleStore{throttles: make(map[string]*datastore.AuthThrottle)}
+}
+
+func (m *memoryThrottleStore) GetAuthThrottle(ctx context.Context, scope, key string) (*datastore.AuthThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	throttle, ok := m.throttles[scope+":"+key]
+	if !ok {
+		return nil, datastore.ErrAuthThrottleNotFound
+	}
+
+	got := *throttle
+	return &got, nil
+}
+
+func (m *memoryThrottleStore) RecordAuthAttempt(ctx context.Context, scope, key string, at, resetBefore time.Time) (*datastore.AuthThrottle, *datastore.AuthThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var before *datastore.AuthThrottle
+
+	throttle, ok := m.throttles[scope+":"+key]
+	if ok {
+		prev := *throttle
+		before = &prev
+	}
+
+	switch {
+	case !ok:
+		throttle = &datastore.AuthThrottle{Scope: scope, Key: key, Failures: 1}
+		m.throttles[scope+":"+key] = throttle
+	case throttle.LastFailedAt.Before(resetBefore):
+		throttle.Failures = 1
+	default:
+		throttle.Failures++
+	}
+
+	throttle.LastFailedAt = at
+	if throttle.LockedUntil.Valid && !throttle.LockedUntil.Time.After(at) {
+		throttle.LockedUntil = sql.NullTime{}
+	}
+
+	after := *throttle
+	return before, &after, nil
+}
+
+func (m *memoryThrottleStore) ForgiveAuthFailure(ctx context.Context, scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if throttle, ok := m.throttles[scope+":"+key]; ok && throttle.Failures > 0 {
+		throttle.Failures--
+	}
+	return nil
+}
+
+func (m *memoryThrottleStore) LockAuthThrottle(ctx context.Context, scope, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	throttle, ok := m.throttles[scope+":"+key]
+	if !ok {
+		return datastore.ErrAuthThrottleNotFound
+	}
+
+	throttle.LockedUntil = sql.NullTime{Time: until, Valid: true}
+	return nil
+}
+
+func (m *memoryThrottleStore) ClearAuthThrottle(ctx context.Context, scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.throttles, scope+":"+key)
+	return nil
+}
+
+func (m *memoryThrottleStore) InsertAuthEvent(ctx context.Context, event *datastore.AuthEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *memoryThrottleStore) eventNames() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.events))
+	for _, e := range m.events {
+		names = append(names, e.Event)
+	}
+	return names
+}
+
+var testLockoutConfig = config.LockoutConfig{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         10 * time.Second,
+	AccountThreshold: 6,
+	IPThreshold:      20,
+	Duration:         15 * time.Minute,
+	ResetAfter:       time.Hour,
+}
+
+// fakeClock is a settable clock for the lockout.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// failAttempt runs an attempt through the lockout like a wrong password, it
+// returns how long the attempt had to wait, failing it only when it did not.
+func failAttempt(t *testing.T, l *lockout, a attempt, event string) time.Duration {
+	t.Helper()
+
+	wait, err := l.record(context.Background(), &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wait == 0 {
+		if err = l.fail(context.Background(), a, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return wait
+}
+
+// waitFor returns how long the next attempt has to wait, without counting it.
+func waitFor(t *testing.T, store *memoryThrottleStore, l *lockout, a attempt) time.Duration {
+	t.Helper()
+
+	var wait time.Duration
+	for _, k := range l.keys(a) {
+		throttle, err := store.GetAuthThrottle(context.Background(), k.scope, k.key)
+		if errors.Is(err, datastore.ErrAuthThrottleNotFound) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait = max(wait, l.delay(throttle))
+	}
+
+	return wait
+}
+
+func newTestLockout(store ThrottleStore) (*lockout, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 10, 11, 12, 0, 0, 0, time.UTC)}
+
+	l := newLockout(testLockoutConfig, store)
+	l.now = clock.Now
+
+	return l, clock
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	l, _ := newTestLockout(newMemoryThrottleStore())
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 5, want: 4 * time.Second},
+		{failures: 6, want: 8 * time.Second},
+		{failures: 7, want: 10 * time.Second},
+		{failures: 100, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := l.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	a := attempt{email: "jane@example.com", ip: "192.0.2.1"}
+
+	t.Run("backs off after the free attempts", func(t *testing.T) {
+		store := newMemoryThrottleStore()
+		l, clock := newTestLockout(store)
+
+		for range testLockoutConfig.FreeAttempts {
+			if wait := failAttempt(t, l, a, datastore.AuthEventLoginFailed); wait != 0 {
+				t.Fatalf("expected the free attempts not to wait, got %v", wait)
+			}
+		}
+
+		if wait := waitFor(t, store, l, a); wait != time.Second {
+			t.Errorf("expected to wait %v, got %v", time.Second, wait)
+		}
+
+		clock.Advance(time.Second)
+
+		if wait := waitFor(t, store, l, a); wait != 0 {
+			t.Errorf("expected no wait once the delay passed, got %v", wait)
+		}
+	})
+
+	t.Run("locks out the account at the threshold until the duration passed", func(t *testing.T) {
+		store := newMemoryThrottleStore()
+		l, clock := newTestLockout(store)
+
+		for range testLockoutConfig.AccountThreshold {
+			failAttempt(t, l, a, datastore.AuthEventLoginFailed)
+			clock.Advance(time.Minute)
+		}
+
+		wait := waitFor(t, store, l, a)
+		if want := testLockoutConfig.Duration - time.Minute; wait != want {
+			t.Errorf("expected to wait %v, got %v", want, wait)
+		}
+
+		other := attempt{email: "john@example.com", ip: a.ip}
+		if wait = waitFor(t, store, l, other); wait != 0 {
+			t.Errorf("expected other accounts from the same IP not to be locked out, got %v", wait)
+		}
+
+		if got := store.eventNames(); got[len(got)-1] != datastore.AuthEventAccountLocked {
+			t.Errorf("expected an %s event, got %v", datastore.AuthEventAccountLocked, got)
+		}
+
+		clock.Advance(testLockoutConfig.Duration)
+
+		if wait = waitFor(t, store, l, a); wait != 0 {
+			t.Errorf("expected the lockout to end, got %v", wait)
+		}
+	})
+
+	t.Run("forgets failures after a success or the reset period", func(t *testing.T) {
+		store := newMemoryThrottleStore()
+		l, clock := newTestLockout(store)
+
+		for range testLockoutConfig.FreeAttempts {
+			failAttempt(t, l, a, datastore.AuthEventLoginFailed)
+		}
+
+		if err := l.succeed(context.Background(), a); err != nil {
+			t.Fatal(err)
+		}
+
+		throttle, err := store.GetAuthThrottle(context.Background(), datastore.ThrottleScopeIP, a.ip)
+		if err != nil {
+			t.Fatalf("expected the IP failures to remain: %v", err)
+		}
+
+		clock.Advance(testLockoutConfig.ResetAfter + time.Second)
+
+		if wait := l.delay(throttle); wait != 0 {
+			t.Errorf("expected no wait after the reset period, got %v", wait)
+		}
+
+		failAttempt(t, l, a, datastore.AuthEventLoginFailed)
+
+		throttle, _ = store.GetAuthThrottle(context.Background(), datastore.ThrottleScopeIP, a.ip)
+		if throttle.Failures != 1 {
+			t.Errorf("expected failures to restart at 1, got %d", throttle.Failures)
+		}
+	})
+
+	t.Run("keeps second factor failures after a password login", func(t *testing.T) {
+		store := newMemoryThrottleStore()
+		l, clock := newTestLockout(store)
+
+		password := attempt{email: a.email, ip: a.ip, userID: 1}
+		mfa := attempt{email: a.email, ip: a.ip, userID: 1, mfa: true}
+
+		for range testLockoutConfig.AccountThreshold {
+			failAttempt(t, l, mfa, datastore.AuthEventMFAFailed)
+			clock.Advance(time.Minute)
+		}
+
+		if err := l.succeed(context.Background(), password); err != nil {
+			t.Fatal(err)
+		}
+
+		throttle, err := store.GetAuthThrottle(context.Background(), datastore.ThrottleScopeMFA, "1")
+		if err != nil {
+			t.Fatalf("expected the second factor failures to remain: %v", err)
+		}
+
+		if !throttle.LockedUntil.Valid {
+			t.Error("expected the second factor to remain locked out")
+		}
+
+		if _, err = store.GetAuthThrottle(context.Background(), datastore.ThrottleScopeAccount, a.email); !errors.Is(err, datastore.ErrAuthThrottleNotFound) {
+			t.Errorf("expected the password failures to be kept apart, got %v", err)
+		}
+
+		if err = l.succeed(context.Background(), mfa); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = store.GetAuthThrottle(context.Background(), datastore.ThrottleScopeMFA, "1"); !errors.Is(err, datastore.ErrAuthThrottleNotFound) {
+			t.Errorf("expected a second factor success to forget the failures, got %v", err)
+		}
+	})
+}
+
+func TestLockoutConcurrentAttempts(t *testing.T) {
+	l, _ := newTestLockout(newMemoryThrottleStore())
+	a := attempt{email: "jane@example.com", ip: "192.0.2.1"}
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+
+	for range 20 {
+		wg.Go(func() {
+			a := a
+			wait, err := l.record(context.Background(), &a)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	// a burst only gets the free attempts, the others wait for the backoff
+	if got := allowed.Load(); got != int32(testLockoutConfig.FreeAttempts) {
+		t.Errorf("expected %d attempts to proceed, got %d", testLockoutConfig.FreeAttempts, got)
+	}
+}
+
+func TestPostLoginThrottled(t *testing.T) {
+	users := &mockUserStore{}
+	env := newAccountsTestEnv(t, users, &mockUserTokenStore{})
+
+	for range testLockoutConfig.FreeAttempts {
+		rec := env.post(t, "/auth/login", map[string]any{"email": "jane@example.com", "password": "wrong"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	}
+
+	rec := env.post(t, "/auth/login", map[string]any{"email": "Jane@example.com", "password": "wrong"})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+
+	want := []string{
+		datastore.AuthEventLoginFailed,
+		datastore.AuthEventLoginFailed,
+		datastore.AuthEventLoginFailed,
+		datastore.AuthEventThrottled,
+	}
+	if diff := cmp.Diff(want, env.throttles.eventNames()); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPostUserUnlock(t *testing.T) {
+	target := &datastore.User{ID: 2, Email: "john@example.com"}
+
+	users := &mockUserStore{
+		getUserFunc: func(ctx context.Context, ID int) (*datastore.User, error) {
+			if ID == target.ID {
+				return target, nil
+			}
+			return nil, datastore.ErrUserNotFound
+		},
+	}
+
+	tests := []struct {
+		name           string
+		roles          []string
+		target         string
+		expectedStatus int
+	}{
+		{
+			name:           "returns status 403 for a non admin",
+			target:         "/api/v1/users/2/unlock",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "returns status 404 for an unknown user",
+			roles:          []string{datastore.RoleAdmin},
+			target:         "/api/v1/users/99/unlock",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "returns status 204 and lifts the lockout",
+			roles:          []string{datastore.RoleAdmin},
+			target:         "/api/v1/users/2/unlock",
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := &datastore.User{ID: 1, Email: "jane@example.com", Roles: tt.roles}
+			store := newMemorySessionStore(admin)
+			sessions := newSessionManager(store, config.SessionConfig{TTL: time.Hour}, false)
+
+			throttles := newMemoryThrottleStore()
+			l, clock := newTestLockout(throttles)
+
+			for range testLockoutConfig.AccountThreshold {
+				failAttempt(t, l, attempt{email: target.Email, ip: "192.0.2.1"}, datastore.AuthEventLoginFailed)
+				clock.Advance(time.Minute)
+			}
+
+			mux := http.NewServeMux()
+			registerUserRoutes(mux, sessions, users, l)
+
+			req := httptest.NewRequest("POST", tt.target, nil)
+			req.AddCookie(login(t, sessions, admin))
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status code %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			_, err := throttles.GetAuthThrottle(context.Background(), datastore.ThrottleScopeAccount, target.Email)
+			wantUnlocked := tt.expectedStatus == http.StatusNoContent
+			if unlocked := errors.Is(err, datastore.ErrAuthThrottleNotFound); unlocked != wantUnlocked {
+				t.Errorf("expected the account to be unlocked: %v, got %v", wantUnlocked, unlocked)
+			}
+
+			if tt.expectedStatus == http.StatusNoContent {
+				event := throttles.events[len(throttles.events)-1]
+				if event.Event != datastore.AuthEventAccountUnlocked || event.ActorID.Int64 != int64(admin.ID) {
+					t.Errorf("expected an %s event by the admin, got %+v", datastore.AuthEventAccountUnlocked, event)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/mail"
+)
+
+const mailSendTimeout = 30 * time.Second
+
+// mailSender delivers mails from background goroutines, so requests do not
+// wait on the mail server. wait blocks until all pending sends are done.
+type mailSender struct {
+	mailer mail.Mailer
+	wg     sync.WaitGroup
+}
+
+func newMailSender(mailer mail.Mailer) *mailSender {
+	return &mailSender{mailer: mailer}
+}
+
+func (ms *mailSender) send(msg mail.Message) {
+	ms.wg.Add(1)
+
+	go func() {
+		defer ms.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				slog.Error("mail: panic while sending", "to", msg.To, "err", err)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+
+		if err := ms.mailer.Send(ctx, msg); err != nil {
+			slog.Error("mail: could not send", "to", msg.To, "subject", msg.Subject, "err", err)
+		}
+	}()
+}
+
+func (ms *mailSender) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ms.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/logging"
+)
+
+type middleware func(http.Handler) http.Handler
+
+// chain wraps the handler with the middlewares, the first one runs outermost.
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+type requestIDContextKey struct{}
+
+const maxRequestIDLength = 128
+
+// requestIDs accepts the X-Request-ID of the client, or generates one when it
+// is missing or unreasonable to log, and echoes it in the response.
+func requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = rand.Text()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+		ctx = logging.WithAttrs(ctx, slog.String("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// responseRecorder remembers the status and size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// accessLog logs every request once it has been served, with the route
+// pattern of the mux so requests to the same route can be grouped.
+func accessLog(mux *http.ServeMux) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			_, pattern := mux.Handler(r)
+
+			slog.InfoContext(
+				r.Context(),
+				"request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", pattern,
+				"status", status,
+				"bytes", rec.bytes,
+				"duration", time.Since(start),
+				"ip", clientIP(r),
+			)
+		})
+	}
+}
+
+// recoverPanics turns panics of handlers into a logged 500 response,
+// instead of net/http dropping the connection. Once the handler has sent the
+// header the status can no longer change, the connection is aborted instead so
+// the client does not take the partial response for a complete one.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			// the handler wants the connection aborted
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			slog.ErrorContext(
+				r.Context(),
+				"panic while serving request",
+				"method", r.Method,
+				"url", r.URL,
+				"err", fmt.Sprint(err),
+				"stack", string(debug.Stack()),
+			)
+
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/logging"
+)
+
+// captureLogs sends the default logger to a buffer for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewJSONHandler(&buf, nil))))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return &buf
+}
+
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+
+	named := func(name string) middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), named("first"), named("second"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if diff := cmp.Diff([]string{"first", "second", "handler"}, order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{
+			name:      "accepts the request id of the client",
+			requestID: "abc-123",
+		},
+		{
+			name:      "generates a request id when missing",
+			generated: true,
+		},
+		{
+			name:      "generates a request id when it holds control characters",
+			requestID: "abc\x00",
+			generated: true,
+		},
+		{
+			name:      "generates a request id when it is too long",
+			requestID: strings.Repeat("a", maxRequestIDLength+1),
+			generated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			var got string
+			handler := requestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = requestIDFromContext(r.Context())
+				slog.InfoContext(r.Context(), "handled")
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if tt.generated {
+				if got == "" || got == tt.requestID {
+					t.Errorf("expected a generated request id, got %q", got)
+				}
+			} else if got != tt.requestID {
+				t.Errorf("expected request id %q, got %q", tt.requestID, got)
+			}
+
+			if header := rec.Header().Get("X-Request-ID"); header != got {
+				t.Errorf("expected X-Request-ID header %q, got %q", got, header)
+			}
+
+			records := decodeLogs(t, logs)
+			if len(records) != 1 || records[0]["request_id"] != got {
+				t.Errorf("expected the log record to carry request id %q, got %v", got, records)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/genres/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	handler := chain(mux, requestIDs, accessLog(mux))
+
+	req := httptest.NewRequest("GET", "/api/v1/genres/1", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	req.RemoteAddr = "192.0.2.1:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := decodeLogs(t, logs)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 log record, got %d", len(records))
+	}
+
+	record := records[0]
+	if _, ok := record["duration"]; !ok {
+		t.Error("expected the duration to be logged")
+	}
+	delete(record, "time")
+	delete(record, "duration")
+
+	want := map[string]any{
+		"level":      "INFO",
+		"msg":        "request",
+		"method":     "GET",
+		"path":       "/api/v1/genres/1",
+		"route":      "GET /api/v1/genres/{id}",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(len("short and stout")),
+		"ip":         "192.0.2.1",
+		"request_id": "abc-123",
+	}
+	if diff := cmp.Diff(want, record); diff != "" {
+		t.Errorf("record mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	logs := captureLogs(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /panic", func(w http.ResponseWriter, r *http.Request) {
+		// readJSON panics when handed a non-pointer
+		var body struct{}
+		readJSON(w, r, body)
+	})
+
+	handler := chain(mux, requestIDs, accessLog(mux), recoverPanics)
+
+	req := httptest.NewRequest("POST", "/panic", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	records := decodeLogs(t, logs)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 log records, got %d", len(records))
+	}
+
+	if stack, _ := records[0]["stack"].(string); !strings.Contains(stack, "readJSON") {
+		t.Errorf("expected the stack trace to be logged, got %q", stack)
+	}
+
+	if records[1]["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("expected the access log to record status 500, got %v", records[1]["status"])
+	}
+}
+
+func TestRecoverPanicsAfterHeader(t *testing.T) {
+	logs := captureLogs(t)
+
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data":[`))
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("expected the connection to be aborted, got %v", err)
+		}
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected the sent status %d to remain, got %d", http.StatusOK, rec.Code)
+		}
+
+		if records := decodeLogs(t, logs); len(records) != 1 {
+			t.Errorf("expected the panic to be logged, got %d log records", len(records))
+		}
+	}()
+
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/genres", nil))
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcFlowCookieName = "movieland_oidc"
+	oidcFlowTTL        = 10 * time.Minute
+)
+
+// oidcFlow holds the values of a pending authorization request,
+// it lives in a short-lived cookie between the login and callback routes.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"return_to,omitempty"`
+}
+
+type oidcAuth struct {
+	cfg      config.OIDCConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	users    UserStore
+	sessions *sessionManager
+}
+
+func newOIDCAuth(ctx context.Context, cfg config.OIDCConfig, users UserStore, sessions *sessionManager) (*oidcAuth, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: could not discover provider: %w", err)
+	}
+
+	return &oidcAuth{
+		cfg: cfg,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       cfg.Scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		users:    users,
+		sessions: sessions,
+	}, nil
+}
+
+func (a *oidcAuth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := randomToken()
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	flow := oidcFlow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: safeReturnTo(r.URL.Query().Get("return_to")),
+	}
+
+	value, err := json.Marshal(flow)
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/auth",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   a.sessions.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	url := a.oauth2.AuthCodeURL(
+		flow.State,
+		oidc.Nonce(flow.Nonce),
+		oauth2.S256ChallengeOption(flow.Verifier),
+	)
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (a *oidcAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	flow, err := readOIDCFlow(r)
+
+	// the flow is single use, whatever the outcome
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    "",
+		Path:     "/auth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   a.sessions.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if err != nil {
+		handleBadRequest(w, "login flow expired or missing", nil)
+		return
+	}
+
+	query := r.URL.Query()
+
+	if errCode := query.Get("error"); errCode != "" {
+		slog.WarnContext(r.Context(), "oidc: provider returned an error", "error", errCode, "description", query.Get("error_description"))
+		handleUnauthorized(w, "authentication failed")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		handleBadRequest(w, "invalid state", nil)
+		return
+	}
+
+	token, err := a.oauth2.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc: could not exchange code", "err", err)
+		handleUnauthorized(w, "authentication failed")
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		slog.WarnContext(r.Context(), "oidc: token response did not contain an id_token")
+		handleUnauthorized(w, "authentication failed")
+		return
+	}
+
+	idToken, err := a.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc: could not verify id_token", "err", err)
+		handleUnauthorized(w, "authentication failed")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		slog.WarnContext(r.Context(), "oidc: id_token nonce mismatch")
+		handleUnauthorized(w, "authentication failed")
+		return
+	}
+
+	var claims map[string]any
+	if err = idToken.Claims(&claims); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	email, _ := claims["email"].(string)
+	if email == "" {
+		handleUnauthorized(w, "identity provider did not share an email address")
+		return
+	}
+
+	// an unverified address may belong to someone else, it must not name a user
+	if !emailVerified(claims) {
+		handleUnauthorized(w, "identity provider did not verify the email address")
+		return
+	}
+
+	user := &datastore.User{
+		Email:       strings.ToLower(email),
+		OIDCSubject: sql.NullString{String: idToken.Subject, Valid: true},
+	}
+
+	if name, _ := claims["name"].(string); name != "" {
+		user.Name = sql.NullString{String: name, Valid: true}
+	}
+
+	err = a.users.UpsertOIDCUser(r.Context(), user)
+	if err != nil {
+		if errors.Is(err, datastore.ErrUserEmailExists) {
+			handleConflict(w, "a user with this email already exists")
+			return
+		}
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	// the identity provider is the source of truth for roles once a mapping is configured
+	if len(a.cfg.RoleMapping) > 0 {
+		if err = a.users.SetUserRoles(r.Context(), user.ID, a.mapRoles(claims)); err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err = a.sessions.create(r.Context(), w, user); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	returnTo := flow.ReturnTo
+	if returnTo == "" {
+		returnTo = "/"
+	}
+
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+// emailVerified reads the email_verified claim, some providers send it as a
+// string.
+func emailVerified(claims map[string]any) bool {
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		return verified
+	case string:
+		return verified == "true"
+	default:
+		return false
+	}
+}
+
+// mapRoles translates the values of the configured roles claim into local roles.
+func (a *oidcAuth) mapRoles(claims map[string]any) []string {
+	var values []string
+
+	switch claim := claims[a.cfg.RolesClaim].(type) {
+	case string:
+		values = append(values, claim)
+	case []any:
+		for _, v := range claim {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	roles := []string{}
+	for _, v := range values {
+		if role, ok := a.cfg.RoleMapping[v]; ok {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+func readOIDCFlow(r *http.Request) (*oidcFlow, error) {
+	cookie, err := r.Cookie(oidcFlowCookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var flow oidcFlow
+	if err = json.Unmarshal(value, &flow); err != nil {
+		return nil, err
+	}
+
+	return &flow, nil
+}
+
+// safeReturnTo only allows local paths, to prevent open redirects.
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return ""
+	}
+	return returnTo
+}
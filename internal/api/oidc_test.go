@@ -0,0 +1,440 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+const fakeClientID = "movie-land"
+
+// fakeOIDCProvider is an in-process OpenID Connect provider, it hands out
+// codes through authorize and exchanges them for signed id tokens.
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	nonce     string
+	challenge string
+	claims    map[string]any
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	p := &fakeOIDCProvider{
+		key:   key,
+		codes: make(map[string]fakeAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}},
+		})
+	})
+	mux.HandleFunc("POST /token", p.handleToken(t))
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// authorize simulates a user signing in at the provider for the given
+// authorization request, it returns the code the provider redirects back with.
+func (p *fakeOIDCProvider) authorize(t *testing.T, authURL string, claims map[string]any) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("failed to parse authorization url: %v", err)
+	}
+
+	query := u.Query()
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("expected code_challenge_method S256, got %q", got)
+	}
+
+	code = rand.Text()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = fakeAuthorization{
+		nonce:     query.Get("nonce"),
+		challenge: query.Get("code_challenge"),
+		claims:    claims,
+	}
+
+	return code, query.Get("state")
+}
+
+func (p *fakeOIDCProvider) handleToken(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		p.mu.Lock()
+		auth, ok := p.codes[r.PostForm.Get("code")]
+		delete(p.codes, r.PostForm.Get("code"))
+		p.mu.Unlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(verifierHash[:]) != auth.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := map[string]any{
+			"iss":   p.server.URL,
+			"aud":   fakeClientID,
+			"sub":   "subject-1",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": auth.nonce,
+		}
+		for k, v := range auth.claims {
+			claims[k] = v
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     p.sign(t, claims),
+		})
+	}
+}
+
+func (p *fakeOIDCProvider) sign(t *testing.T, claims map[string]any) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: p.key, KeyID: "test"}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("failed to sign id token: %v", err)
+	}
+
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatalf("failed to serialize id token: %v", err)
+	}
+
+	return token
+}
+
+type oidcTestEnv struct {
+	provider *fakeOIDCProvider
+	mux      *http.ServeMux
+	users    map[string]*datastore.User
+	sessions *memorySessionStore
+}
+
+func newOIDCTestEnv(t *testing.T) *oidcTestEnv {
+	t.Helper()
+
+	env := &oidcTestEnv{
+		provider: newFakeOIDCProvider(t),
+		users:    make(map[string]*datastore.User),
+		sessions: newMemorySessionStore(),
+	}
+
+	userStore := &mockUserStore{
+		upsertOIDCUserFunc: func(ctx context.Context, user *datastore.User) error {
+			if existing, ok := env.users[user.OIDCSubject.String]; ok {
+				user.ID = existing.ID
+			} else {
+				user.ID = len(env.users) + 1
+			}
+			env.users[user.OIDCSubject.String] = user
+			env.sessions.users[user.ID] = user
+			return nil
+		},
+		setUserRolesFunc: func(ctx context.Context, userID int, roles []string) error {
+			env.sessions.users[userID].Roles = roles
+			return nil
+		},
+	}
+
+	sessions := newSessionManager(env.sessions, config.SessionConfig{TTL: time.Hour}, false)
+
+	auth, err := newOIDCAuth(context.Background(), config.OIDCConfig{
+		IssuerURL:    env.provider.server.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://movie-land.test/auth/callback",
+		Scopes:       []string{"openid", "profile", "email"},
+		RolesClaim:   "groups",
+		RoleMapping:  map[string]string{"ml-admins": "admin", "ml-editors": "editor"},
+	}, userStore, sessions)
+	if err != nil {
+		t.Fatalf("failed to create oidc auth: %v", err)
+	}
+
+	env.mux = http.NewServeMux()
+	registerAuthRoutes(env.mux, sessions, nil, nil, auth)
+
+	return env
+}
+
+// startLogin calls the login route and returns the authorization url and the flow cookie.
+func (env *oidcTestEnv) startLogin(t *testing.T, target string) (string, *http.Cookie) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", target, nil)
+	rec := httptest.NewRecorder()
+
+	env.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected status code %d, got %d", http.StatusFound, rec.Code)
+	}
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcFlowCookieName {
+			return rec.Header().Get("Location"), c
+		}
+	}
+
+	t.Fatal("no oidc flow cookie set")
+	return "", nil
+}
+
+func (env *oidcTestEnv) callback(query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/auth/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+
+	env.mux.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Run("signs in the user, maps the roles and redirects back", func(t *testing.T) {
+		env := newOIDCTestEnv(t)
+
+		authURL, cookie := env.startLogin(t, "/auth/login?return_to=/admin/genres")
+		code, state := env.provider.authorize(t, authURL, map[string]any{
+			"email":          "Jane@Example.com",
+			"email_verified": true,
+			"name":           "Jane",
+			"groups":         []string{"ml-editors", "unrelated"},
+		})
+
+		rec := env.callback(url.Values{"code": {code}, "state": {state}}, cookie)
+
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusSeeOther, rec.Code, rec.Body)
+		}
+
+		if location := rec.Header().Get("Location"); location != "/admin/genres" {
+			t.Errorf("expected redirect to /admin/genres, got %q", location)
+		}
+
+		user, ok := env.users["subject-1"]
+		if !ok {
+			t.Fatal("expected user to be stored")
+		}
+
+		if user.Email != "jane@example.com" {
+			t.Errorf("expected lowercased email, got %q", user.Email)
+		}
+
+		if diff := cmp.Diff([]string{"editor"}, user.Roles); diff != "" {
+			t.Errorf("roles mismatch (-want +got):\n%s", diff)
+		}
+
+		var sessionCookie *http.Cookie
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == sessionCookieName {
+				sessionCookie = c
+			}
+		}
+
+		if sessionCookie == nil {
+			t.Fatal("expected a session cookie")
+		}
+
+		req := httptest.NewRequest("GET", "/api/v1/me", nil)
+		req.AddCookie(sessionCookie)
+		meRec := httptest.NewRecorder()
+		env.mux.ServeHTTP(meRec, req)
+
+		if meRec.Code != http.StatusOK {
+			t.Fatalf("expected the session to be usable, got status %d", meRec.Code)
+		}
+	})
+
+	t.Run("ignores a return_to pointing to another host", func(t *testing.T) {
+		env := newOIDCTestEnv(t)
+
+		authURL, cookie := env.startLogin(t, "/auth/login?return_to=//evil.example.com")
+		code, state := env.provider.authorize(t, authURL, map[string]any{"email": "jane@example.com", "email_verified": true})
+
+		rec := env.callback(url.Values{"code": {code}, "state": {state}}, cookie)
+
+		if location := rec.Header().Get("Location"); location != "/" {
+			t.Errorf("expected redirect to /, got %q", location)
+		}
+	})
+
+	t.Run("returns status 400 when the state does not match", func(t *testing.T) {
+		env := newOIDCTestEnv(t)
+
+		authURL, cookie := env.startLogin(t, "/auth/login")
+		code, _ := env.provider.authorize(t, authURL, map[string]any{"email": "jane@example.com"})
+
+		rec := env.callback(url.Values{"code": {code}, "state": {"forged"}}, cookie)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+
+		if len(env.users) != 0 {
+			t.Error("expected no user to be stored")
+		}
+	})
+
+	t.Run("returns status 400 without the flow cookie", func(t *testing.T) {
+		env := newOIDCTestEnv(t)
+
+		authURL, _ := env.startLogin(t, "/auth/login")
+		code, state := env.provider.authorize(t, authURL, map[string]any{"email": "jane@example.com"})
+
+		rec := env.callback(url.Values{"code": {code}, "state": {state}}, nil)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("returns status 401 when the id token nonce does not match", func(t *testing.T) {
+		env := newOIDCTestEnv(t)
+
+		authURL, cookie := env.startLogin(t, "/auth/login")
+		code, state := env.provider.authorize(t, authURL, map[string]any{
+			"email": "jane@example.com",
+			"nonce": "replayed",
+		})
+
+		rec := env.callback(url.Values{"code": {code}, "state": {state}}, cookie)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("returns status 401 when the code verifier does not match", func(t *testing.T) {
+		env := newOIDCTestEnv(t)
+
+		authURL, _ := env.startLogin(t, "/auth/login")
+		code, state := env.provider.authorize(t, authURL, map[string]any{"email": "jane@example.com"})
+
+		// a flow cookie of another login attempt carries another verifier
+		_, otherCookie := env.startLogin(t, "/auth/login")
+		flow, err := readOIDCFlow(&http.Request{Header: http.Header{"Cookie": {otherCookie.String()}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		flow.State = state
+		value, _ := json.Marshal(flow)
+		otherCookie.Value = base64.RawURLEncoding.EncodeToString(value)
+
+		rec := env.callback(url.Values{"code": {code}, "state": {state}}, otherCookie)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("returns status 401 when the email is not verified", func(t *testing.T) {
+		for _, claims := range []map[string]any{
+			{"email": "jane@example.com", "email_verified": false},
+			{"email": "jane@example.com", "email_verified": "false"},
+			{"email": "jane@example.com"},
+		} {
+			env := newOIDCTestEnv(t)
+
+			authURL, cookie := env.startLogin(t, "/auth/login")
+			code, state := env.provider.authorize(t, authURL, claims)
+
+			rec := env.callback(url.Values{"code": {code}, "state": {state}}, cookie)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("expected status code %d for claims %v, got %d", http.StatusUnauthorized, claims, rec.Code)
+			}
+
+			if len(env.users) != 0 {
+				t.Errorf("expected no user to be stored for claims %v", claims)
+			}
+		}
+	})
+
+	t.Run("returns status 401 when the provider reports an error", func(t *testing.T) {
+		env := newOIDCTestEnv(t)
+
+		_, cookie := env.startLogin(t, "/auth/login")
+
+		rec := env.callback(url.Values{"error": {"access_denied"}}, cookie)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+}
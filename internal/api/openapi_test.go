@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+// patternRecorder records the patterns routes are registered with.
+type patternRecorder struct {
+	patterns []string
+}
+
+func (p *patternRecorder) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	p.patterns = append(p.patterns, pattern)
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	sessions := newSessionManager(newMemorySessionStore(), config.SessionConfig{TTL: time.Hour}, false)
+
+	// register every optional route as well
+	mux := &patternRecorder{}
+	registerRoutes(mux, &mockGenreStore{})
+	registerAuthRoutes(mux, sessions, &accounts{}, &twoFactor{}, &oidcAuth{})
+	registerUserRoutes(mux, sessions, &mockUserStore{}, nil)
+	registerAuditRoutes(mux, sessions, &mockAuditStore{})
+	registerCatalogRoutes(mux, sessions, &mockCatalogStore{})
+	registerHealthRoutes(mux, &health{})
+
+	var documented []string
+	for _, op := range apiOperations {
+		documented = append(documented, op.pattern)
+	}
+
+	for _, pattern := range mux.patterns {
+		if !slices.Contains(documented, pattern) {
+			t.Errorf("route %q is missing from apiOperations", pattern)
+		}
+	}
+
+	for _, pattern := range documented {
+		if !slices.Contains(mux.patterns, pattern) {
+			t.Errorf("apiOperations documents %q, which is not registered", pattern)
+		}
+	}
+}
+
+func TestGetOpenAPI(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux, &mockGenreStore{})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.OpenAPI != "3.1.0" {
+		t.Errorf("expected openapi 3.1.0, got %q", spec.OpenAPI)
+	}
+
+	get := spec.Paths["/api/v1/genres/{id}"]["get"]
+	if get["operationId"] != "getApiV1GenresId" {
+		t.Errorf("expected operationId getApiV1GenresId, got %v", get["operationId"])
+	}
+
+	wantGenre := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":         map[string]any{"type": "integer"},
+			"slug":       map[string]any{"type": "string"},
+			"name":       map[string]any{"type": "string"},
+			"created_at": map[string]any{"type": "string", "format": "date-time"},
+		},
+		"required": []any{"id", "slug", "created_at"},
+	}
+	if diff := cmp.Diff(wantGenre, spec.Components.Schemas["GenreDto"]); diff != "" {
+		t.Errorf("GenreDto schema mismatch (-want +got):\n%s", diff)
+	}
+
+	wantInput := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"slug": map[string]any{"type": "string"},
+			"name": map[string]any{"type": "string"},
+		},
+		"required": []any{"slug"},
+	}
+	if diff := cmp.Diff(wantInput, spec.Components.Schemas["GenreInput"]); diff != "" {
+		t.Errorf("GenreInput schema mismatch (-want +got):\n%s", diff)
+	}
+
+	wantRequired := map[string]any{
+		"GraphQLRequest":       []any{"query"},
+		"LoginInput":           []any{"email", "password"},
+		"TwoFactorVerifyInput": nil,
+	}
+	gotRequired := map[string]any{}
+	for name := range wantRequired {
+		gotRequired[name] = spec.Components.Schemas[name]["required"]
+	}
+	if diff := cmp.Diff(wantRequired, gotRequired); diff != "" {
+		t.Errorf("required fields of the request bodies mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// the error helpers build their bodies by hand, make sure ErrorDto documents them
+func TestErrorDtoDocumentsErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleBadRequest(rec, "", []string{"slug is required"})
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := newSchemaGenerator()
+	schemas.schema(reflect.TypeFor[ErrorDto]())
+	properties := schemas.components["ErrorDto"].(map[string]any)["properties"].(map[string]any)
+
+	for key := range body {
+		if _, ok := properties[key]; !ok {
+			t.Errorf("error response has %q, which ErrorDto lacks", key)
+		}
+	}
+}
+
+func TestGetDocs(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux, &mockGenreStore{})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/docs", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("expected an html page, got %q", ct)
+	}
+
+	if body := rec.Body.String(); strings.Contains(body, "https://") {
+		t.Errorf("expected the page to load nothing from elsewhere, got %s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/docs/redoc.standalone.js", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d for the bundle, got %d", http.StatusOK, rec.Code)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/javascript; charset=utf-8" {
+		t.Errorf("expected a script, got %q", ct)
+	}
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/ratelimit"
+	movielandv1 "github.com/tommarien/movie-land/proto/movieland/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcWriteMethods are limited as writes, the other gRPC methods as reads.
+var grpcWriteMethods = []string{
+	movielandv1.GenreService_CreateGenre_FullMethodName,
+	movielandv1.GenreService_UpdateGenre_FullMethodName,
+}
+
+// rateLimiter limits the requests per client, reads and writes (like
+// POST /api/v1/genres) take from separate buckets. The group of a route is
+// configured by its pattern, routes without one are grouped by method. Clients
+// sending a configured API key are limited per key, clients with a session per user,
+// internal callers with a client certificate per identity and the others per
+// IP address. It expects to run after sessionManager.loadSession and
+// clientIdentities.middleware.
+//
+// The limits are read from the runtime config on every request, so reloads
+// change them and can switch limiting off and on.
+type rateLimiter struct {
+	rt      *config.Runtime
+	limiter ratelimit.Limiter
+	mux     *http.ServeMux
+}
+
+func newRateLimiter(rt *config.Runtime, limiter ratelimit.Limiter, mux *http.ServeMux) *rateLimiter {
+	return &rateLimiter{rt: rt, limiter: limiter, mux: mux}
+}
+
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := rl.rt.Current().RateLimit
+
+		// load balancers probing health should never be limited
+		if !cfg.Enabled || isHealthProbe(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		group := rl.group(r, cfg)
+
+		limit := ratelimit.Limit{Requests: cfg.ReadRequests, Period: cfg.ReadPeriod}
+		if group == config.RateLimitGroupWrite {
+			limit = ratelimit.Limit{Requests: cfg.WriteRequests, Period: cfg.WritePeriod}
+		}
+
+		result, err := rl.limiter.Allow(r.Context(), group+":"+bucketKey(r, cfg), limit)
+		if err != nil {
+			// rather serve than fail every request while the backend is unavailable
+			slog.ErrorContext(r.Context(), "rate limiter failed", "method", r.Method, "url", r.URL, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Period.Seconds())))
+		h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		h.Set("RateLimit-Reset", retryAfterSeconds(result.Reset))
+
+		if !result.Allowed {
+			handleTooManyRequests(w, "rate limit exceeded", result.RetryAfter)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// group returns the group configured for the route of the request, or the
+// one of its method.
+func (rl *rateLimiter) group(r *http.Request, cfg config.RateLimitConfig) string {
+	_, pattern := rl.mux.Handler(r)
+	if group, ok := cfg.Groups[pattern]; ok {
+		return group
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return config.RateLimitGroupRead
+	default:
+		return config.RateLimitGroupWrite
+	}
+}
+
+// bucketKey identifies the client by its API key before anything else, keys
+// are hashed as the buckets may be stored in the database.
+func bucketKey(r *http.Request, cfg config.RateLimitConfig) string {
+	if cfg.APIKeyHeader != "" {
+		if key, ok := apiKeyBucket(r.Header.Get(cfg.APIKeyHeader), cfg.APIKeys); ok {
+			return key
+		}
+	}
+
+	return clientKey(r)
+}
+
+// apiKeyBucket returns the bucket of the API key when it is one of the
+// configured keys. Unknown keys get none, every made up key would otherwise
+// get a fresh bucket.
+func apiKeyBucket(key string, keys []string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	hash := hashToken(key)
+
+	known := false
+	for _, k := range keys {
+		// compare the hashes, so the time taken does not depend on the key
+		if subtle.ConstantTimeCompare(hash, hashToken(k)) == 1 {
+			known = true
+		}
+	}
+
+	if !known {
+		return "", false
+	}
+
+	return "key:" + hex.EncodeToString(hash), true
+}
+
+func clientKey(r *http.Request) string {
+	if session := sessionFromContext(r.Context()); session != nil {
+		return "user:" + strconv.Itoa(session.UserID)
+	}
+
+	if identity := clientIdentityFromContext(r.Context()); identity != "" {
+		return "client:" + identity
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+// grpcInterceptor limits the calls of the gRPC API from the same buckets as
+// the requests of the REST API, rejected calls get ResourceExhausted. It
+// expects to run after clientIdentities.grpcInterceptor.
+func (rl *rateLimiter) grpcInterceptor(ctx context.Context, method string) (context.Context, error) {
+	cfg := rl.rt.Current().RateLimit
+
+	// health checks should never be limited
+	if !cfg.Enabled || strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		return ctx, nil
+	}
+
+	group, limit := config.RateLimitGroupRead, ratelimit.Limit{Requests: cfg.ReadRequests, Period: cfg.ReadPeriod}
+	if slices.Contains(grpcWriteMethods, method) {
+		group, limit = config.RateLimitGroupWrite, ratelimit.Limit{Requests: cfg.WriteRequests, Period: cfg.WritePeriod}
+	}
+
+	result, err := rl.limiter.Allow(ctx, group+":"+grpcBucketKey(ctx, cfg), limit)
+	if err != nil {
+		// rather serve than fail every call while the backend is unavailable
+		slog.ErrorContext(ctx, "rate limiter failed", "method", method, "err", err)
+		return ctx, nil
+	}
+
+	if !result.Allowed {
+		return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ss", retryAfterSeconds(result.RetryAfter))
+	}
+
+	return ctx, nil
+}
+
+// grpcBucketKey identifies the caller like bucketKey, the API key is read
+// from the metadata.
+func grpcBucketKey(ctx context.Context, cfg config.RateLimitConfig) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && cfg.APIKeyHeader != "" {
+		if keys := md.Get(cfg.APIKeyHeader); len(keys) > 0 {
+			if key, ok := apiKeyBucket(keys[0], cfg.APIKeys); ok {
+				return key
+			}
+		}
+	}
+
+	if identity := clientIdentityFromContext(ctx); identity != "" {
+		return "client:" + identity
+	}
+
+	return "ip:" + grpcPeerIP(ctx)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/ratelimit"
+)
+
+func TestRateLimiter(t *testing.T) {
+	user := &datastore.User{ID: 1, Email: "jane@example.com"}
+	sessions := newSessionManager(newMemorySessionStore(user), config.SessionConfig{TTL: time.Hour}, false)
+
+	cfg := config.RateLimitConfig{
+		Enabled:       true,
+		ReadRequests:  2,
+		ReadPeriod:    time.Minute,
+		WriteRequests: 1,
+		WritePeriod:   time.Minute,
+		APIKeyHeader:  "X-API-Key",
+		APIKeys:       []string{"key-1", "key-2"},
+		Groups:        map[string]string{"POST /graphql": config.RateLimitGroupRead},
+	}
+
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"GET /healtz", "GET /api/v1/genres", "POST /api/v1/genres", "POST /graphql"} {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	handler := sessions.loadSession(newRateLimiter(config.NewRuntime(&config.Config{RateLimit: cfg}, nil), ratelimit.NewMemoryLimiter(), mux).middleware(mux))
+
+	doWithKey := func(method, target, remoteAddr string, cookie *http.Cookie, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remoteAddr
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	do := func(method, target, remoteAddr string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		return doWithKey(method, target, remoteAddr, cookie, "")
+	}
+
+	t.Run("limits the reads of a client and sets the headers", func(t *testing.T) {
+		var codes []int
+		for range 3 {
+			codes = append(codes, do("GET", "/api/v1/genres", "198.51.100.1:1234", nil).Code)
+		}
+
+		if diff := cmp.Diff([]int{204, 204, 429}, codes); diff != "" {
+			t.Errorf("status codes mismatch (-want +got):\n%s", diff)
+		}
+
+		rec := do("GET", "/api/v1/genres", "198.51.100.1:1234", nil)
+
+		want := map[string]string{
+			"RateLimit-Policy":    "2;w=60",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "0",
+			"RateLimit-Reset":     "60",
+			"Retry-After":         "30",
+		}
+		got := make(map[string]string)
+		for k := range want {
+			got[k] = rec.Header().Get(k)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("headers mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("limits writes separately from reads", func(t *testing.T) {
+		var codes []int
+		for range 2 {
+			codes = append(codes, do("POST", "/api/v1/genres", "198.51.100.2:1234", nil).Code)
+		}
+		codes = append(codes, do("GET", "/api/v1/genres", "198.51.100.2:1234", nil).Code)
+
+		if diff := cmp.Diff([]int{204, 429, 204}, codes); diff != "" {
+			t.Errorf("status codes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("limits a user across IP addresses", func(t *testing.T) {
+		cookie := login(t, sessions, user)
+
+		var codes []int
+		for _, addr := range []string{"198.51.100.3:1234", "198.51.100.4:1234"} {
+			codes = append(codes, do("POST", "/api/v1/genres", addr, cookie).Code)
+		}
+
+		if diff := cmp.Diff([]int{204, 429}, codes); diff != "" {
+			t.Errorf("status codes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("limits an API key before the user and IP address", func(t *testing.T) {
+		cookie := login(t, sessions, user)
+
+		var codes []int
+		codes = append(codes, doWithKey("POST", "/api/v1/genres", "198.51.100.6:1234", cookie, "key-1").Code)
+		codes = append(codes, doWithKey("POST", "/api/v1/genres", "198.51.100.7:1234", nil, "key-1").Code)
+		codes = append(codes, doWithKey("POST", "/api/v1/genres", "198.51.100.6:1234", cookie, "key-2").Code)
+
+		if diff := cmp.Diff([]int{204, 429, 204}, codes); diff != "" {
+			t.Errorf("status codes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("limits unknown API keys like requests without one", func(t *testing.T) {
+		var codes []int
+		for _, key := range []string{"made-up-1", "made-up-2", "made-up-3"} {
+			codes = append(codes, doWithKey("POST", "/api/v1/genres", "198.51.100.9:1234", nil, key).Code)
+		}
+
+		if diff := cmp.Diff([]int{204, 429, 429}, codes); diff != "" {
+			t.Errorf("status codes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("groups the configured routes by pattern", func(t *testing.T) {
+		var codes []int
+		for range 3 {
+			codes = append(codes, do("POST", "/graphql", "198.51.100.8:1234", nil).Code)
+		}
+
+		if diff := cmp.Diff([]int{204, 204, 429}, codes); diff != "" {
+			t.Errorf("status codes mismatch (-want +got):\n%s", diff)
+		}
+
+		if rec := do("POST", "/api/v1/genres", "198.51.100.8:1234", nil); rec.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d for a write, got %d", http.StatusNoContent, rec.Code)
+		}
+	})
+
+	t.Run("does not limit the health check", func(t *testing.T) {
+		for range 3 {
+			if rec := do("GET", "/healtz", "198.51.100.5:1234", nil); rec.Code != http.StatusNoContent {
+				t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+			}
+		}
+	})
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	rt := config.NewRuntime(&config.Config{RateLimit: config.RateLimitConfig{ReadRequests: 1, ReadPeriod: time.Minute}}, nil)
+
+	handler := newRateLimiter(rt, ratelimit.NewMemoryLimiter(), http.NewServeMux()).middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+
+	for range 3 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/genres", nil))
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+		}
+		if h := rec.Header().Get("RateLimit-Limit"); h != "" {
+			t.Errorf("expected no rate limit headers, got RateLimit-Limit %q", h)
+		}
+	}
+}
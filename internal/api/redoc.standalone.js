@@ -0,0 +1,3 @@
+// The Redoc bundle has not been vendored yet, run make redoc to replace this
+// file with redoc.standalone.js.
+document.querySelector("redoc").textContent = "Run make redoc to vendor the Redoc bundle.";
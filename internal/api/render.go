@@ -0,0 +1,302 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeCSV    = "text/csv"
+	mediaTypeXML    = "application/xml"
+	mediaTypeNDJSON = "application/x-ndjson"
+)
+
+// renderMediaTypes are the representations a renderer offers, the first one
+// is served to clients that accept anything.
+var renderMediaTypes = []string{mediaTypeJSON, mediaTypeCSV, mediaTypeXML, mediaTypeNDJSON}
+
+// record is implemented by the DTOs a renderer writes, to render them as rows
+// of CSV. csvHeader is called on the zero value too, for lists without rows.
+type record interface {
+	csvHeader() []string
+	csvRecord() []string
+}
+
+// renderer writes a DTO or a list of them in the representation negotiated
+// with the Accept header. JSON wraps them in the {"data": ...} envelope like
+// writeJSON does, XML wraps lists in an element named after the list.
+type renderer struct {
+	w         http.ResponseWriter
+	mediaType string
+	listName  string
+	itemName  string
+}
+
+// negotiateRenderer picks the representation the client prefers, it responds
+// with 406 Not Acceptable and returns false when it accepts none of them.
+func negotiateRenderer(w http.ResponseWriter, r *http.Request, listName, itemName string) (*renderer, bool) {
+	w.Header().Add("Vary", "Accept")
+
+	mediaType, ok := negotiate(r.Header.Get("Accept"), renderMediaTypes)
+	if !ok {
+		handleNotAcceptable(w, "supported media types are "+strings.Join(renderMediaTypes, ", "))
+		return nil, false
+	}
+
+	return &renderer{w: w, mediaType: mediaType, listName: listName, itemName: itemName}, true
+}
+
+func (rd *renderer) writeHeader(status int) {
+	contentType := rd.mediaType
+	switch rd.mediaType {
+	case mediaTypeCSV, mediaTypeXML:
+		contentType += "; charset=utf-8"
+	}
+
+	rd.w.Header().Set("Content-Type", contentType)
+	rd.w.Header().Set("X-Content-Type-Options", "nosniff")
+	rd.w.WriteHeader(status)
+}
+
+// one writes a single DTO.
+func (rd *renderer) one(status int, item record) error {
+	if rd.mediaType == mediaTypeJSON {
+		return writeJSON(rd.w, status, map[string]any{"data": item}, nil)
+	}
+
+	rd.writeHeader(status)
+
+	switch rd.mediaType {
+	case mediaTypeCSV:
+		cw := csv.NewWriter(rd.w)
+		cw.Write(item.csvHeader())
+		cw.Write(csvSafe(item.csvRecord()))
+		cw.Flush()
+		return cw.Error()
+	case mediaTypeXML:
+		io.WriteString(rd.w, xml.Header)
+		enc := xml.NewEncoder(rd.w)
+		if err := enc.EncodeElement(item, xml.StartElement{Name: xml.Name{Local: rd.itemName}}); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return json.NewEncoder(rd.w).Encode(item)
+	}
+}
+
+// list starts writing a list, the items are written as they are handed to
+// the listWriter, so the list is never encoded as a whole in memory.
+// The status is sent right away, so errors after this can only abort the
+// response. header is the CSV header row, written even when the list is empty.
+func (rd *renderer) list(status int, header []string) (*listWriter, error) {
+	lw := &listWriter{rd: rd, header: header}
+
+	if rd.mediaType == mediaTypeJSON {
+		rd.w.Header().Set("Content-Type", mediaTypeJSON)
+		rd.w.Header().Set("X-Content-Type-Options", "nosniff")
+		rd.w.WriteHeader(status)
+		_, err := io.WriteString(rd.w, `{"data":[`)
+		return lw, err
+	}
+
+	rd.writeHeader(status)
+
+	switch rd.mediaType {
+	case mediaTypeCSV:
+		lw.csv = csv.NewWriter(rd.w)
+	case mediaTypeXML:
+		io.WriteString(rd.w, xml.Header)
+		lw.xml = xml.NewEncoder(rd.w)
+		return lw, lw.xml.EncodeToken(xml.StartElement{Name: xml.Name{Local: rd.listName}})
+	default:
+		lw.json = json.NewEncoder(rd.w)
+	}
+
+	return lw, nil
+}
+
+// renderEach writes the items each hands it as a list, mapping each to its
+// DTO as it goes. The list starts with the first item, so when each fails
+// before that sent is false and the caller can still answer with an error.
+func renderEach[T any, R record](rd *renderer, status int, each func(func(T) error) error, mapItem func(T) R) (sent bool, err error) {
+	var zero R
+	var lw *listWriter
+
+	err = each(func(item T) error {
+		if lw == nil {
+			var err error
+			if lw, err = rd.list(status, zero.csvHeader()); err != nil {
+				return err
+			}
+		}
+		return lw.write(mapItem(item))
+	})
+	if err != nil {
+		return lw != nil, err
+	}
+
+	if lw == nil {
+		if lw, err = rd.list(status, zero.csvHeader()); err != nil {
+			return true, err
+		}
+	}
+
+	return true, lw.close()
+}
+
+type listWriter struct {
+	rd     *renderer
+	header []string
+	count  int
+
+	csv  *csv.Writer
+	xml  *xml.Encoder
+	json *json.Encoder
+}
+
+func (lw *listWriter) write(item record) error {
+	defer func() { lw.count++ }()
+
+	switch lw.rd.mediaType {
+	case mediaTypeJSON:
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if lw.count > 0 {
+			if _, err := io.WriteString(lw.rd.w, ","); err != nil {
+				return err
+			}
+		}
+		_, err = lw.rd.w.Write(b)
+		return err
+	case mediaTypeCSV:
+		if lw.count == 0 {
+			lw.csv.Write(lw.header)
+		}
+		return lw.csv.Write(csvSafe(item.csvRecord()))
+	case mediaTypeXML:
+		return lw.xml.EncodeElement(item, xml.StartElement{Name: xml.Name{Local: lw.rd.itemName}})
+	default:
+		return lw.json.Encode(item)
+	}
+}
+
+// close ends the list, an empty CSV list still gets its header row.
+func (lw *listWriter) close() error {
+	switch lw.rd.mediaType {
+	case mediaTypeJSON:
+		_, err := io.WriteString(lw.rd.w, "]}")
+		return err
+	case mediaTypeCSV:
+		if lw.count == 0 {
+			lw.csv.Write(lw.header)
+		}
+		lw.csv.Flush()
+		return lw.csv.Error()
+	case mediaTypeXML:
+		if err := lw.xml.EncodeToken(xml.EndElement{Name: xml.Name{Local: lw.rd.listName}}); err != nil {
+			return err
+		}
+		return lw.xml.Close()
+	default:
+		return nil
+	}
+}
+
+// csvSafe defuses values spreadsheets would evaluate as formulas, by
+// prefixing them with a quote.
+func csvSafe(values []string) []string {
+	for i, v := range values {
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			values[i] = "'" + v
+		}
+	}
+	return values
+}
+
+// negotiate returns the offer the Accept header prefers, by quality and then
+// by the order of the offers. Without an Accept header the first offer is
+// preferred, ok is false when none of the offers is acceptable.
+func negotiate(accept string, offers []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			continue
+		}
+
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) != "q" {
+				continue
+			}
+			if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && v >= 0 && v <= 1 {
+				q = v
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+
+	return ranges
+}
+
+// acceptQuality returns the quality of the most specific range matching the
+// media type, 0 when none matches.
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch r.mediaType {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+
+	return q
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     string
+		expected   string
+		acceptable bool
+	}{
+		{
+			name:       "prefers the first offer without an Accept header",
+			expected:   mediaTypeJSON,
+			acceptable: true,
+		},
+		{
+			name:       "prefers the first offer for any media type",
+			accept:     "*/*",
+			expected:   mediaTypeJSON,
+			acceptable: true,
+		},
+		{
+			name:       "picks the accepted media type",
+			accept:     "text/csv",
+			expected:   mediaTypeCSV,
+			acceptable: true,
+		},
+		{
+			name:       "picks the media type of the highest quality",
+			accept:     "application/json;q=0.5, application/xml, */*;q=0.1",
+			expected:   mediaTypeXML,
+			acceptable: true,
+		},
+		{
+			name:       "lets a specific range override a wildcard",
+			accept:     "application/*, application/json;q=0.2",
+			expected:   mediaTypeXML,
+			acceptable: true,
+		},
+		{
+			name:       "matches a subtype wildcard",
+			accept:     "text/*",
+			expected:   mediaTypeCSV,
+			acceptable: true,
+		},
+		{
+			name:   "refuses when no offer is accepted",
+			accept: "text/html, application/pdf",
+		},
+		{
+			name:   "refuses media types of quality 0",
+			accept: "application/json;q=0, text/csv;q=0, application/xml;q=0, application/x-ndjson;q=0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := negotiate(tt.accept, renderMediaTypes)
+
+			if ok != tt.acceptable {
+				t.Fatalf("expected acceptable %v, got %v", tt.acceptable, ok)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
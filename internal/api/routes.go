@@ -3,22 +3,168 @@ package api
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/tommarien/movie-land/internal/datastore"
 )
 
 type GenreStore interface {
-	ListGenres(ctx context.Context) ([]*datastore.Genre, error)
+	EachGenre(ctx context.Context, fn func(*datastore.Genre) error) error
 	GetGenre(ctx context.Context, ID int) (*datastore.Genre, error)
 	InsertGenre(ctx context.Context, genre *datastore.Genre) error
+	UpdateGenre(ctx context.Context, genre *datastore.Genre) error
+	ListGenresPage(ctx context.Context, filter datastore.GenreFilter) ([]*datastore.Genre, error)
+	GetGenresByIDs(ctx context.Context, IDs []int) ([]*datastore.Genre, error)
+	GetGenresBySlugs(ctx context.Context, slugs []string) ([]*datastore.Genre, error)
+}
+
+type CatalogStore interface {
+	ExportGenres(ctx context.Context, fn func(*datastore.Genre) error) error
+	ImportGenres(ctx context.Context, next func() (*datastore.Genre, error)) (*datastore.ImportResult, error)
+}
+
+type UserStore interface {
+	GetUser(ctx context.Context, ID int) (*datastore.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*datastore.User, error)
+	UpsertOIDCUser(ctx context.Context, user *datastore.User) error
+	SetUserRoles(ctx context.Context, userID int, roles []string) error
+}
+
+type UserTokenStore interface {
+	IssueUserToken(ctx context.Context, token *datastore.UserToken, limit int, since time.Time) error
+	ConfirmEmailVerification(ctx context.Context, tokenHash []byte) error
+	ResetPassword(ctx context.Context, tokenHash []byte, passwordHash []byte) (int, error)
+}
+
+type TOTPStore interface {
+	SetUserTOTPSecret(ctx context.Context, userID int, secret []byte) error
+	EnableUserTOTP(ctx context.Context, userID int, recoveryCodeHashes [][]byte) error
+	DisableUserTOTP(ctx context.Context, userID int) error
+	ConsumeTOTPStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) error
+}
+
+type ThrottleStore interface {
+	RecordAuthAttempt(ctx context.Context, scope, key string, at, resetBefore time.Time) (before, after *datastore.AuthThrottle, err error)
+	ForgiveAuthFailure(ctx context.Context, scope, key string) error
+	LockAuthThrottle(ctx context.Context, scope, key string, until time.Time) error
+	ClearAuthThrottle(ctx context.Context, scope, key string) error
+	InsertAuthEvent(ctx context.Context, event *datastore.AuthEvent) error
+}
+
+type SessionStore interface {
+	InsertSession(ctx context.Context, session *datastore.Session) error
+	GetSession(ctx context.Context, tokenHash []byte) (*datastore.Session, error)
+	MarkSessionMFAVerified(ctx context.Context, tokenHash []byte) error
+	DeleteSession(ctx context.Context, tokenHash []byte) error
+}
+
+type HealthStore interface {
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (int64, error)
+}
+
+type IdempotencyStore interface {
+	ClaimIdempotencyKey(ctx context.Context, scope, key string, fingerprint []byte, expiresAt time.Time) (*datastore.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, scope, key string, record *datastore.IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+	DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time) error
+}
+
+type AuditStore interface {
+	ListAuditEvents(ctx context.Context, filter datastore.AuditEventFilter) ([]*datastore.AuditEvent, error)
+}
+
+// router is implemented by *http.ServeMux, tests record the registered patterns through it.
+type router interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
 }
 
 func registerRoutes(
-	mux *http.ServeMux,
+	mux router,
 	genreStore GenreStore) {
 	mux.HandleFunc("GET /healtz", handleHealtzIndex)
 
 	mux.HandleFunc("GET /api/v1/genres", handleGenreIndex(genreStore))
 	mux.HandleFunc("GET /api/v1/genres/{id}", handleGenreGet(genreStore))
 	mux.HandleFunc("POST /api/v1/genres", handleGenrePost(genreStore))
+
+	mux.HandleFunc("GET /graphql", handleGraphQL(genreStore))
+	mux.HandleFunc("POST /graphql", handleGraphQL(genreStore))
+
+	mux.HandleFunc("GET /api/openapi.json", handleOpenAPIGet)
+	mux.HandleFunc("GET /api/docs", handleDocsGet)
+	mux.HandleFunc("GET /api/docs/redoc.standalone.js", handleRedocGet)
+}
+
+// registerAuthRoutes registers the session bound routes, the password login,
+// two-factor and OIDC login routes are only registered when accounts,
+// twoFactor and oidc are configured.
+func registerAuthRoutes(
+	mux router,
+	sessions *sessionManager,
+	accounts *accounts,
+	twoFactor *twoFactor,
+	oidc *oidcAuth) {
+	mux.HandleFunc("POST /auth/logout", handleLogout(sessions))
+	mux.HandleFunc("GET /api/v1/me", sessions.requireUser(handleMeGet))
+
+	if accounts != nil {
+		mux.HandleFunc("POST /auth/login", accounts.handleLogin)
+		mux.HandleFunc("POST /auth/email-verification", accounts.handleEmailVerificationRequest)
+		mux.HandleFunc("POST /auth/email-verification/confirm", accounts.handleEmailVerificationConfirm)
+		mux.HandleFunc("POST /auth/password-reset", accounts.handlePasswordResetRequest)
+		mux.HandleFunc("POST /auth/password-reset/confirm", accounts.handlePasswordResetConfirm)
+	}
+
+	if twoFactor != nil {
+		mux.HandleFunc("POST /auth/2fa/enroll", sessions.requireUser(twoFactor.handleEnroll))
+		mux.HandleFunc("POST /auth/2fa/enable", sessions.requireUser(twoFactor.handleEnable))
+		mux.HandleFunc("POST /auth/2fa/verify", sessions.requireSession(twoFactor.handleVerify))
+		mux.HandleFunc("POST /auth/2fa/disable", sessions.requireUser(sessions.requireStepUp(twoFactor.handleDisable)))
+	}
+
+	if oidc != nil {
+		mux.HandleFunc("GET /auth/login", oidc.handleLogin)
+		mux.HandleFunc("GET /auth/callback", oidc.handleCallback)
+	}
+}
+
+// registerUserRoutes registers the user management routes, changes to roles
+// require a recent second factor.
+func registerUserRoutes(
+	mux router,
+	sessions *sessionManager,
+	userStore UserStore,
+	lockout *lockout) {
+	mux.HandleFunc("PUT /api/v1/users/{id}/roles",
+		sessions.requireRole(datastore.RoleAdmin, sessions.requireStepUp(handleUserRolesPut(userStore))))
+	mux.HandleFunc("POST /api/v1/users/{id}/unlock",
+		sessions.requireRole(datastore.RoleAdmin, handleUserUnlock(userStore, lockout)))
+}
+
+// registerAuditRoutes registers the audit log, only admins may read it.
+func registerAuditRoutes(
+	mux router,
+	sessions *sessionManager,
+	auditStore AuditStore) {
+	mux.HandleFunc("GET /api/v1/audit", sessions.requireRole(datastore.RoleAdmin, handleAuditIndex(auditStore)))
+}
+
+// registerCatalogRoutes registers the export and import of the catalog, only
+// admins may use them.
+func registerCatalogRoutes(
+	mux router,
+	sessions *sessionManager,
+	catalogStore CatalogStore) {
+	mux.HandleFunc("GET /api/v1/export", sessions.requireRole(datastore.RoleAdmin, handleExport(catalogStore)))
+	mux.HandleFunc("POST /api/v1/import", sessions.requireRole(datastore.RoleAdmin, handleImport(catalogStore)))
+}
+
+// registerHealthRoutes registers the liveness and readiness probes.
+func registerHealthRoutes(
+	mux router,
+	health *health) {
+	mux.HandleFunc("GET /livez", health.handleLivez)
+	mux.HandleFunc("GET /readyz", health.handleReadyz)
 }
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+const sessionCookieName = "movieland_session"
+
+type contextKey string
+
+const sessionContextKey contextKey = "session"
+
+type sessionManager struct {
+	store        SessionStore
+	ttl          time.Duration
+	secure       bool
+	stepUpMaxAge time.Duration
+	// twoFactor tells whether two-factor authentication is configured, without
+	// it the second factor of users who enabled it is neither asked nor required
+	twoFactor bool
+}
+
+func newSessionManager(store SessionStore, cfg config.SessionConfig, twoFactor bool) *sessionManager {
+	return &sessionManager{
+		store:        store,
+		ttl:          cfg.TTL,
+		secure:       cfg.CookieSecure,
+		stepUpMaxAge: cfg.StepUpMaxAge,
+		twoFactor:    twoFactor,
+	}
+}
+
+// mfaRequired tells whether the user has to pass the second factor after
+// signing in.
+func (sm *sessionManager) mfaRequired(user *datastore.User) bool {
+	return sm.twoFactor && user.TOTPEnabledAt.Valid
+}
+
+// create starts a new session for the user and hands its token to the client
+// as a cookie, only the hash of the token is persisted. The session of a user
+// with two-factor authentication enabled stays pending until the second
+// factor is verified.
+func (sm *sessionManager) create(ctx context.Context, w http.ResponseWriter, user *datastore.User) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(sm.ttl)
+
+	err = sm.store.InsertSession(ctx, &datastore.Session{
+		TokenHash:  hashToken(token),
+		UserID:     user.ID,
+		MFAPending: sm.mfaRequired(user),
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		MaxAge:   int(sm.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   sm.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+func (sm *sessionManager) destroy(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   sm.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil
+	}
+
+	return sm.store.DeleteSession(r.Context(), hashToken(cookie.Value))
+}
+
+// session returns the session attached to the request,
+// or datastore.ErrSessionNotFound when there is none.
+func (sm *sessionManager) session(r *http.Request) (*datastore.Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, datastore.ErrSessionNotFound
+	}
+
+	return sm.store.GetSession(r.Context(), hashToken(cookie.Value))
+}
+
+// markMFAVerified records that the second factor was passed in the session
+// of the request.
+func (sm *sessionManager) markMFAVerified(r *http.Request) error {
+	session := sessionFromContext(r.Context())
+	if session == nil {
+		return datastore.ErrSessionNotFound
+	}
+
+	return sm.store.MarkSessionMFAVerified(r.Context(), session.TokenHash)
+}
+
+// loadSession attaches the session of the request to its context when there
+// is one, without requiring it.
+func (sm *sessionManager) loadSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(sessionCookieName); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, err := sm.session(r)
+		if err != nil {
+			if !errors.Is(err, datastore.ErrSessionNotFound) {
+				slog.ErrorContext(r.Context(), "could not load session", "method", r.Method, "url", r.URL, "err", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), sessionContextKey, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireSession only lets requests with a session through, including the
+// ones still waiting for their second factor.
+func (sm *sessionManager) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sessionFromContext(r.Context()) != nil {
+			next(w, r)
+			return
+		}
+
+		session, err := sm.session(r)
+		if err != nil {
+			if errors.Is(err, datastore.ErrSessionNotFound) {
+				handleUnauthorized(w, "")
+				return
+			}
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), sessionContextKey, session)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func (sm *sessionManager) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return sm.requireSession(func(w http.ResponseWriter, r *http.Request) {
+		// sessions created while two-factor authentication was configured stay pending
+		if sm.twoFactor && sessionFromContext(r.Context()).MFAPending {
+			handleUnauthorized(w, "two-factor authentication required")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func (sm *sessionManager) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return sm.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !userFromContext(r.Context()).HasRole(role) {
+			handleForbidden(w, "")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// requireStepUp guards sensitive operations, the user needs two-factor
+// authentication enabled and must have passed it recently. Without two-factor
+// authentication configured it lets all requests through. It expects to be
+// wrapped by requireUser or requireRole.
+func (sm *sessionManager) requireStepUp(next http.HandlerFunc) http.HandlerFunc {
+	if !sm.twoFactor {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := sessionFromContext(r.Context())
+
+		if !session.User.TOTPEnabledAt.Valid {
+			handleForbidden(w, "two-factor authentication must be enabled for this operation")
+			return
+		}
+
+		if !session.MFAVerifiedAt.Valid || time.Since(session.MFAVerifiedAt.Time) > sm.stepUpMaxAge {
+			handleForbidden(w, "step-up authentication required")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func sessionFromContext(ctx context.Context) *datastore.Session {
+	session, _ := ctx.Value(sessionContextKey).(*datastore.Session)
+	return session
+}
+
+func userFromContext(ctx context.Context) *datastore.User {
+	session := sessionFromContext(ctx)
+	if session == nil {
+		return nil
+	}
+	return session.User
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/secret"
+	"github.com/tommarien/movie-land/internal/totp"
+	"github.com/tommarien/movie-land/internal/validator"
+)
+
+const recoveryCodeCount = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorEnrolmentDto struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesDto struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type twoFactorCodeInput struct {
+	Code string `json:"code" openapi:"required"`
+}
+
+type twoFactorVerifyInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// twoFactor handles the enrolment and verification of TOTP based
+// two-factor authentication, secrets are stored encrypted by box.
+type twoFactor struct {
+	issuer   string
+	box      *secret.Box
+	store    TOTPStore
+	sessions *sessionManager
+	lockout  *lockout
+}
+
+func newTwoFactor(cfg config.AuthConfig, store TOTPStore, sessions *sessionManager, lockout *lockout) (*twoFactor, error) {
+	key, err := secret.ParseKey(cfg.TOTPEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	box, err := secret.NewBox(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &twoFactor{
+		issuer:   cfg.TOTPIssuer,
+		box:      box,
+		store:    store,
+		sessions: sessions,
+		lockout:  lockout,
+	}, nil
+}
+
+// handleEnroll starts an enrolment by generating a new secret, it only becomes
+// active once a code generated from it is posted to handleEnable.
+func (tf *twoFactor) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	if user.TOTPEnabledAt.Valid {
+		handleConflict(w, "two-factor authentication is already enabled")
+		return
+	}
+
+	key, err := totp.GenerateSecret()
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	sealed, err := tf.box.Seal([]byte(key))
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	err = tf.store.SetUserTOTPSecret(r.Context(), user.ID, sealed)
+	if err != nil {
+		if errors.Is(err, datastore.ErrTOTPAlreadyEnabled) {
+			handleConflict(w, "two-factor authentication is already enabled")
+			return
+		}
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, map[string]any{
+		"data": &TwoFactorEnrolmentDto{
+			Secret:     key,
+			OTPAuthURI: totp.URI(tf.issuer, user.Email, key),
+		},
+	}, nil)
+
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+}
+
+// handleEnable finishes the enrolment and returns the recovery codes,
+// they are shown this one time only.
+func (tf *twoFactor) handleEnable(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	var input twoFactorCodeInput
+
+	err := readJSON(w, r, &input)
+	if err != nil {
+		handleBadRequest(w, err.Error(), nil)
+		return
+	}
+
+	v := validator.New()
+	v.Required("code", input.Code)
+
+	if !v.IsValid() {
+		handleBadRequest(w, "", v.GetErrors())
+		return
+	}
+
+	if user.TOTPEnabledAt.Valid {
+		handleConflict(w, "two-factor authentication is already enabled")
+		return
+	}
+
+	if user.TOTPSecret == nil {
+		handleConflict(w, "no pending two-factor enrolment")
+		return
+	}
+
+	ok, err := tf.verifyCode(r, user, input.Code)
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	if !ok {
+		handleBadRequest(w, "invalid code", nil)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	err = tf.store.EnableUserTOTP(r.Context(), user.ID, hashes)
+	if err != nil {
+		if errors.Is(err, datastore.ErrTOTPEnrolmentNotFound) {
+			handleConflict(w, "no pending two-factor enrolment")
+			return
+		}
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	// the code was just verified, no need to ask for it again on step-up
+	if err = tf.sessions.markMFAVerified(r); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, map[string]any{
+		"data": &RecoveryCodesDto{
+			RecoveryCodes: codes,
+		},
+	}, nil)
+
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+}
+
+// handleVerify passes the second factor for the session, either to complete a
+// pending login or to step up before a sensitive operation.
+func (tf *twoFactor) handleVerify(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	var input twoFactorVerifyInput
+
+	err := readJSON(w, r, &input)
+	if err != nil {
+		handleBadRequest(w, err.Error(), nil)
+		return
+	}
+
+	if input.Code == "" && input.RecoveryCode == "" {
+		handleBadRequest(w, "", []string{"code or recovery_code is required"})
+		return
+	}
+
+	if !user.TOTPEnabledAt.Valid {
+		handleConflict(w, "two-factor authentication is not enabled")
+		return
+	}
+
+	attempt := newMFAAttempt(r, user)
+
+	if !tf.lockout.allow(w, r, &attempt) {
+		return
+	}
+
+	var ok bool
+	if input.Code != "" {
+		ok, err = tf.verifyCode(r, user, input.Code)
+	} else {
+		ok, err = tf.useRecoveryCode(r, user, input.RecoveryCode)
+	}
+
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	if !ok {
+		if err = tf.lockout.fail(r.Context(), attempt, datastore.AuthEventMFAFailed); err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		handleUnauthorized(w, "invalid code")
+		return
+	}
+
+	if err = tf.lockout.succeed(r.Context(), attempt); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	if err = tf.sessions.markMFAVerified(r); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (tf *twoFactor) handleDisable(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	if err := tf.store.DisableUserTOTP(r.Context(), user.ID); err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyCode checks the code against the secret of the user, an accepted code
+// cannot be used a second time.
+func (tf *twoFactor) verifyCode(r *http.Request, user *datastore.User, code string) (bool, error) {
+	key, err := tf.box.Open(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(string(key), strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	err = tf.store.ConsumeTOTPStep(r.Context(), user.ID, step)
+	if err != nil {
+		if errors.Is(err, datastore.ErrTOTPCodeReused) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (tf *twoFactor) useRecoveryCode(r *http.Request, user *datastore.User, code string) (bool, error) {
+	err := tf.store.UseRecoveryCode(r.Context(), user.ID, hashRecoveryCode(code))
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecoveryCodeNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// generateRecoveryCodes returns the codes formatted for the user,
+// together with the hashes to persist.
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes,
+// users tend to retype the codes loosely.
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
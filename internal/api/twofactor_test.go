@@ -0,0 +1,561 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testTOTPEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+// memoryTOTPStore updates the users of a memorySessionStore,
+// so sessions see the changes.
+type memoryTOTPStore struct {
+	mu            sync.Mutex
+	users         map[int]*datastore.User
+	lastSteps     map[int]int64
+	recoveryCodes map[int]map[string]bool
+}
+
+func newMemoryTOTPStore(sessions *memorySessionStore) *memoryTOTPStore {
+	return &memoryTOTPStore{
+		users:         sessions.users,
+		lastSteps:     make(map[int]int64),
+		recoveryCodes: make(map[int]map[string]bool),
+	}
+}
+
+func (m *memoryTOTPStore) SetUserTOTPSecret(ctx context.Context, userID int, secret []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[userID]
+	if user.TOTPEnabledAt.Valid {
+		return datastore.ErrTOTPAlreadyEnabled
+	}
+
+	user.TOTPSecret = secret
+	delete(m.lastSteps, userID)
+	return nil
+}
+
+func (m *memoryTOTPStore) EnableUserTOTP(ctx context.Context, userID int, recoveryCodeHashes [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[userID]
+	if user.TOTPSecret == nil || user.TOTPEnabledAt.Valid {
+		return datastore.ErrTOTPEnrolmentNotFound
+	}
+
+	user.TOTPEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	m.recoveryCodes[userID] = make(map[string]bool)
+	for _, hash := range recoveryCodeHashes {
+		m.recoveryCodes[userID][string(hash)] = true
+	}
+	return nil
+}
+
+func (m *memoryTOTPStore) DisableUserTOTP(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[userID]
+	user.TOTPSecret = nil
+	user.TOTPEnabledAt = sql.NullTime{}
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *memoryTOTPStore) ConsumeTOTPStep(ctx context.Context, userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if last, ok := m.lastSteps[userID]; ok && last >= step {
+		return datastore.ErrTOTPCodeReused
+	}
+
+	m.lastSteps[userID] = step
+	return nil
+}
+
+func (m *memoryTOTPStore) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.recoveryCodes[userID][string(codeHash)] {
+		return datastore.ErrRecoveryCodeNotFound
+	}
+
+	delete(m.recoveryCodes[userID], string(codeHash))
+	return nil
+}
+
+type twoFactorTestEnv struct {
+	mux       *http.ServeMux
+	sessions  *sessionManager
+	store     *memorySessionStore
+	totp      *memoryTOTPStore
+	twoFactor *twoFactor
+}
+
+func newTwoFactorTestEnv(t *testing.T, users ...*datastore.User) *twoFactorTestEnv {
+	t.Helper()
+
+	env := &twoFactorTestEnv{
+		mux:   http.NewServeMux(),
+		store: newMemorySessionStore(users...),
+	}
+	env.totp = newMemoryTOTPStore(env.store)
+	env.sessions = newSessionManager(env.store, config.SessionConfig{TTL: time.Hour, StepUpMaxAge: 5 * time.Minute}, true)
+
+	var err error
+	env.twoFactor, err = newTwoFactor(config.AuthConfig{
+		TOTPEncryptionKey: testTOTPEncryptionKey,
+		TOTPIssuer:        "MovieLand",
+	}, env.totp, env.sessions, newLockout(testLockoutConfig, newMemoryThrottleStore()))
+	if err != nil {
+		t.Fatalf("failed to create two factor: %v", err)
+	}
+
+	registerAuthRoutes(env.mux, env.sessions, nil, env.twoFactor, nil)
+
+	return env
+}
+
+// enableTOTP enables two-factor authentication for the user with the given
+// secret and recovery code.
+func (env *twoFactorTestEnv) enableTOTP(t *testing.T, user *datastore.User, key, recoveryCode string) {
+	t.Helper()
+
+	sealed, err := env.twoFactor.box.Seal([]byte(key))
+	if err != nil {
+		t.Fatalf("failed to seal secret: %v", err)
+	}
+
+	user.TOTPSecret = sealed
+	user.TOTPEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+	env.totp.recoveryCodes[user.ID] = map[string]bool{string(hashRecoveryCode(recoveryCode)): true}
+}
+
+func (env *twoFactorTestEnv) do(t *testing.T, method, target string, cookie *http.Cookie, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to marshal request body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+
+	env.mux.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func currentCode(t *testing.T, key string) string {
+	t.Helper()
+
+	code, err := totp.Code(key, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+	return code
+}
+
+func TestTwoFactorEnrolment(t *testing.T) {
+	user := &datastore.User{ID: 1, Email: "jane@example.com"}
+	env := newTwoFactorTestEnv(t, user)
+	cookie := login(t, env.sessions, user)
+
+	rec := env.do(t, "POST", "/auth/2fa/enroll", cookie, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var enrolment struct {
+		Data struct {
+			Secret     string `json:"secret"`
+			OTPAuthURI string `json:"otpauth_uri"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &enrolment); err != nil {
+		t.Fatalf("failed to parse JSON response: %v", err)
+	}
+
+	if want := totp.URI("MovieLand", "jane@example.com", enrolment.Data.Secret); enrolment.Data.OTPAuthURI != want {
+		t.Errorf("expected otpauth uri %q, got %q", want, enrolment.Data.OTPAuthURI)
+	}
+
+	if string(user.TOTPSecret) == enrolment.Data.Secret {
+		t.Error("expected the secret to be stored encrypted")
+	}
+
+	rec = env.do(t, "POST", "/auth/2fa/enable", cookie, map[string]any{"code": "000000"})
+	if diff := cmp.Diff(map[string]any{"status": float64(400), "message": "invalid code"}, parseGenreResponse(t, rec.Body.Bytes())); diff != "" {
+		t.Errorf("data mismatch (-want +got):\n%s", diff)
+	}
+
+	rec = env.do(t, "POST", "/auth/2fa/enable", cookie, map[string]any{"code": currentCode(t, enrolment.Data.Secret)})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var enabled struct {
+		Data struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &enabled); err != nil {
+		t.Fatalf("failed to parse JSON response: %v", err)
+	}
+
+	if len(enabled.Data.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(enabled.Data.RecoveryCodes))
+	}
+
+	if !user.TOTPEnabledAt.Valid {
+		t.Error("expected two-factor authentication to be enabled")
+	}
+
+	rec = env.do(t, "POST", "/auth/2fa/enroll", cookie, nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected status code %d on a second enrolment, got %d", http.StatusConflict, rec.Code)
+	}
+}
+
+func TestTwoFactorVerify(t *testing.T) {
+	const key = "JBSWY3DPEHPK3PXP"
+
+	t.Run("completes a pending login with a code once", func(t *testing.T) {
+		user := &datastore.User{ID: 1, Email: "jane@example.com"}
+		env := newTwoFactorTestEnv(t, user)
+		env.enableTOTP(t, user, key, "abcd-efgh")
+		cookie := login(t, env.sessions, user)
+
+		rec := env.do(t, "GET", "/api/v1/me", cookie, nil)
+		if diff := cmp.Diff(map[string]any{"status": float64(401), "message": "two-factor authentication required"}, parseGenreResponse(t, rec.Body.Bytes())); diff != "" {
+			t.Errorf("data mismatch (-want +got):\n%s", diff)
+		}
+
+		rec = env.do(t, "POST", "/auth/2fa/verify", cookie, map[string]any{"code": "000000"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status code %d for a wrong code, got %d", http.StatusUnauthorized, rec.Code)
+		}
+
+		code := currentCode(t, key)
+
+		rec = env.do(t, "POST", "/auth/2fa/verify", cookie, map[string]any{"code": code})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+		}
+
+		rec = env.do(t, "GET", "/api/v1/me", cookie, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status code %d after verification, got %d", http.StatusOK, rec.Code)
+		}
+
+		rec = env.do(t, "POST", "/auth/2fa/verify", cookie, map[string]any{"code": code})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d when replaying a code, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("completes a pending login with a recovery code once", func(t *testing.T) {
+		user := &datastore.User{ID: 1, Email: "jane@example.com"}
+		env := newTwoFactorTestEnv(t, user)
+		env.enableTOTP(t, user, key, "abcd-efgh")
+		cookie := login(t, env.sessions, user)
+
+		rec := env.do(t, "POST", "/auth/2fa/verify", cookie, map[string]any{"recovery_code": "ABCD EFGH"})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+		}
+
+		rec = env.do(t, "POST", "/auth/2fa/verify", cookie, map[string]any{"recovery_code": "abcd-efgh"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d when reusing a recovery code, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("disabling requires a recent verification", func(t *testing.T) {
+		user := &datastore.User{ID: 1, Email: "jane@example.com"}
+		env := newTwoFactorTestEnv(t, user)
+		env.enableTOTP(t, user, key, "abcd-efgh")
+		cookie := login(t, env.sessions, user)
+
+		rec := env.do(t, "POST", "/auth/2fa/verify", cookie, map[string]any{"code": currentCode(t, key)})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+		}
+
+		for _, s := range env.store.sessions {
+			s.MFAVerifiedAt.Time = time.Now().Add(-time.Hour)
+		}
+
+		rec = env.do(t, "POST", "/auth/2fa/disable", cookie, nil)
+		if diff := cmp.Diff(map[string]any{"status": float64(403), "message": "step-up authentication required"}, parseGenreResponse(t, rec.Body.Bytes())); diff != "" {
+			t.Errorf("data mismatch (-want +got):\n%s", diff)
+		}
+
+		rec = env.do(t, "POST", "/auth/2fa/verify", cookie, map[string]any{"recovery_code": "abcd-efgh"})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+		}
+
+		rec = env.do(t, "POST", "/auth/2fa/disable", cookie, nil)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+		}
+
+		if user.TOTPEnabledAt.Valid {
+			t.Error("expected two-factor authentication to be disabled")
+		}
+	})
+}
+
+func TestPutUserRoles(t *testing.T) {
+	const key = "JBSWY3DPEHPK3PXP"
+
+	target := &datastore.User{ID: 2, Email: "john@example.com"}
+
+	users := &mockUserStore{
+		getUserFunc: func(ctx context.Context, ID int) (*datastore.User, error) {
+			if ID == target.ID {
+				return target, nil
+			}
+			return nil, datastore.ErrUserNotFound
+		},
+		setUserRolesFunc: func(ctx context.Context, userID int, roles []string) error {
+			target.Roles = roles
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name           string
+		totp           bool
+		verifiedAgo    time.Duration
+		target         string
+		requestBody    map[string]any
+		expectedStatus int
+		expectedData   any
+	}{
+		{
+			name:           "returns status 403 when the admin has no two-factor authentication",
+			target:         "/api/v1/users/2/roles",
+			requestBody:    map[string]any{"roles": []string{"editor"}},
+			expectedStatus: http.StatusForbidden,
+			expectedData:   map[string]any{"status": float64(403), "message": "two-factor authentication must be enabled for this operation"},
+		},
+		{
+			name:           "returns status 403 when the verification is not recent",
+			totp:           true,
+			verifiedAgo:    time.Hour,
+			target:         "/api/v1/users/2/roles",
+			requestBody:    map[string]any{"roles": []string{"editor"}},
+			expectedStatus: http.StatusForbidden,
+			expectedData:   map[string]any{"status": float64(403), "message": "step-up authentication required"},
+		},
+		{
+			name:           "returns status 400 for an unknown role",
+			totp:           true,
+			target:         "/api/v1/users/2/roles",
+			requestBody:    map[string]any{"roles": []string{"owner"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]any{
+				"status":  float64(400),
+				"message": "bad request",
+				"errors":  []any{"roles must be one of admin, editor"},
+			},
+		},
+		{
+			name:           "returns status 404 for an unknown user",
+			totp:           true,
+			target:         "/api/v1/users/99/roles",
+			requestBody:    map[string]any{"roles": []string{"editor"}},
+			expectedStatus: http.StatusNotFound,
+			expectedData:   map[string]any{"status": float64(404), "message": "user not found"},
+		},
+		{
+			name:           "returns status 200 with the updated user",
+			totp:           true,
+			target:         "/api/v1/users/2/roles",
+			requestBody:    map[string]any{"roles": []string{"editor"}},
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]any{
+				"data": map[string]any{
+					"id":                 float64(2),
+					"email":              "john@example.com",
+					"roles":              []any{"editor"},
+					"two_factor_enabled": false,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := &datastore.User{ID: 1, Email: "jane@example.com", Roles: []string{datastore.RoleAdmin}}
+			env := newTwoFactorTestEnv(t, admin)
+			registerUserRoutes(env.mux, env.sessions, users, newLockout(testLockoutConfig, newMemoryThrottleStore()))
+
+			if tt.totp {
+				env.enableTOTP(t, admin, key, "abcd-efgh")
+			}
+
+			cookie := login(t, env.sessions, admin)
+
+			for _, s := range env.store.sessions {
+				s.MFAPending = false
+				if tt.totp {
+					s.MFAVerifiedAt = sql.NullTime{Time: time.Now().Add(-tt.verifiedAgo), Valid: true}
+				}
+			}
+
+			rec := env.do(t, "PUT", tt.target, cookie, tt.requestBody)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status code %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			result := parseGenreResponse(t, rec.Body.Bytes())
+
+			if diff := cmp.Diff(tt.expectedData, result); diff != "" {
+				t.Errorf("data mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTwoFactorDisabled(t *testing.T) {
+	admin := &datastore.User{
+		ID:              1,
+		Email:           "jane@example.com",
+		EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		TOTPEnabledAt:   sql.NullTime{Time: time.Now(), Valid: true},
+		Roles:           []string{datastore.RoleAdmin},
+	}
+	target := &datastore.User{ID: 2, Email: "john@example.com"}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.PasswordHash = passwordHash
+
+	users := &mockUserStore{
+		getUserFunc: func(ctx context.Context, ID int) (*datastore.User, error) {
+			if ID == target.ID {
+				return target, nil
+			}
+			return nil, datastore.ErrUserNotFound
+		},
+		getUserByEmailFunc: func(ctx context.Context, email string) (*datastore.User, error) {
+			if email == admin.Email {
+				return admin, nil
+			}
+			return nil, datastore.ErrUserNotFound
+		},
+		setUserRolesFunc: func(ctx context.Context, userID int, roles []string) error {
+			target.Roles = roles
+			return nil
+		},
+	}
+
+	newEnv := func() (*http.ServeMux, *memorySessionStore) {
+		store := newMemorySessionStore(admin)
+		sessions := newSessionManager(store, config.SessionConfig{TTL: time.Hour, StepUpMaxAge: 5 * time.Minute}, false)
+		lockout := newLockout(testLockoutConfig, newMemoryThrottleStore())
+		accounts := newAccounts(&config.Config{}, users, &mockUserTokenStore{}, sessions, newMailSender(&recordingMailer{}), lockout)
+
+		mux := http.NewServeMux()
+		registerAuthRoutes(mux, sessions, accounts, nil, nil)
+		registerUserRoutes(mux, sessions, users, lockout)
+
+		return mux, store
+	}
+
+	do := func(mux *http.ServeMux, method, target string, cookies []*http.Cookie, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("signs in users who enabled two-factor authentication without a second factor", func(t *testing.T) {
+		mux, store := newEnv()
+
+		rec := do(mux, "POST", "/auth/login", nil, map[string]any{"email": "jane@example.com", "password": "correct horse battery"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		if mfaRequired := parseGenreResponse(t, rec.Body.Bytes())["mfa_required"]; mfaRequired != false {
+			t.Errorf("expected mfa_required false, got %v", mfaRequired)
+		}
+
+		for _, s := range store.sessions {
+			if s.MFAPending {
+				t.Error("expected the session not to wait for a second factor")
+			}
+		}
+
+		if rec = do(mux, "GET", "/api/v1/me", rec.Result().Cookies(), nil); rec.Code != http.StatusOK {
+			t.Errorf("expected the session to be usable, got status %d", rec.Code)
+		}
+	})
+
+	t.Run("accepts sessions left pending while two-factor authentication was configured", func(t *testing.T) {
+		mux, store := newEnv()
+
+		rec := do(mux, "POST", "/auth/login", nil, map[string]any{"email": "jane@example.com", "password": "correct horse battery"})
+		for _, s := range store.sessions {
+			s.MFAPending = true
+		}
+
+		if rec = do(mux, "GET", "/api/v1/me", rec.Result().Cookies(), nil); rec.Code != http.StatusOK {
+			t.Errorf("expected the session to be usable, got status %d", rec.Code)
+		}
+	})
+
+	t.Run("changes roles without step-up authentication", func(t *testing.T) {
+		mux, _ := newEnv()
+
+		rec := do(mux, "POST", "/auth/login", nil, map[string]any{"email": "jane@example.com", "password": "correct horse battery"})
+
+		rec = do(mux, "PUT", "/api/v1/users/2/roles", rec.Result().Cookies(), map[string]any{"roles": []string{"editor"}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+		}
+
+		if diff := cmp.Diff([]string{"editor"}, target.Roles); diff != "" {
+			t.Errorf("roles mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
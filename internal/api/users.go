@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/validator"
+)
+
+type UserDto struct {
+	ID               int      `json:"id"`
+	Email            string   `json:"email"`
+	Name             string   `json:"name,omitempty"`
+	Roles            []string `json:"roles"`
+	TwoFactorEnabled bool     `json:"two_factor_enabled"`
+}
+
+type userRolesInput struct {
+	Roles []string `json:"roles"`
+}
+
+func handleMeGet(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	err := writeJSON(w, http.StatusOK, map[string]any{
+		"data": mapUser(user),
+	}, nil)
+
+	if err != nil {
+		handleInternalServerError(w, r, err)
+		return
+	}
+}
+
+func handleLogout(sessions *sessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := sessions.destroy(w, r); err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleUserRolesPut(store UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getIntParam(r, "id")
+		if err != nil {
+			handleNotFound(w, "user not found")
+			return
+		}
+
+		var input userRolesInput
+
+		err = readJSON(w, r, &input)
+		if err != nil {
+			handleBadRequest(w, err.Error(), nil)
+			return
+		}
+
+		v := validator.New()
+		for _, role := range input.Roles {
+			v.Required("roles", role)
+			v.In("roles", role, datastore.RoleAdmin, datastore.RoleEditor)
+		}
+
+		if !v.IsValid() {
+			handleBadRequest(w, "", v.GetErrors())
+			return
+		}
+
+		user, err := store.GetUser(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, datastore.ErrUserNotFound) {
+				handleNotFound(w, "user not found")
+				return
+			}
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		if err = store.SetUserRoles(r.Context(), user.ID, input.Roles); err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		user, err = store.GetUser(r.Context(), user.ID)
+		if err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, map[string]any{
+			"data": mapUser(user),
+		}, nil)
+
+		if err != nil {
+			handleInternalServerError(w, r, err)
+			return
+		}
+	}
+}
+
+func mapUser(user *datastore.User) *UserDto {
+	dto := &UserDto{
+		ID:               user.ID,
+		Email:            user.Email,
+		Roles:            user.Roles,
+		TwoFactorEnabled: user.TOTPEnabledAt.Valid,
+	}
+
+	if dto.Roles == nil {
+		dto.Roles = []string{}
+	}
+
+	if user.Name.Valid {
+		dto.Name = user.Name.String
+	}
+	return dto
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+type mockUserStore struct {
+	getUserFunc        func(context.Context, int) (*datastore.User, error)
+	getUserByEmailFunc func(context.Context, string) (*datastore.User, error)
+	upsertOIDCUserFunc func(context.Context, *datastore.User) error
+	setUserRolesFunc   func(context.Context, int, []string) error
+}
+
+func (m *mockUserStore) GetUser(ctx context.Context, ID int) (*datastore.User, error) {
+	if m.getUserFunc != nil {
+		return m.getUserFunc(ctx, ID)
+	}
+	return nil, datastore.ErrUserNotFound
+}
+
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*datastore.User, error) {
+	if m.getUserByEmailFunc != nil {
+		return m.getUserByEmailFunc(ctx, email)
+	}
+	return nil, datastore.ErrUserNotFound
+}
+
+func (m *mockUserStore) UpsertOIDCUser(ctx context.Context, user *datastore.User) error {
+	if m.upsertOIDCUserFunc != nil {
+		return m.upsertOIDCUserFunc(ctx, user)
+	}
+	return errors.New("No upsertOIDCUser call expected")
+}
+
+func (m *mockUserStore) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+	if m.setUserRolesFunc != nil {
+		return m.setUserRolesFunc(ctx, userID, roles)
+	}
+	return errors.New("No setUserRoles call expected")
+}
+
+// memorySessionStore keeps sessions in memory, users are resolved through the
+// users map by ID.
+type memorySessionStore struct {
+	mu       sync.Mutex
+	users    map[int]*datastore.User
+	sessions map[string]*datastore.Session
+}
+
+func newMemorySessionStore(users ...*datastore.User) *memorySessionStore {
+	store := &memorySessionStore{
+		users:    make(map[int]*datastore.User),
+		sessions: make(map[string]*datastore.Session),
+	}
+
+	for _, u := range users {
+		store.users[u.ID] = u
+	}
+
+	return store
+}
+
+func (m *memorySessionStore) InsertSession(ctx context.Context, session *datastore.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.CreatedAt = time.Now()
+	m.sessions[string(session.TokenHash)] = session
+	return nil
+}
+
+func (m *memorySessionStore) GetSession(ctx context.Context, tokenHash []byte) (*datastore.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[string(tokenHash)]
+	if !ok || session.ExpiresAt.Before(time.Now()) {
+		return nil, datastore.ErrSessionNotFound
+	}
+
+	user, ok := m.users[session.UserID]
+	if !ok {
+		return nil, datastore.ErrSessionNotFound
+	}
+
+	got := *session
+	got.User = user
+	return &got, nil
+}
+
+func (m *memorySessionStore) MarkSessionMFAVerified(ctx context.Context, tokenHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[string(tokenHash)]
+	if !ok {
+		return datastore.ErrSessionNotFound
+	}
+
+	session.MFAPending = false
+	session.MFAVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (m *memorySessionStore) DeleteSession(ctx context.Context, tokenHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, string(tokenHash))
+	return nil
+}
+
+// login starts a session for the user and returns the session cookie.
+func login(t *testing.T, sessions *sessionManager, user *datastore.User) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if err := sessions.create(context.Background(), rec, user); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			return c
+		}
+	}
+
+	t.Fatal("no session cookie set")
+	return nil
+}
+
+func TestGetMe(t *testing.T) {
+	user := &datastore.User{
+		ID:    7,
+		Email: "jane@example.com",
+		Name:  sql.NullString{String: "Jane", Valid: true},
+		Roles: []string{"admin"},
+	}
+
+	store := newMemorySessionStore(user)
+	sessions := newSessionManager(store, config.SessionConfig{TTL: time.Hour}, false)
+
+	tests := []struct {
+		name           string
+		cookie         *http.Cookie
+		expectedStatus int
+		expectedData   any
+	}{
+		{
+			name:           "returns status 401 without a session",
+			expectedStatus: http.StatusUnauthorized,
+			expectedData:   map[string]any{"status": float64(401), "message": "unauthorized"},
+		},
+		{
+			name:           "returns status 401 with an unknown session",
+			cookie:         &http.Cookie{Name: sessionCookieName, Value: "unknown"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedData:   map[string]any{"status": float64(401), "message": "unauthorized"},
+		},
+		{
+			name:           "returns status 200 with the current user",
+			cookie:         login(t, sessions, user),
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]any{
+				"data": map[string]any{
+					"id":                 float64(7),
+					"email":              "jane@example.com",
+					"name":               "Jane",
+					"roles":              []any{"admin"},
+					"two_factor_enabled": false,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			registerAuthRoutes(mux, sessions, nil, nil, nil)
+
+			req := httptest.NewRequest("GET", "/api/v1/me", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.expectedStatus {
+				t.Fatalf("expected status code %d, got %d", tt.expectedStatus, res.StatusCode)
+			}
+
+			result := parseGenreResponse(t, rec.Body.Bytes())
+
+			if diff := cmp.Diff(tt.expectedData, result); diff != "" {
+				t.Errorf("data mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPostLogout(t *testing.T) {
+	user := &datastore.User{ID: 1, Email: "jane@example.com"}
+	store := newMemorySessionStore(user)
+	sessions := newSessionManager(store, config.SessionConfig{TTL: time.Hour}, false)
+
+	mux := http.NewServeMux()
+	registerAuthRoutes(mux, sessions, nil, nil, nil)
+
+	cookie := login(t, sessions, user)
+
+	req := httptest.NewRequest("POST", "/auth/logout", bytes.NewReader(nil))
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	if len(store.sessions) != 0 {
+		t.Errorf("expected session to be deleted, got %d sessions", len(store.sessions))
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/me", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status code %d after logout, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
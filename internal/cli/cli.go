@@ -0,0 +1,195 @@
+// Package cli implements the commands of the movie-land binary, from serving
+// the API to the chores operators script, like migrating the database.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/pg"
+)
+
+// The exit codes of the commands, so scripts can tell failures apart.
+const (
+	ExitOK = 0
+	// ExitFailure is returned when the command failed
+	ExitFailure = 1
+	// ExitUsage is returned for unknown commands, flags and arguments
+	ExitUsage = 2
+	// ExitConfig is returned when the config could not be loaded
+	ExitConfig = 3
+	// ExitUnavailable is returned when the database could not be reached
+	ExitUnavailable = 4
+	// ExitSchema is returned when the database schema is newer than the
+	// migrations of the binary
+	ExitSchema = 5
+)
+
+// CLI runs the commands with the given standard streams.
+type CLI struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// LogLevel is the level of the default logger, it is set from the config
+	LogLevel *slog.LevelVar
+}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, c *CLI, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	// assigned in init as the help command lists them
+	commands = []*command{
+		{name: "serve", usage: "serve [flags]", summary: "serve the API, the default without a command", run: runServe},
+		{name: "migrate", usage: "migrate up|down|status|version", summary: "apply, roll back or show the database migrations", run: runMigrate},
+		{name: "seed", usage: "seed", summary: "add the sample genres to the catalog", run: runSeed},
+		{name: "genres", usage: "genres export|import [flags]", summary: "export or import the catalog as NDJSON or a gzipped tarball", run: runGenres},
+		{name: "users", usage: "users create|grant [flags]", summary: "create users and grant them roles", run: runUsers},
+		{name: "help", usage: "help", summary: "show this help", run: runHelp},
+	}
+}
+
+// exitError ends a command with the exit code of its kind of failure.
+type exitError struct {
+	code int
+	err  error
+	// reported errors were already written to stderr, like flag errors
+	reported bool
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &exitError{code: ExitUsage, err: fmt.Errorf(format, args...)}
+}
+
+// Run runs the command named by the first argument with the rest of the
+// arguments, serve when there is none or the first one is a flag. It returns
+// the exit code.
+func (c *CLI) Run(ctx context.Context, args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		name, args = "help", nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return c.exit(cmd.run(ctx, c, args))
+		}
+	}
+
+	return c.exit(usageErrorf("unknown command %q, run movie-land help for the commands", name))
+}
+
+func (c *CLI) exit(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) {
+		exitErr = &exitError{code: ExitFailure, err: err}
+	}
+
+	if !exitErr.reported {
+		fmt.Fprintf(c.Stderr, "movie-land: %v\n", err)
+	}
+
+	return exitErr.code
+}
+
+func runHelp(_ context.Context, c *CLI, args []string) error {
+	if err := c.parse(c.flagSet("help", ""), args); err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.Stdout, "Usage: movie-land <command> [arguments]\n\nCommands:\n")
+
+	tw := tabwriter.NewWriter(c.Stdout, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.usage, cmd.summary)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.Stdout, "\nRun movie-land <command> -h for the flags of a command.\n")
+	return nil
+}
+
+// flagSet returns the flags of the command, args describes its arguments in
+// the usage.
+func (c *CLI) flagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.TrimSpace("Usage: movie-land "+name+" [flags] "+args))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags, the flag package already reported invalid ones.
+func (c *CLI) parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return &exitError{code: ExitUsage, err: err, reported: true}
+	}
+	return err
+}
+
+// connect loads the config from the environment and connects to the
+// database, like serve does.
+func (c *CLI) connect(ctx context.Context) (*config.Config, *pgxpool.Pool, error) {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return nil, nil, &exitError{code: ExitConfig, err: fmt.Errorf("failed to load config: %w", err)}
+	}
+
+	c.LogLevel.Set(cfg.LogLevel)
+
+	pool, err := pg.Connect(ctx, poolOptions(cfg))
+	if err != nil {
+		return nil, nil, &exitError{code: ExitUnavailable, err: fmt.Errorf("failed to connect to db: %w", err)}
+	}
+
+	return cfg, pool, nil
+}
+
+func poolOptions(cfg *config.Config) pg.PoolOptions {
+	return pg.PoolOptions{
+		ConnString:        cfg.DatabaseUrl,
+		PingTimeout:       cfg.DatabasePingTimeout,
+		ConnectTimeout:    cfg.Database.ConnectTimeout,
+		MaxConns:          cfg.Database.MaxConns,
+		MinConns:          cfg.Database.MinConns,
+		MaxConnLifetime:   cfg.Database.MaxConnLifetime,
+		MaxConnIdleTime:   cfg.Database.MaxConnIdleTime,
+		HealthCheckPeriod: cfg.Database.HealthCheckPeriod,
+		StatementTimeout:  cfg.Database.StatementTimeout,
+		ApplicationName:   cfg.Database.ApplicationName,
+		SimpleProtocol:    cfg.Database.SimpleProtocol,
+	}
+}
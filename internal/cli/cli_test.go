@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	c := &CLI{
+		Stdin:    strings.NewReader(""),
+		Stdout:   &stdout,
+		Stderr:   &stderr,
+		LogLevel: new(slog.LevelVar),
+	}
+
+	code := c.Run(context.Background(), args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	// commands reaching the config fail on it before connecting
+	t.Setenv("DATABASE_URL", "")
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{name: "help", args: []string{"help"}, code: ExitOK},
+		{name: "help flag", args: []string{"-h"}, code: ExitOK},
+		{name: "command help", args: []string{"migrate", "up", "-h"}, code: ExitOK},
+		{name: "unknown command", args: []string{"frobnicate"}, code: ExitUsage},
+		{name: "unknown flag", args: []string{"seed", "--force"}, code: ExitUsage},
+		{name: "unexpected argument", args: []string{"seed", "now"}, code: ExitUsage},
+		{name: "migrate without command", args: []string{"migrate"}, code: ExitUsage},
+		{name: "migrate unknown command", args: []string{"migrate", "sideways"}, code: ExitUsage},
+		{name: "genres unknown format", args: []string{"genres", "export", "--format", "xml"}, code: ExitUsage},
+		{name: "genres import without file", args: []string{"genres", "import"}, code: ExitUsage},
+		{name: "users create without email", args: []string{"users", "create"}, code: ExitUsage},
+		{name: "users create invalid role", args: []string{"users", "create", "--email", "jane@example.com", "--role", "owner"}, code: ExitUsage},
+		{name: "users create short password", args: []string{"users", "create", "--email", "jane@example.com", "--password-stdin"}, code: ExitUsage},
+		{name: "users grant without role", args: []string{"users", "grant", "jane@example.com"}, code: ExitUsage},
+		{name: "users grant invalid role", args: []string{"users", "grant", "jane@example.com", "owner"}, code: ExitUsage},
+		{name: "invalid config", args: []string{"migrate", "status"}, code: ExitConfig},
+		{name: "serve invalid config", args: nil, code: ExitConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := run(t, tt.args...)
+
+			if code != tt.code {
+				t.Errorf("got exit code %d, want %d, stderr: %s", code, tt.code, stderr)
+			}
+		})
+	}
+}
+
+func TestRunHelp(t *testing.T) {
+	_, stdout, _ := run(t, "help")
+
+	for _, cmd := range commands {
+		if !strings.Contains(stdout, cmd.usage) {
+			t.Errorf("help misses command %s: %s", cmd.name, stdout)
+		}
+	}
+}
+
+func TestCatalogMediaType(t *testing.T) {
+	tests := []struct {
+		format string
+		file   string
+		want   string
+	}{
+		{file: "-", want: "application/x-ndjson"},
+		{file: "genres.ndjson", want: "application/x-ndjson"},
+		{file: "genres.tar.gz", want: "application/gzip"},
+		{file: "genres.tgz", want: "application/gzip"},
+		{format: "ndjson", file: "genres.tgz", want: "application/x-ndjson"},
+		{format: "tar.gz", file: "-", want: "application/gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.file, func(t *testing.T) {
+			got, err := catalogMediaType(tt.format, tt.file)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	tests := []struct {
+		current int64
+		latest  int64
+		code    int
+	}{
+		{current: 0, latest: 2, code: ExitOK},
+		{current: 1, latest: 2, code: ExitOK},
+		{current: 2, latest: 2, code: ExitOK},
+		{current: 3, latest: 2, code: ExitSchema},
+	}
+
+	for _, tt := range tests {
+		c := &CLI{Stderr: new(bytes.Buffer)}
+
+		if code := c.exit(checkSchemaVersion(tt.current, tt.latest)); code != tt.code {
+			t.Errorf("schema version %d with binary version %d: got exit code %d, want %d", tt.current, tt.latest, code, tt.code)
+		}
+	}
+}
+
+func TestIsLocalURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "http://localhost:3000", want: true},
+		{url: "http://app.localhost", want: true},
+		{url: "http://127.0.0.1:3000", want: true},
+		{url: "http://[::1]:3000", want: true},
+		{url: "https://movie-land.example.com", want: false},
+		{url: "http://192.0.2.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := isLocalURL(tt.url); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
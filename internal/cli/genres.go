@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tommarien/movie-land/internal/api"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+// catalogFormats maps the formats of the flags onto the media types of the
+// export and import routes.
+var catalogFormats = map[string]string{
+	"ndjson": "application/x-ndjson",
+	"tar.gz": "application/gzip",
+}
+
+// runGenres exports and imports the catalog in the formats of the API, to
+// back it up or move it between environments.
+func runGenres(ctx context.Context, c *CLI, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("genres needs one of export or import")
+	}
+
+	action, args := args[0], args[1:]
+	switch action {
+	case "export":
+		return runGenresExport(ctx, c, args)
+	case "import":
+		return runGenresImport(ctx, c, args)
+	default:
+		return usageErrorf("unknown genres command %q, use one of export or import", action)
+	}
+}
+
+func runGenresExport(ctx context.Context, c *CLI, args []string) error {
+	fs := c.flagSet("genres export", "")
+	format := fs.String("format", "", "`format` of the export, ndjson or tar.gz (default by the extension of --output, else ndjson)")
+	output := fs.String("output", "-", "`file` to write the export to, - for stdout")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageErrorf("genres export takes no arguments")
+	}
+
+	mediaType, err := catalogMediaType(*format, *output)
+	if err != nil {
+		return err
+	}
+
+	_, pool, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	var f *os.File
+	w := c.Stdout
+	if *output != "-" {
+		if f, err = os.Create(*output); err != nil {
+			return fmt.Errorf("could not create export: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+
+	count, err := api.ExportCatalog(ctx, datastore.New(pool), bw, mediaType)
+	if err != nil {
+		return fmt.Errorf("could not export genres: %w", err)
+	}
+
+	if err = bw.Flush(); err != nil {
+		return fmt.Errorf("could not write export: %w", err)
+	}
+
+	// closed here as well, a failed close may have lost the last writes
+	if f != nil {
+		if err = f.Close(); err != nil {
+			return fmt.Errorf("could not write export: %w", err)
+		}
+	}
+
+	fmt.Fprintf(c.Stderr, "exported %d genres\n", count)
+	return nil
+}
+
+func runGenresImport(ctx context.Context, c *CLI, args []string) error {
+	fs := c.flagSet("genres import", "<file>")
+	format := fs.String("format", "", "`format` of the import, ndjson or tar.gz (default by the extension of the file, else ndjson)")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("genres import needs a file, - for stdin")
+	}
+
+	name := fs.Arg(0)
+
+	mediaType, err := catalogMediaType(*format, name)
+	if err != nil {
+		return err
+	}
+
+	r := c.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("could not open import: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	_, pool, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	result, err := api.ImportCatalog(ctx, datastore.New(pool), bufio.NewReader(r), mediaType)
+	if err != nil {
+		return fmt.Errorf("could not import genres: %w", err)
+	}
+
+	printImportResult(c.Stdout, result)
+	return nil
+}
+
+// catalogMediaType returns the media type of the format, or of the extension
+// of the file when there is no format.
+func catalogMediaType(format, file string) (string, error) {
+	if format == "" {
+		format = "ndjson"
+		if strings.HasSuffix(file, ".tar.gz") || strings.HasSuffix(file, ".tgz") {
+			format = "tar.gz"
+		}
+	}
+
+	mediaType, ok := catalogFormats[format]
+	if !ok {
+		return "", usageErrorf("format must be one of ndjson or tar.gz, got %q", format)
+	}
+
+	return mediaType, nil
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/tommarien/movie-land/migrations"
+)
+
+// runMigrate applies the migrations embedded in the binary, the goose binary
+// is only needed to create new ones.
+func runMigrate(ctx context.Context, c *CLI, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("migrate needs one of up, down, status or version")
+	}
+
+	action, args := args[0], args[1:]
+	switch action {
+	case "up", "down", "status", "version":
+	default:
+		return usageErrorf("unknown migrate command %q, use one of up, down, status or version", action)
+	}
+
+	fs := c.flagSet("migrate "+action, "")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageErrorf("migrate %s takes no arguments", action)
+	}
+
+	_, pool, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	provider, db, err := newProvider(pool)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch action {
+	case "up":
+		current, latest, err := provider.GetVersions(ctx)
+		if err != nil {
+			return fmt.Errorf("could not get schema version: %w", err)
+		}
+		if err = checkSchemaVersion(current, latest); err != nil {
+			return err
+		}
+
+		results, err := applyMigrations(ctx, provider)
+		for _, result := range results {
+			fmt.Fprintln(c.Stdout, result)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(results) == 0 {
+			fmt.Fprintln(c.Stdout, "no migrations to apply")
+		}
+
+	case "down":
+		result, err := provider.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			return errors.New("no migrations to roll back")
+		}
+		if err != nil {
+			return fmt.Errorf("could not roll back migration: %w", err)
+		}
+
+		fmt.Fprintln(c.Stdout, result)
+
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("could not get migration status: %w", err)
+		}
+
+		pending := 0
+		tw := tabwriter.NewWriter(c.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			appliedAt := "-"
+			if s.State == goose.StateApplied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			} else {
+				pending++
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Source.Version, s.State, appliedAt, path.Base(s.Source.Path))
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+
+		current, latest, err := provider.GetVersions(ctx)
+		if err != nil {
+			return fmt.Errorf("could not get schema version: %w", err)
+		}
+
+		fmt.Fprintf(c.Stdout, "\nschema version %d, binary version %d, %d pending\n", current, latest, pending)
+		return checkSchemaVersion(current, latest)
+
+	case "version":
+		current, latest, err := provider.GetVersions(ctx)
+		if err != nil {
+			return fmt.Errorf("could not get schema version: %w", err)
+		}
+
+		fmt.Fprintln(c.Stdout, current)
+		return checkSchemaVersion(current, latest)
+	}
+
+	return nil
+}
+
+// newProvider returns the provider of the embedded migrations on the pool,
+// the database has to be closed when done.
+func newProvider(pool *pgxpool.Pool) (*goose.Provider, *sql.DB, error) {
+	db := stdlib.OpenDBFromPool(pool)
+
+	provider, err := migrations.NewProvider(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return provider, db, nil
+}
+
+// applyMigrations applies the pending migrations, the results include the
+// ones applied before one failed.
+func applyMigrations(ctx context.Context, provider *goose.Provider) ([]*goose.MigrationResult, error) {
+	results, err := provider.Up(ctx)
+
+	var partialErr *goose.PartialError
+	if errors.As(err, &partialErr) {
+		results = partialErr.Applied
+	}
+	if err != nil {
+		return results, fmt.Errorf("could not apply migrations: %w", err)
+	}
+
+	return results, nil
+}
+
+// autoMigrate applies the pending migrations before serving, the advisory
+// lock makes the replicas starting together wait for the one migrating.
+func autoMigrate(ctx context.Context, pool *pgxpool.Pool) error {
+	provider, db, err := newProvider(pool)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	results, err := applyMigrations(ctx, provider)
+	for _, r := range results {
+		slog.Info("applied migration", "version", r.Source.Version, "migration", path.Base(r.Source.Path), "duration", r.Duration)
+	}
+
+	return err
+}
+
+// checkSchemaVersion fails when the database was migrated by a newer binary,
+// this one would run against a schema it does not know.
+func checkSchemaVersion(current, latest int64) error {
+	if current > latest {
+		return &exitError{code: ExitSchema, err: fmt.Errorf("schema version %d is newer than %d, the binary is outdated", current, latest)}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+// seedGenres are the sample genres of a development database.
+var seedGenres = []struct{ slug, name string }{
+	{"action", "Action"},
+	{"adventure", "Adventure"},
+	{"animation", "Animation"},
+	{"comedy", "Comedy"},
+	{"crime", "Crime"},
+	{"documentary", "Documentary"},
+	{"drama", "Drama"},
+	{"fantasy", "Fantasy"},
+	{"horror", "Horror"},
+	{"science-fiction", "Science Fiction"},
+	{"thriller", "Thriller"},
+}
+
+// runSeed upserts the sample genres like an import, so seeding twice
+// changes nothing.
+func runSeed(ctx context.Context, c *CLI, args []string) error {
+	fs := c.flagSet("seed", "")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageErrorf("seed takes no arguments")
+	}
+
+	_, pool, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	i := 0
+	next := func() (*datastore.Genre, error) {
+		if i == len(seedGenres) {
+			return nil, io.EOF
+		}
+
+		g := seedGenres[i]
+		i++
+
+		return &datastore.Genre{Slug: g.slug, Name: sql.NullString{String: g.name, Valid: true}}, nil
+	}
+
+	result, err := datastore.New(pool).ImportGenres(ctx, next)
+	if err != nil {
+		return fmt.Errorf("could not seed genres: %w", err)
+	}
+
+	printImportResult(c.Stdout, result)
+	return nil
+}
+
+func printImportResult(w io.Writer, result *datastore.ImportResult) {
+	fmt.Fprintf(w, "genres: %d created, %d updated, %d unchanged\n", result.Created, result.Updated, result.Unchanged)
+}
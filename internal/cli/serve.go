@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/api"
+	"github.com/tommarien/movie-land/internal/config"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/mail"
+	"github.com/tommarien/movie-land/internal/metrics"
+	"github.com/tommarien/movie-land/internal/pg"
+	"github.com/tommarien/movie-land/internal/tracing"
+	"github.com/tommarien/movie-land/migrations"
+)
+
+// runServe serves the API until it receives a signal to shut down. Next to
+// the environment and --config it takes a flag per setting.
+func runServe(ctx context.Context, c *CLI, args []string) error {
+	fs := c.flagSet("serve", "")
+	printConfig := fs.Bool("print-config", false, "print the config with its secrets redacted and exit")
+
+	src, err := config.ParseFlags(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return &exitError{code: ExitUsage, err: err, reported: true}
+	}
+
+	cfg, err := src.Load()
+	if err != nil {
+		return &exitError{code: ExitConfig, err: fmt.Errorf("failed to load config: %w", err)}
+	}
+
+	if *printConfig {
+		return cfg.Print(c.Stdout)
+	}
+
+	c.LogLevel.Set(cfg.LogLevel)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, c.Stdout)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("could not flush traces", "err", err)
+		}
+	}()
+
+	poolOpts := poolOptions(cfg)
+
+	pool, err := pg.Connect(ctx, poolOpts)
+	if err != nil {
+		return &exitError{code: ExitUnavailable, err: fmt.Errorf("failed to connect to db: %w", err)}
+	}
+	defer pool.Close()
+
+	// replicas are not waited for, they serve reads once their health check passes
+	var replicas []*pgxpool.Pool
+	for _, u := range cfg.Database.ReplicaURLs {
+		replicaOpts := poolOpts
+		replicaOpts.ConnString = u
+
+		replica, err := pg.Open(ctx, replicaOpts)
+		if err != nil {
+			return fmt.Errorf("failed to open db replica: %w", err)
+		}
+		defer replica.Close()
+
+		replicas = append(replicas, replica)
+	}
+
+	store := datastore.NewWithReplicas(pool, replicas, datastore.ReplicaOptions{
+		MaxLag:        cfg.Database.ReplicaMaxLag,
+		CheckInterval: cfg.Database.ReplicaCheckInterval,
+		CheckTimeout:  cfg.Health.CheckTimeout,
+	})
+
+	// checked before migrating, an older binary must not serve or migrate the
+	// schema of a newer one
+	version, err := store.SchemaVersion(ctx)
+	if err != nil && !errors.Is(err, datastore.ErrSchemaNotMigrated) {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	latest, err := migrations.LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	if err = checkSchemaVersion(version, latest); err != nil {
+		return err
+	}
+
+	if cfg.AutoMigrate {
+		if err = autoMigrate(ctx, pool); err != nil {
+			return err
+		}
+	}
+
+	mailer, err := newMailer(cfg.Mail, cfg.PublicURL)
+	if err != nil {
+		return fmt.Errorf("failed to configure mailer: %w", err)
+	}
+
+	m := metrics.New()
+	m.MustRegister(metrics.NewPoolCollector(pool))
+
+	svc := api.New(config.NewRuntime(cfg, src), store, mailer, m, c.LogLevel)
+	if err = svc.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start api: %w", err)
+	}
+
+	return nil
+}
+
+func newMailer(cfg config.MailConfig, publicURL string) (mail.Mailer, error) {
+	switch cfg.Driver {
+	case config.MailDriverSMTP:
+		return mail.NewSMTPMailer(mail.SMTPOptions{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}), nil
+	case config.MailDriverFile:
+		return mail.NewFileMailer(cfg.Dir, cfg.From)
+	default:
+		if isLocalURL(publicURL) {
+			slog.Warn("mails are only logged, set MAIL_DRIVER to deliver them")
+		} else {
+			slog.Error("MAIL_DRIVER is log outside of development, verification and password reset mails are NOT delivered", "public_url", publicURL)
+		}
+		return mail.LogMailer{}, nil
+	}
+}
+
+// isLocalURL tells whether the app is reached on this machine, as it is in
+// development.
+func isLocalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
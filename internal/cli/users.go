@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/api"
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/internal/validator"
+)
+
+var userRoles = []string{datastore.RoleAdmin, datastore.RoleEditor}
+
+// runUsers creates users and grants them roles, to set up the first admin of
+// a fresh database.
+func runUsers(ctx context.Context, c *CLI, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("users needs one of create or grant")
+	}
+
+	action, args := args[0], args[1:]
+	switch action {
+	case "create":
+		return runUsersCreate(ctx, c, args)
+	case "grant":
+		return runUsersGrant(ctx, c, args)
+	default:
+		return usageErrorf("unknown users command %q, use one of create or grant", action)
+	}
+}
+
+func runUsersCreate(ctx context.Context, c *CLI, args []string) error {
+	var roles []string
+
+	fs := c.flagSet("users create", "")
+	email := fs.String("email", "", "`email` address of the user, it counts as verified")
+	name := fs.String("name", "", "display `name` of the user")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin, without one the user resets it")
+	fs.Func("role", "`role` to grant, admin or editor, repeat for more", func(role string) error {
+		roles = append(roles, role)
+		return nil
+	})
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageErrorf("users create takes no arguments")
+	}
+
+	v := validator.New()
+	v.Required("email", *email)
+	v.Email("email", *email)
+	v.MaxLength("name", *name, 100)
+	for _, role := range roles {
+		v.In("role", role, userRoles...)
+	}
+	if !v.IsValid() {
+		return usageErrorf("%s", strings.Join(v.GetErrors(), ", "))
+	}
+
+	user := &datastore.User{
+		Email:           strings.ToLower(*email),
+		Name:            sql.NullString{String: *name, Valid: *name != ""},
+		EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		Roles:           uniqueRoles(roles),
+	}
+
+	if *passwordStdin {
+		password, err := readPassword(c)
+		if err != nil {
+			return err
+		}
+
+		if user.PasswordHash, err = api.HashPassword(password); err != nil {
+			return usageErrorf("%w", err)
+		}
+	}
+
+	_, pool, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	err = datastore.New(pool).InsertUser(ctx, user)
+	if errors.Is(err, datastore.ErrUserEmailExists) {
+		return fmt.Errorf("a user with email %s already exists", user.Email)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create user: %w", err)
+	}
+
+	fmt.Fprintf(c.Stdout, "created user %d %s\n", user.ID, user.Email)
+	return nil
+}
+
+func runUsersGrant(ctx context.Context, c *CLI, args []string) error {
+	fs := c.flagSet("users grant", "<email> <role>...")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return usageErrorf("users grant needs an email and one or more roles")
+	}
+
+	email, roles := strings.ToLower(fs.Arg(0)), fs.Args()[1:]
+
+	v := validator.New()
+	for _, role := range roles {
+		v.In("role", role, userRoles...)
+	}
+	if !v.IsValid() {
+		return usageErrorf("%s", strings.Join(v.GetErrors(), ", "))
+	}
+
+	_, pool, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	store := datastore.New(pool)
+
+	user, err := store.GetUserByEmail(ctx, email)
+	if errors.Is(err, datastore.ErrUserNotFound) {
+		return fmt.Errorf("no user with email %s", email)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get user: %w", err)
+	}
+
+	roles = uniqueRoles(append(user.Roles, roles...))
+	if err = store.SetUserRoles(ctx, user.ID, roles); err != nil {
+		return fmt.Errorf("could not grant roles: %w", err)
+	}
+
+	fmt.Fprintf(c.Stdout, "user %d %s has roles %s\n", user.ID, user.Email, strings.Join(roles, ", "))
+	return nil
+}
+
+// readPassword reads the password from the first line of stdin, so it stays
+// out of the shell history and the process list.
+func readPassword(c *CLI) (string, error) {
+	line, err := bufio.NewReader(c.Stdin).ReadString('\n')
+	if line == "" && err != nil {
+		return "", usageErrorf("could not read the password from stdin: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func uniqueRoles(roles []string) []string {
+	roles = slices.Clone(roles)
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
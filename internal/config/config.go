@@ -1,23 +1,633 @@
 package config
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/caarlos0/env/v11"
+	"github.com/tommarien/movie-land/internal/secret"
 )
 
+// Config is parsed from the environment. Fields tagged secret are redacted in
+// a Dump, "password" only redacts the password of a connection string.
 type Config struct {
-	DatabaseUrl         string        `env:"DATABASE_URL,notEmpty"`
+	DatabaseUrl         string        `env:"DATABASE_URL,notEmpty" secret:"password"`
 	DatabasePingTimeout time.Duration `env:"DATABASE_PING_TIMEOUT" envDefault:"200ms"`
 	Port                int           `env:"PORT" envDefault:"3000"`
+	// LogLevel is one of debug, info, warn or error, it can be changed at runtime through the admin listener
+	LogLevel slog.Level `env:"LOG_LEVEL" envDefault:"info"`
+	// PublicURL is the address users reach the app on, it is used to build links in emails
+	PublicURL string `env:"PUBLIC_URL" envDefault:"http://localhost:3000"`
+	// TrustedProxies lists the IP addresses or CIDR ranges of the proxies whose
+	// X-Forwarded-For header is trusted to determine the client IP address
+	TrustedProxies []string          `env:"TRUSTED_PROXIES"`
+	Database       DatabaseConfig    `envPrefix:"DATABASE_"`
+	Session        SessionConfig     `envPrefix:"SESSION_"`
+	OIDC           OIDCConfig        `envPrefix:"OIDC_"`
+	Auth           AuthConfig        `envPrefix:"AUTH_"`
+	Lockout        LockoutConfig     `envPrefix:"LOCKOUT_"`
+	RateLimit      RateLimitConfig   `envPrefix:"RATE_LIMIT_"`
+	Mail           MailConfig        `envPrefix:"MAIL_"`
+	Metrics        MetricsConfig     `envPrefix:"METRICS_"`
+	Tracing        TracingConfig     `envPrefix:"TRACING_"`
+	Health         HealthConfig      `envPrefix:"HEALTH_"`
+	GRPC           GRPCConfig        `envPrefix:"GRPC_"`
+	Idempotency    IdempotencyConfig `envPrefix:"IDEMPOTENCY_"`
+	TLS            TLSConfig         `envPrefix:"TLS_"`
+	Server         ServerConfig      `envPrefix:"SERVER_"`
+	Admin          AdminConfig       `envPrefix:"ADMIN_"`
+	CORS           CORSConfig        `envPrefix:"CORS_"`
+	// Features turns features on or off, e.g. "graphql=false,catalog=true",
+	// features not listed are on
+	Features map[string]bool `env:"FEATURES" envKeyValSeparator:"="`
+	// ConfigWatchInterval is how often the config file is checked for changes
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" envDefault:"10s"`
+	// AutoMigrate applies the pending migrations before serving, replicas
+	// starting together take turns through an advisory lock
+	AutoMigrate bool `env:"AUTO_MIGRATE"`
 }
 
-func FromEnv() (*Config, error) {
-	var cfg Config
+const (
+	// FeatureGraphQL serves the GraphQL endpoint
+	FeatureGraphQL = "graphql"
+	// FeatureCatalog serves the export and import of the catalog
+	FeatureCatalog = "catalog"
+)
+
+// FeatureEnabled tells whether the feature is on.
+func (cfg *Config) FeatureEnabled(name string) bool {
+	enabled, ok := cfg.Features[name]
+	return !ok || enabled
+}
+
+type SessionConfig struct {
+	TTL          time.Duration `env:"TTL" envDefault:"8h"`
+	CookieSecure bool          `env:"COOKIE_SECURE" envDefault:"true"`
+	// StepUpMaxAge is how long ago the second factor may have been passed
+	// before sensitive operations ask for it again
+	StepUpMaxAge time.Duration `env:"STEP_UP_MAX_AGE" envDefault:"5m"`
+}
+
+// OIDCConfig configures the staff login through an OpenID Connect provider,
+// it is disabled when no IssuerURL is set.
+type OIDCConfig struct {
+	IssuerURL    string   `env:"ISSUER_URL"`
+	ClientID     string   `env:"CLIENT_ID"`
+	ClientSecret string   `env:"CLIENT_SECRET" secret:"true"`
+	RedirectURL  string   `env:"REDIRECT_URL"`
+	Scopes       []string `env:"SCOPES" envDefault:"openid,profile,email"`
+	RolesClaim   string   `env:"ROLES_CLAIM" envDefault:"groups"`
+	// RoleMapping maps a value of the roles claim onto a local role,
+	// e.g. "movie-land-admins:admin,movie-land-editors:editor"
+	RoleMapping map[string]string `env:"ROLE_MAPPING"`
+}
+
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
+type AuthConfig struct {
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"24h"`
+	PasswordResetTTL     time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+	// TOTPEncryptionKey is a base64 encoded 32 byte key encrypting the TOTP secrets at rest,
+	// two-factor authentication is disabled without it
+	TOTPEncryptionKey string `env:"TOTP_ENCRYPTION_KEY" secret:"true"`
+	TOTPIssuer        string `env:"TOTP_ISSUER" envDefault:"MovieLand"`
+}
+
+func (c AuthConfig) TOTPEnabled() bool {
+	return c.TOTPEncryptionKey != ""
+}
+
+// LockoutConfig configures the protection against guessing passwords and codes.
+// Failed attempts are counted per account and per IP address, after FreeAttempts
+// each further attempt has to wait an exponentially growing delay, starting at
+// BaseDelay and capped at MaxDelay. Reaching the threshold locks out the account
+// or IP address for Duration. Failures older than ResetAfter are forgotten.
+type LockoutConfig struct {
+	FreeAttempts     int           `env:"FREE_ATTEMPTS" envDefault:"3"`
+	BaseDelay        time.Duration `env:"BASE_DELAY" envDefault:"1s"`
+	MaxDelay         time.Duration `env:"MAX_DELAY" envDefault:"1m"`
+	AccountThreshold int           `env:"ACCOUNT_THRESHOLD" envDefault:"10"`
+	IPThreshold      int           `env:"IP_THRESHOLD" envDefault:"50"`
+	Duration         time.Duration `env:"DURATION" envDefault:"15m"`
+	ResetAfter       time.Duration `env:"RESET_AFTER" envDefault:"1h"`
+}
+
+const (
+	RateLimitBackendMemory   = "memory"
+	RateLimitBackendPostgres = "postgres"
+)
+
+const (
+	RateLimitGroupRead  = "read"
+	RateLimitGroupWrite = "write"
+)
+
+// RateLimitConfig configures the token buckets limiting the requests per client,
+// reads and writes are limited separately. Use the postgres backend when running
+// multiple replicas so the limits hold across them.
+type RateLimitConfig struct {
+	Enabled bool `env:"ENABLED" envDefault:"true"`
+	// Backend is one of memory or postgres
+	Backend       string        `env:"BACKEND" envDefault:"memory"`
+	ReadRequests  int           `env:"READ_REQUESTS" envDefault:"300"`
+	ReadPeriod    time.Duration `env:"READ_PERIOD" envDefault:"1m"`
+	WriteRequests int           `env:"WRITE_REQUESTS" envDefault:"30"`
+	WritePeriod   time.Duration `env:"WRITE_PERIOD" envDefault:"1m"`
+	// APIKeyHeader names the header whose API key identifies the client, it
+	// takes precedence over the session, empty turns it off
+	APIKeyHeader string `env:"API_KEY_HEADER" envDefault:"X-API-Key"`
+	// APIKeys are the keys limited per key, requests with any other key are
+	// limited like those without one so made up keys cannot dodge the limits
+	APIKeys []string `env:"API_KEYS" secret:"true"`
+	// Groups maps a route pattern onto the read or write group, e.g.
+	// "GET /api/v1/export=write", routes not listed are grouped by method
+	Groups map[string]string `env:"GROUPS" envKeyValSeparator:"="`
+}
+
+const (
+	MailDriverLog  = "log"
+	MailDriverFile = "file"
+	MailDriverSMTP = "smtp"
+)
+
+type MailConfig struct {
+	// Driver is one of log, file or smtp
+	Driver       string `env:"DRIVER" envDefault:"log"`
+	From         string `env:"FROM" envDefault:"no-reply@movie-land.local"`
+	Dir          string `env:"DIR" envDefault:"./tmp/mail"`
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     int    `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD" secret:"true"`
+	// RateLimit caps the number of mails of a kind sent to one address within RateLimitWindow
+	RateLimit       int           `env:"RATE_LIMIT" envDefault:"3"`
+	RateLimitWindow time.Duration `env:"RATE_LIMIT_WINDOW" envDefault:"1h"`
+}
+
+// MetricsConfig configures the Prometheus /metrics endpoint, it is served on
+// its own port so it need not be exposed along with the public API.
+type MetricsConfig struct {
+	Enabled bool `env:"ENABLED" envDefault:"true"`
+	Port    int  `env:"PORT" envDefault:"9090"`
+}
+
+// GRPCConfig configures the gRPC API, it is served on its own port next to
+// the REST API.
+type GRPCConfig struct {
+	Enabled bool `env:"ENABLED" envDefault:"true"`
+	Port    int  `env:"PORT" envDefault:"50051"`
+}
+
+// AdminConfig configures the admin listener serving pprof, the effective
+// config, the statistics of the database pool and the log level. It must not
+// be reachable publicly, so it binds to localhost unless Addr says otherwise.
+type AdminConfig struct {
+	Enabled bool   `env:"ENABLED" envDefault:"true"`
+	Addr    string `env:"ADDR" envDefault:"localhost:6060"`
+}
+
+// DatabaseConfig tunes the connection pool, zero values keep the defaults of
+// pgx and the pool_ parameters of DATABASE_URL.
+type DatabaseConfig struct {
+	// ConnectTimeout is how long startup keeps retrying to reach the database,
+	// each attempt waits DATABASE_PING_TIMEOUT at most
+	ConnectTimeout    time.Duration `env:"CONNECT_TIMEOUT" envDefault:"30s"`
+	MaxConns          int32         `env:"MAX_CONNS"`
+	MinConns          int32         `env:"MIN_CONNS"`
+	MaxConnLifetime   time.Duration `env:"MAX_CONN_LIFETIME"`
+	MaxConnIdleTime   time.Duration `env:"MAX_CONN_IDLE_TIME"`
+	HealthCheckPeriod time.Duration `env:"HEALTH_CHECK_PERIOD"`
+	// StatementTimeout cancels statements running longer on the server
+	StatementTimeout time.Duration `env:"STATEMENT_TIMEOUT"`
+	// ApplicationName shows up in pg_stat_activity and the server logs
+	ApplicationName string `env:"APPLICATION_NAME" envDefault:"movie-land"`
+	// SimpleProtocol sends queries without preparing them, which PgBouncer
+	// needs in transaction pooling mode
+	SimpleProtocol bool `env:"SIMPLE_PROTOCOL"`
+	// ReplicaURLs are read replicas serving the reads of the catalog, with
+	// the same pool settings as the primary
+	ReplicaURLs []string `env:"REPLICA_URLS" secret:"password"`
+	// ReplicaMaxLag is how far a replica may be behind and still serve reads
+	ReplicaMaxLag        time.Duration `env:"REPLICA_MAX_LAG" envDefault:"10s"`
+	ReplicaCheckInterval time.Duration `env:"REPLICA_CHECK_INTERVAL" envDefault:"5s"`
+}
+
+// CORSConfig lets browsers on other origins call the API with the session
+// cookie, it is disabled while no AllowedOrigins are set.
+type CORSConfig struct {
+	// AllowedOrigins lists origins like "https://admin.example.com"
+	AllowedOrigins []string `env:"ALLOWED_ORIGINS"`
+	// MaxAge is how long browsers may cache the answer to a preflight request
+	MaxAge time.Duration `env:"MAX_AGE" envDefault:"10m"`
+}
+
+// IdempotencyConfig configures the Idempotency-Key support of POST requests,
+// their responses are replayed to retries within TTL.
+type IdempotencyConfig struct {
+	Enabled bool          `env:"ENABLED" envDefault:"true"`
+	TTL     time.Duration `env:"TTL" envDefault:"24h"`
+}
+
+// ServerConfig hardens the HTTP server of the API. The timeouts of the server
+// hold per connection, HandlerTimeout per request, RouteTimeouts override it
+// per route pattern, where 0 lets streaming routes run as long as they need.
+// They are merged into the defaults, so overriding one route keeps the others.
+// RouteBodyLimits override MaxBodyBytes per route pattern. Requests beyond
+// MaxConcurrentRequests are shed with a 503, 0 turns the limit off.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `env:"READ_HEADER_TIMEOUT" envDefault:"5s"`
+	ReadTimeout       time.Duration `env:"READ_TIMEOUT" envDefault:"30s"`
+	WriteTimeout      time.Duration `env:"WRITE_TIMEOUT" envDefault:"1m"`
+	IdleTimeout       time.Duration `env:"IDLE_TIMEOUT" envDefault:"2m"`
+	MaxHeaderBytes    int           `env:"MAX_HEADER_BYTES" envDefault:"65536"`
+	ShutdownTimeout   time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	HandlerTimeout    time.Duration `env:"HANDLER_TIMEOUT" envDefault:"30s"`
+	// RouteTimeouts maps a route pattern onto its timeout, e.g. "POST /api/v1/import=5m"
+	RouteTimeouts map[string]time.Duration `env:"ROUTE_TIMEOUTS" envKeyValSeparator:"="`
+	MaxBodyBytes  int64                    `env:"MAX_BODY_BYTES" envDefault:"1048576"`
+	// RouteBodyLimits maps a route pattern onto its body limit in bytes, e.g. "POST /api/v1/import=67108864"
+	RouteBodyLimits       map[string]int64 `env:"ROUTE_BODY_LIMITS" envKeyValSeparator:"=" envDefault:"POST /api/v1/import=67108864"`
+	MaxConcurrentRequests int              `env:"MAX_CONCURRENT_REQUESTS" envDefault:"1000"`
+}
+
+// defaultRouteTimeouts serve the export without a deadline and give the
+// import longer than the other routes.
+var defaultRouteTimeouts = map[string]time.Duration{
+	"GET /api/v1/export":  0,
+	"POST /api/v1/import": 5 * time.Minute,
+}
+
+// mergeDefaults merges the route timeouts into defaultRouteTimeouts.
+func (c *ServerConfig) mergeDefaults() {
+	timeouts := maps.Clone(defaultRouteTimeouts)
+	maps.Copy(timeouts, c.RouteTimeouts)
+	c.RouteTimeouts = timeouts
+}
+
+const (
+	TLSClientAuthOptional = "optional"
+	TLSClientAuthRequire  = "require"
+)
+
+// TLSConfig configures HTTPS on PORT and TLS on GRPC_PORT, it is disabled when
+// no CertFile is set. The files are reloaded on SIGHUP and when they change,
+// without dropping the open connections.
+type TLSConfig struct {
+	CertFile string `env:"CERT_FILE"`
+	KeyFile  string `env:"KEY_FILE"`
+	// MinVersion is one of 1.2 or 1.3
+	MinVersion string `env:"MIN_VERSION" envDefault:"1.2"`
+	// CipherSuites restricts the TLS 1.2 cipher suites, e.g.
+	// "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", the TLS 1.3 ones are not configurable
+	CipherSuites []string `env:"CIPHER_SUITES"`
+	// ClientCAFile enables mutual TLS, client certificates are verified against its CAs
+	ClientCAFile string `env:"CLIENT_CA_FILE"`
+	// ClientAuth is one of optional or require, optional only verifies the
+	// certificates clients present
+	ClientAuth string `env:"CLIENT_AUTH" envDefault:"optional"`
+	// ClientIdentities maps the CN or a SAN of a client certificate onto the
+	// identity of an internal caller, e.g. "ingest.internal=ingest,spiffe://corp/billing=billing"
+	ClientIdentities map[string]string `env:"CLIENT_IDENTITIES" envKeyValSeparator:"="`
+	// WatchInterval is how often the files are checked for changes
+	WatchInterval time.Duration `env:"WATCH_INTERVAL" envDefault:"10s"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c TLSConfig) ClientAuthEnabled() bool {
+	return c.ClientCAFile != ""
+}
+
+// Version returns the minimum TLS version, 0 when MinVersion is invalid.
+func (c TLSConfig) Version() uint16 {
+	switch c.MinVersion {
+	case "1.2":
+		return tls.VersionTLS12
+	case "1.3":
+		return tls.VersionTLS13
+	default:
+		return 0
+	}
+}
+
+// CipherSuiteIDs returns the IDs of the CipherSuites, nil leaves the choice to
+// Go. Names of insecure or unknown suites are left out.
+func (c TLSConfig) CipherSuiteIDs() []uint16 {
+	var ids []uint16
+	for _, name := range c.CipherSuites {
+		for _, suite := range tls.CipherSuites() {
+			if suite.Name == name {
+				ids = append(ids, suite.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// HealthConfig configures the readiness checks. DrainDelay is how long the
+// server keeps serving after SIGTERM with a failing readiness, so load
+// balancers stop routing to it before it shuts down.
+type HealthConfig struct {
+	CheckTimeout time.Duration `env:"CHECK_TIMEOUT" envDefault:"1s"`
+	DrainDelay   time.Duration `env:"DRAIN_DELAY" envDefault:"5s"`
+}
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// TracingConfig configures the OpenTelemetry traces, they are exported over
+// OTLP/HTTP or written to stdout for local development.
+type TracingConfig struct {
+	// Exporter is one of none, otlp or stdout
+	Exporter    string `env:"EXPORTER" envDefault:"none"`
+	ServiceName string `env:"SERVICE_NAME" envDefault:"movie-land"`
+	// OTLPEndpoint is the host and port of the collector, e.g. "otel-collector:4318"
+	OTLPEndpoint string `env:"OTLP_ENDPOINT" envDefault:"localhost:4318"`
+	OTLPInsecure bool   `env:"OTLP_INSECURE" envDefault:"false"`
+	// SampleRatio is the fraction of the traces started here that is recorded,
+	// traces started upstream follow the sampling decision of their parent
+	SampleRatio float64 `env:"SAMPLE_RATIO" envDefault:"1"`
+}
+
+func (cfg *Config) validate() error {
+	var errs []error
+
+	if cfg.OIDC.Enabled() {
+		if cfg.OIDC.ClientID == "" {
+			errs = append(errs, errors.New("config: OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set"))
+		}
+		if cfg.OIDC.RedirectURL == "" {
+			errs = append(errs, errors.New("config: OIDC_REDIRECT_URL is required when OIDC_ISSUER_URL is set"))
+		}
+	}
+
+	// the roles are checked by the database, a typo would fail every login
+	for _, value := range cfg.OIDC.RoleMapping {
+		switch value {
+		case "admin", "editor":
+		default:
+			errs = append(errs, fmt.Errorf("config: OIDC_ROLE_MAPPING must map onto admin or editor, got %q", value))
+		}
+	}
+
+	if cfg.Auth.TOTPEnabled() {
+		if _, err := secret.ParseKey(cfg.Auth.TOTPEncryptionKey); err != nil {
+			errs = append(errs, errors.New("config: AUTH_TOTP_ENCRYPTION_KEY must be a base64 encoded 32 byte key"))
+		}
+	}
+
+	if cfg.Lockout.AccountThreshold <= cfg.Lockout.FreeAttempts || cfg.Lockout.IPThreshold <= cfg.Lockout.FreeAttempts {
+		errs = append(errs, errors.New("config: LOCKOUT_ACCOUNT_THRESHOLD and LOCKOUT_IP_THRESHOLD must exceed LOCKOUT_FREE_ATTEMPTS"))
+	}
+
+	for _, proxy := range cfg.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("config: TRUSTED_PROXIES must contain IP addresses or CIDR ranges, got %q", proxy))
+		}
+	}
+
+	switch cfg.RateLimit.Backend {
+	case RateLimitBackendMemory, RateLimitBackendPostgres:
+	default:
+		errs = append(errs, fmt.Errorf("config: RATE_LIMIT_BACKEND must be one of memory or postgres, got %q", cfg.RateLimit.Backend))
+	}
+
+	if cfg.RateLimit.ReadRequests <= 0 || cfg.RateLimit.WriteRequests <= 0 || cfg.RateLimit.ReadPeriod <= 0 || cfg.RateLimit.WritePeriod <= 0 {
+		errs = append(errs, errors.New("config: RATE_LIMIT_ requests and periods must be positive"))
+	}
+
+	for pattern, group := range cfg.RateLimit.Groups {
+		if !validRoutePattern(pattern) {
+			errs = append(errs, fmt.Errorf("config: RATE_LIMIT_GROUPS must contain route patterns like \"GET /path\", got %q", pattern))
+		}
+		if group != RateLimitGroupRead && group != RateLimitGroupWrite {
+			errs = append(errs, fmt.Errorf("config: RATE_LIMIT_GROUPS must map onto read or write, got %q for %q", group, pattern))
+		}
+	}
+
+	if cfg.Metrics.Enabled && cfg.Metrics.Port == cfg.Port {
+		errs = append(errs, errors.New("config: METRICS_PORT must differ from PORT"))
+	}
+
+	if cfg.GRPC.Enabled && (cfg.GRPC.Port == cfg.Port || cfg.Metrics.Enabled && cfg.GRPC.Port == cfg.Metrics.Port) {
+		errs = append(errs, errors.New("config: GRPC_PORT must differ from PORT and METRICS_PORT"))
+	}
+
+	if cfg.Admin.Enabled {
+		_, port, err := net.SplitHostPort(cfg.Admin.Addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config: ADMIN_ADDR must be a host and port, got %q", cfg.Admin.Addr))
+		} else if port == strconv.Itoa(cfg.Port) || cfg.Metrics.Enabled && port == strconv.Itoa(cfg.Metrics.Port) || cfg.GRPC.Enabled && port == strconv.Itoa(cfg.GRPC.Port) {
+			errs = append(errs, errors.New("config: ADMIN_ADDR must use a port other than PORT, METRICS_PORT and GRPC_PORT"))
+		}
+	}
+
+	if cfg.Idempotency.TTL <= 0 {
+		errs = append(errs, errors.New("config: IDEMPOTENCY_TTL must be positive"))
+	}
+
+	errs = append(errs, cfg.Database.validate(), cfg.TLS.validate(), cfg.Server.validate(), cfg.CORS.validate())
+
+	for name := range cfg.Features {
+		switch name {
+		case FeatureGraphQL, FeatureCatalog:
+		default:
+			errs = append(errs, fmt.Errorf("config: FEATURES must contain features like graphql or catalog, got %q", name))
+		}
+	}
+
+	if cfg.ConfigWatchInterval <= 0 {
+		errs = append(errs, errors.New("config: CONFIG_WATCH_INTERVAL must be positive"))
+	}
+
+	switch cfg.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterOTLP, TracingExporterStdout:
+	default:
+		errs = append(errs, fmt.Errorf("config: TRACING_EXPORTER must be one of none, otlp or stdout, got %q", cfg.Tracing.Exporter))
+	}
+
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("config: TRACING_SAMPLE_RATIO must be between 0 and 1"))
+	}
+
+	if cfg.Health.CheckTimeout <= 0 || cfg.Health.DrainDelay < 0 {
+		errs = append(errs, errors.New("config: HEALTH_CHECK_TIMEOUT must be positive and HEALTH_DRAIN_DELAY must not be negative"))
+	}
+
+	switch cfg.Mail.Driver {
+	case MailDriverLog, MailDriverFile:
+	case MailDriverSMTP:
+		if cfg.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("config: MAIL_SMTP_HOST is required when MAIL_DRIVER is smtp"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("config: MAIL_DRIVER must be one of log, file or smtp, got %q", cfg.Mail.Driver))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c DatabaseConfig) validate() error {
+	var errs []error
+
+	if c.ConnectTimeout < 0 || c.MaxConnLifetime < 0 || c.MaxConnIdleTime < 0 || c.HealthCheckPeriod < 0 || c.StatementTimeout < 0 {
+		errs = append(errs, errors.New("config: DATABASE_ timeouts must not be negative"))
+	}
+
+	for _, u := range c.ReplicaURLs {
+		if !strings.Contains(u, "://") {
+			errs = append(errs, errors.New("config: DATABASE_REPLICA_URLS must contain postgres:// URLs"))
+			break
+		}
+	}
+
+	if c.ReplicaMaxLag <= 0 || c.ReplicaCheckInterval <= 0 {
+		errs = append(errs, errors.New("config: DATABASE_REPLICA_MAX_LAG and DATABASE_REPLICA_CHECK_INTERVAL must be positive"))
+	}
+
+	if c.MaxConns < 0 || c.MinConns < 0 {
+		errs = append(errs, errors.New("config: DATABASE_MAX_CONNS and DATABASE_MIN_CONNS must not be negative"))
+	} else if c.MaxConns > 0 && c.MinConns > c.MaxConns {
+		errs = append(errs, errors.New("config: DATABASE_MIN_CONNS must not exceed DATABASE_MAX_CONNS"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c TLSConfig) validate() error {
+	if !c.Enabled() {
+		if c.KeyFile != "" || c.ClientCAFile != "" {
+			return errors.New("config: TLS_CERT_FILE is required when TLS_KEY_FILE or TLS_CLIENT_CA_FILE is set")
+		}
+		return nil
+	}
+
+	var errs []error
+
+	if c.KeyFile == "" {
+		errs = append(errs, errors.New("config: TLS_KEY_FILE is required when TLS_CERT_FILE is set"))
+	}
+
+	if c.Version() == 0 {
+		errs = append(errs, fmt.Errorf("config: TLS_MIN_VERSION must be one of 1.2 or 1.3, got %q", c.MinVersion))
+	}
+
+	if len(c.CipherSuiteIDs()) != len(c.CipherSuites) {
+		errs = append(errs, errors.New("config: TLS_CIPHER_SUITES must contain names of secure cipher suites"))
+	}
+
+	switch c.ClientAuth {
+	case TLSClientAuthOptional, TLSClientAuthRequire:
+	default:
+		errs = append(errs, fmt.Errorf("config: TLS_CLIENT_AUTH must be one of optional or require, got %q", c.ClientAuth))
+	}
+
+	if len(c.ClientIdentities) > 0 && !c.ClientAuthEnabled() {
+		errs = append(errs, errors.New("config: TLS_CLIENT_CA_FILE is required when TLS_CLIENT_IDENTITIES is set"))
+	}
+
+	if c.WatchInterval <= 0 {
+		errs = append(errs, errors.New("config: TLS_WATCH_INTERVAL must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c ServerConfig) validate() error {
+	var errs []error
+
+	if c.ReadHeaderTimeout <= 0 {
+		errs = append(errs, errors.New("config: SERVER_READ_HEADER_TIMEOUT must be positive"))
+	}
+
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.HandlerTimeout < 0 {
+		errs = append(errs, errors.New("config: SERVER_ timeouts must not be negative"))
+	}
+
+	// a handler that times out still has to be able to write its 503
+	if c.WriteTimeout > 0 && (c.HandlerTimeout == 0 || c.WriteTimeout <= c.HandlerTimeout) {
+		errs = append(errs, errors.New("config: SERVER_WRITE_TIMEOUT must exceed SERVER_HANDLER_TIMEOUT"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("config: SERVER_SHUTDOWN_TIMEOUT must be positive"))
+	}
+
+	if c.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("config: SERVER_MAX_HEADER_BYTES must be positive"))
+	}
+
+	if c.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("config: SERVER_MAX_BODY_BYTES must be positive"))
+	}
+
+	for pattern, timeout := range c.RouteTimeouts {
+		if !validRoutePattern(pattern) {
+			errs = append(errs, fmt.Errorf("config: SERVER_ROUTE_TIMEOUTS must contain route patterns like \"GET /path\", got %q", pattern))
+		}
+		if timeout < 0 {
+			errs = append(errs, fmt.Errorf("config: SERVER_ROUTE_TIMEOUTS must not be negative, got %s for %q", timeout, pattern))
+		}
+	}
+
+	for pattern, limit := range c.RouteBodyLimits {
+		if !validRoutePattern(pattern) {
+			errs = append(errs, fmt.Errorf("config: SERVER_ROUTE_BODY_LIMITS must contain route patterns like \"POST /path\", got %q", pattern))
+		}
+		if limit <= 0 {
+			errs = append(errs, fmt.Errorf("config: SERVER_ROUTE_BODY_LIMITS must be positive, got %d for %q", limit, pattern))
+		}
+	}
+
+	if c.MaxConcurrentRequests < 0 {
+		errs = append(errs, errors.New("config: SERVER_MAX_CONCURRENT_REQUESTS must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c CORSConfig) validate() error {
+	var errs []error
+
+	for _, origin := range c.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("config: CORS_ALLOWED_ORIGINS must contain origins like https://example.com, got %q", origin))
+		}
+	}
+
+	if c.MaxAge < 0 {
+		errs = append(errs, errors.New("config: CORS_MAX_AGE must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
 
-	if err := env.Parse(&cfg); err != nil {
-		return nil, err
+// validRoutePattern tells whether the pattern looks like the ones the routes
+// are registered with, a method followed by a path.
+func validRoutePattern(pattern string) bool {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok || method == "" || !strings.HasPrefix(path, "/") {
+		return false
 	}
 
-	return &cfg, nil
+	return strings.ToUpper(method) == method
 }
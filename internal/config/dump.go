@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Redacted replaces the secrets in a Dump.
+const Redacted = "REDACTED"
+
+// setting is a field of the config, named after its env var.
+type setting struct {
+	key string
+	// separator of the keys and values of maps
+	separator string
+	secret    string
+	value     reflect.Value
+}
+
+// settings walks the fields of the config struct, prefixing the names of
+// the nested structs' fields like env does.
+func settings(v reflect.Value, prefix string) []setting {
+	var all []setting
+
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+
+		if p, ok := field.Tag.Lookup("envPrefix"); ok {
+			all = append(all, settings(v.Field(i), prefix+p)...)
+			continue
+		}
+
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if key == "" {
+			continue
+		}
+
+		separator := field.Tag.Get("envKeyValSeparator")
+		if separator == "" {
+			separator = ":"
+		}
+
+		all = append(all, setting{
+			key:       prefix + key,
+			separator: separator,
+			secret:    field.Tag.Get("secret"),
+			value:     v.Field(i),
+		})
+	}
+
+	return all
+}
+
+// Dump returns the config keyed by the names of its env vars, with the values
+// formatted the way they are set. Secrets are redacted, so the dump can be
+// shown to operators.
+func (cfg *Config) Dump() map[string]string {
+	values := make(map[string]string)
+
+	for _, s := range settings(reflect.ValueOf(*cfg), "") {
+		value := formatValue(s.value.Interface(), s.separator)
+
+		switch s.secret {
+		case "password":
+			if urls, ok := s.value.Interface().([]string); ok {
+				redacted := make([]string, len(urls))
+				for i, u := range urls {
+					redacted[i] = redactPassword(u)
+				}
+				value = strings.Join(redacted, ",")
+				break
+			}
+			value = redactPassword(value)
+		case "true":
+			if value != "" {
+				value = Redacted
+			}
+		}
+
+		values[s.key] = value
+	}
+
+	return values
+}
+
+var unquotedRegexp = regexp.MustCompile(`^[A-Za-z0-9_./:@,=+-]*$`)
+
+// Print writes the Dump as lines of KEY=value, sorted by key and quoted where
+// a shell needs it, so it can be sourced or used as an env file.
+func (cfg *Config) Print(w io.Writer) error {
+	dump := cfg.Dump()
+
+	for _, key := range slices.Sorted(maps.Keys(dump)) {
+		value := dump[key]
+		if !unquotedRegexp.MatchString(value) {
+			value = "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatValue formats slices and maps like env parses them, the keys of maps
+// sorted so dumps can be compared.
+func formatValue(value any, separator string) string {
+	v := reflect.ValueOf(value)
+
+	switch {
+	case value == nil:
+		return ""
+
+	case v.Kind() == reflect.Slice:
+		parts := make([]string, v.Len())
+		for i := range v.Len() {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+
+	case v.Kind() == reflect.Map:
+		entries := make(map[string]string, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			entries[fmt.Sprint(iter.Key().Interface())] = fmt.Sprint(iter.Value().Interface())
+		}
+
+		var parts []string
+		for _, key := range slices.Sorted(maps.Keys(entries)) {
+			parts = append(parts, key+separator+entries[key])
+		}
+		return strings.Join(parts, ",")
+
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+var passwordParamRegexp = regexp.MustCompile(`password=\S+`)
+
+// redactPassword redacts the password of a connection string, a URL or the
+// keyword/value form Postgres supports as well.
+func redactPassword(connString string) string {
+	if !strings.Contains(connString, "://") {
+		return passwordParamRegexp.ReplaceAllString(connString, "password="+Redacted)
+	}
+
+	u, err := url.Parse(connString)
+	if err != nil {
+		// rather show nothing than a password in an unparseable URL
+		return Redacted
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	if u.Query().Has("password") {
+		query := u.Query()
+		query.Set("password", Redacted)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String()
+}
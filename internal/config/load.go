@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caarlos0/env/v11"
+	"go.yaml.in/yaml/v3"
+)
+
+// FromEnv loads the config without flags, from the file named by CONFIG_FILE
+// and the environment.
+func FromEnv() (*Config, error) {
+	return Load(flag.NewFlagSet("config", flag.ContinueOnError), nil)
+}
+
+// Load parses the config from a file, the environment and the flags in args,
+// each overriding the settings of the ones before.
+//
+// The file is named by the --config flag or the CONFIG_FILE env var, it is
+// read as TOML for a .toml extension and as YAML otherwise. Its keys are the
+// names of the env vars, nested by their prefix or not, in any case:
+//
+//	port: 3000
+//	rate_limit:
+//	  read_requests: 300
+//
+// Every env var can be set from a file with a _FILE variant, like
+// DATABASE_URL_FILE=/run/secrets/database-url for Docker secrets, and has a
+// flag with its name in kebab case, like --rate-limit-read-requests.
+//
+// Load registers the flags on fs, callers can add flags of their own.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	src, err := ParseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return src.Load()
+}
+
+// Source is where the config is loaded from, it loads the config again with
+// the same file and flags when reloading.
+type Source struct {
+	// File is the config file, empty when there is none
+	File  string
+	flags map[string]string
+}
+
+// ParseFlags registers the flags of the settings and --config on fs and
+// parses the args.
+func ParseFlags(fs *flag.FlagSet, args []string) (*Source, error) {
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML `file` to read the config from")
+
+	flags := make(map[string]string)
+	for _, s := range settings(reflect.ValueOf(Config{}), "") {
+		fs.Func(flagName(s.key), "overrides "+s.key, func(value string) error {
+			flags[s.key] = value
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return &Source{File: *configFile, flags: flags}, nil
+}
+
+// Load reads the file and the environment and applies the flags, the config
+// is validated as a whole.
+func (src *Source) Load() (*Config, error) {
+	all := settings(reflect.ValueOf(Config{}), "")
+
+	environ := make(map[string]string)
+	var errs []error
+
+	if src.File != "" {
+		values, err := readFile(src.File, all)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(environ, values)
+	}
+
+	for _, s := range all {
+		value, ok := os.LookupEnv(s.key)
+		path, fromFile := os.LookupEnv(s.key + "_FILE")
+
+		switch {
+		case ok && fromFile:
+			errs = append(errs, fmt.Errorf("config: %s and %s_FILE must not both be set", s.key, s.key))
+		case fromFile:
+			b, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("config: could not read %s_FILE: %w", s.key, err))
+				continue
+			}
+			// editors and echo end files with a newline
+			environ[s.key] = strings.TrimRight(string(b), "\r\n")
+		case ok:
+			environ[s.key] = value
+		}
+	}
+
+	maps.Copy(environ, src.flags)
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	var cfg Config
+
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: environ}); err != nil {
+		return nil, err
+	}
+
+	cfg.Server.mergeDefaults()
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// flagName turns RATE_LIMIT_READ_REQUESTS into rate-limit-read-requests.
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// readFile returns the settings of the config file by the names of their env
+// vars, formatted the way env parses them.
+func readFile(name string, all []setting) (map[string]string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("config: could not read config file: %w", err)
+	}
+
+	tree := make(map[string]any)
+	if strings.EqualFold(filepath.Ext(name), ".toml") {
+		err = toml.Unmarshal(b, &tree)
+	} else {
+		err = yaml.Unmarshal(b, &tree)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: could not parse config file %s: %w", name, err)
+	}
+
+	separators := make(map[string]string, len(all))
+	for _, s := range all {
+		separators[s.key] = s.separator
+	}
+
+	values := make(map[string]string)
+	var errs []error
+	flatten(tree, "", separators, values, &errs)
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return values, nil
+}
+
+// flatten walks the tables of the file, a key naming a setting takes the
+// value as is, others have to be a table of settings with the key as prefix.
+func flatten(tree map[string]any, prefix string, separators, values map[string]string, errs *[]error) {
+	for name, value := range tree {
+		key := prefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+
+		if separator, ok := separators[key]; ok {
+			values[key] = formatValue(value, separator)
+			continue
+		}
+
+		table, ok := value.(map[string]any)
+		if !ok {
+			*errs = append(*errs, fmt.Errorf("config: unknown setting %s in config file", key))
+			continue
+		}
+
+		flatten(table, key+"_", separators, values, errs)
+	}
+}
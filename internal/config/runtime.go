@@ -0,0 +1,170 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runtimeKeys are the settings a reload changes, the others keep the value
+// they started with until the next restart. RATE_LIMIT_BACKEND is left out
+// as the limiter is created on startup.
+var runtimeKeys = []string{
+	"LOG_LEVEL",
+	"RATE_LIMIT_ENABLED",
+	"RATE_LIMIT_READ_REQUESTS",
+	"RATE_LIMIT_READ_PERIOD",
+	"RATE_LIMIT_WRITE_REQUESTS",
+	"RATE_LIMIT_WRITE_PERIOD",
+	"CORS_ALLOWED_ORIGINS",
+	"CORS_MAX_AGE",
+	"FEATURES",
+}
+
+// Runtime holds the config of the running app. Handlers read the Current
+// snapshot on every request, reloads swap it for a new one.
+type Runtime struct {
+	source  *Source
+	current atomic.Pointer[Config]
+
+	// mu serializes the reloads
+	mu       sync.Mutex
+	modTime  time.Time
+	onReload []func(previous, current *Config)
+}
+
+// NewRuntime returns the runtime of the config loaded from the source, a nil
+// source never reloads.
+func NewRuntime(cfg *Config, source *Source) *Runtime {
+	rt := &Runtime{source: source}
+	rt.current.Store(cfg)
+
+	if source != nil && source.File != "" {
+		if info, err := os.Stat(source.File); err == nil {
+			rt.modTime = info.ModTime()
+		}
+	}
+
+	return rt
+}
+
+// Current returns the config in use, callers must not change it.
+func (rt *Runtime) Current() *Config {
+	return rt.current.Load()
+}
+
+// OnReload registers a function called after every reload that changed a
+// setting.
+func (rt *Runtime) OnReload(fn func(previous, current *Config)) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.onReload = append(rt.onReload, fn)
+}
+
+// Reload loads the config from the source again and takes over the runtime
+// settings that changed, logging them. An invalid config is rejected as a
+// whole, the config in use stays.
+func (rt *Runtime) Reload() error {
+	if rt.source == nil {
+		return errors.New("config: nothing to reload from")
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.source.File != "" {
+		// stamped before reading, so a change while reading is noticed next time
+		if info, err := os.Stat(rt.source.File); err == nil {
+			rt.modTime = info.ModTime()
+		}
+	}
+
+	next, err := rt.source.Load()
+	if err != nil {
+		return err
+	}
+
+	previous := rt.current.Load()
+
+	// a shallow copy shares the maps and slices, which are never changed
+	merged := *previous
+	merged.LogLevel = next.LogLevel
+	merged.RateLimit = next.RateLimit
+	merged.RateLimit.Backend = previous.RateLimit.Backend
+	merged.CORS = next.CORS
+	merged.Features = next.Features
+
+	before, after := previous.Dump(), next.Dump()
+	changed := false
+
+	for _, key := range slices.Sorted(maps.Keys(after)) {
+		if before[key] == after[key] {
+			continue
+		}
+
+		if !slices.Contains(runtimeKeys, key) {
+			slog.Warn("config change needs a restart, ignored it", "key", key, "from", before[key], "to", after[key])
+			continue
+		}
+
+		slog.Info("config changed", "key", key, "from", before[key], "to", after[key])
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	rt.current.Store(&merged)
+
+	for _, fn := range rt.onReload {
+		fn(previous, &merged)
+	}
+
+	return nil
+}
+
+// Watch reloads the config when its file changes, checking every
+// ConfigWatchInterval until the context is done. It returns right away when
+// there is no config file.
+func (rt *Runtime) Watch(ctx context.Context) {
+	if rt.source == nil || rt.source.File == "" {
+		return
+	}
+
+	ticker := time.NewTicker(rt.Current().ConfigWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(rt.source.File)
+		if err != nil {
+			slog.Warn("could not check the config file for changes", "err", err)
+			continue
+		}
+
+		rt.mu.Lock()
+		changed := !info.ModTime().Equal(rt.modTime)
+		rt.mu.Unlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := rt.Reload(); err != nil {
+			slog.Error("could not reload the config, keeping the one in use", "err", err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package config_test
+
+import (
+	"bytes"
+	"flag"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+func newRuntime(t *testing.T, content string) (*config.Runtime, string) {
+	t.Helper()
+
+	file := writeConfigFile(t, "config.yaml", content)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(new(bytes.Buffer))
+
+	src, err := config.ParseFlags(fs, []string{"--config", file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := src.Load()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	return config.NewRuntime(cfg, src), file
+}
+
+func TestRuntimeReload(t *testing.T) {
+	rt, file := newRuntime(t, "database_url: postgres://localhost/movie-land\nport: 3000\n")
+	initial := rt.Current()
+
+	var reloads int
+	rt.OnReload(func(previous, current *config.Config) {
+		reloads++
+		if previous != initial {
+			t.Errorf("expected the previous config to be the initial one")
+		}
+	})
+
+	t.Run("applies the runtime settings", func(t *testing.T) {
+		content := "database_url: postgres://localhost/movie-land\nport: 4000\nlog_level: debug\n" +
+			"rate_limit:\n  read_requests: 5\n  backend: postgres\n" +
+			"cors:\n  allowed_origins: [https://movie-land.example]\n" +
+			"features: {graphql: false}\n"
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := rt.Reload(); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+
+		cfg := rt.Current()
+		if cfg.LogLevel != slog.LevelDebug {
+			t.Errorf("expected log level %s, got %s", slog.LevelDebug, cfg.LogLevel)
+		}
+		if cfg.RateLimit.ReadRequests != 5 {
+			t.Errorf("expected 5 read requests, got %d", cfg.RateLimit.ReadRequests)
+		}
+		if len(cfg.CORS.AllowedOrigins) != 1 || cfg.CORS.AllowedOrigins[0] != "https://movie-land.example" {
+			t.Errorf("expected the allowed origins of the file, got %v", cfg.CORS.AllowedOrigins)
+		}
+		if cfg.FeatureEnabled(config.FeatureGraphQL) {
+			t.Errorf("expected graphql to be disabled")
+		}
+		if cfg.Port != 3000 {
+			t.Errorf("expected the port to need a restart, got %d", cfg.Port)
+		}
+		if cfg.RateLimit.Backend != config.RateLimitBackendMemory {
+			t.Errorf("expected the rate limit backend to need a restart, got %s", cfg.RateLimit.Backend)
+		}
+		if reloads != 1 {
+			t.Errorf("expected 1 reload, got %d", reloads)
+		}
+	})
+
+	t.Run("keeps the config when the reload is invalid", func(t *testing.T) {
+		before := rt.Current()
+
+		if err := os.WriteFile(file, []byte("database_url: postgres://localhost/movie-land\nlog_level: loud\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := rt.Reload(); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if rt.Current() != before {
+			t.Errorf("expected the config to stay")
+		}
+		if reloads != 1 {
+			t.Errorf("expected 1 reload, got %d", reloads)
+		}
+	})
+}
+
+func TestRuntimeWatch(t *testing.T) {
+	rt, file := newRuntime(t, "database_url: postgres://localhost/movie-land\nconfig_watch_interval: 10ms\n")
+
+	reloaded := make(chan *config.Config, 1)
+	rt.OnReload(func(_, current *config.Config) { reloaded <- current })
+
+	go rt.Watch(t.Context())
+
+	// a later mtime, file systems with a coarse clock would miss the change
+	content := "database_url: postgres://localhost/movie-land\nconfig_watch_interval: 10ms\nlog_level: warn\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cfg := <-reloaded:
+		if cfg.LogLevel != slog.LevelWarn {
+			t.Errorf("expected log level %s, got %s", slog.LevelWarn, cfg.LogLevel)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the config to be reloaded")
+	}
+}
+
+func TestRuntimeWithoutSource(t *testing.T) {
+	rt := config.NewRuntime(&config.Config{}, nil)
+
+	if err := rt.Reload(); err == nil {
+		t.Error("expected an error")
+	}
+}
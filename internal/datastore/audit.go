@@ -0,0 +1,196 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+)
+
+const AuditEntityGenre = "genre"
+
+type AuditEvent struct {
+	ID         int64
+	ActorID    sql.NullInt64
+	Action     string
+	EntityType string
+	EntityID   string
+	// Before and After hold JSON snapshots of the entity, Before is nil on create
+	Before    json.RawMessage
+	After     json.RawMessage
+	RequestID sql.NullString
+	IPAddress sql.NullString
+	CreatedAt time.Time
+}
+
+// AuditInfo describes who is making changes, the store records it along with
+// every mutation of the catalog.
+type AuditInfo struct {
+	ActorID   sql.NullInt64
+	RequestID string
+	IPAddress string
+}
+
+type auditInfoContextKey struct{}
+
+// WithAuditInfo returns a context carrying the audit info for the mutations made with it.
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoContextKey{}, info)
+}
+
+// AuditInfoFromContext returns the audit info of the context, the zero value when there is none.
+func AuditInfoFromContext(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoContextKey{}).(AuditInfo)
+	return info
+}
+
+// insertAuditEvent records the mutation within the transaction making it,
+// before and after are marshalled to JSON unless nil.
+func insertAuditEvent(ctx context.Context, tx pgx.Tx, action, entityType, entityID string, before, after any) error {
+	info := AuditInfoFromContext(ctx)
+
+	beforeJSON, err := marshalSnapshot(before)
+	if err != nil {
+		return err
+	}
+
+	afterJSON, err := marshalSnapshot(after)
+	if err != nil {
+		return err
+	}
+
+	const qry = `
+	INSERT INTO audit_events (actor_id, action, entity_type, entity_id, before, after, request_id, ip_address)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = tx.Exec(
+		ctx,
+		qry,
+		info.ActorID,
+		action,
+		entityType,
+		entityID,
+		beforeJSON,
+		afterJSON,
+		sql.NullString{String: info.RequestID, Valid: info.RequestID != ""},
+		sql.NullString{String: info.IPAddress, Valid: info.IPAddress != ""},
+	)
+	if err != nil {
+		return fmt.Errorf("could not insert audit event: %w", err)
+	}
+
+	return nil
+}
+
+func marshalSnapshot(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal audit snapshot: %w", err)
+	}
+
+	return b, nil
+}
+
+type AuditEventFilter struct {
+	EntityType string
+	EntityID   string
+	ActorID    int
+	Since      time.Time
+	Until      time.Time
+	// BeforeID continues the listing after the event with this id, events are listed newest first
+	BeforeID int64
+	Limit    int
+}
+
+func (ds *Store) ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]*AuditEvent, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.EntityType != "" {
+		where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		where("entity_id = ?", filter.EntityID)
+	}
+	if filter.ActorID != 0 {
+		where("actor_id = ?", filter.ActorID)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("created_at < ?", filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		where("id < ?", filter.BeforeID)
+	}
+
+	qry := `
+	SELECT id, actor_id, action, entity_type, entity_id, before, after, request_id, ip_address, created_at
+	FROM audit_events`
+
+	if len(conditions) > 0 {
+		qry += `
+	WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit)
+	qry += `
+	ORDER BY id DESC
+	LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := ds.pool.Query(ctx, qry, args...)
+	if err != nil {
+		return nil, fmt.Errorf("store: ListAuditEvents: could not query: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+
+	for rows.Next() {
+		var event AuditEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.ActorID,
+			&event.Action,
+			&event.EntityType,
+			&event.EntityID,
+			&event.Before,
+			&event.After,
+			&event.RequestID,
+			&event.IPAddress,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("store: ListAuditEvents: could not scan row: %w", err)
+		}
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: ListAuditEvents: rows error: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,99 @@
+package datastore_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func removeAllAuditEvents(t *testing.T, dbpool *pgxpool.Pool) {
+	_, err := dbpool.Exec(context.Background(), `DELETE FROM audit_events`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenreAuditEvents(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllAuditEvents(t, pool)
+	defer removeAllGenres(t, pool)
+	defer removeAllUsers(t, pool)
+
+	actor := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+	ctx := datastore.WithAuditInfo(context.Background(), datastore.AuditInfo{
+		ActorID:   sql.NullInt64{Int64: int64(actor.ID), Valid: true},
+		RequestID: "request-1",
+		IPAddress: "192.0.2.1",
+	})
+
+	genre := &datastore.Genre{Slug: "drama"}
+	if err := ds.InsertGenre(ctx, genre); err != nil {
+		t.Fatalf("failed to insert genre: %v", err)
+	}
+
+	genre.Name = sql.NullString{String: "Drama", Valid: true}
+	if err := ds.UpdateGenre(ctx, genre); err != nil {
+		t.Fatalf("failed to update genre: %v", err)
+	}
+
+	events, err := ds.ListAuditEvents(context.Background(), datastore.AuditEventFilter{
+		EntityType: datastore.AuditEntityGenre,
+		EntityID:   strconv.Itoa(genre.ID),
+		Limit:      10,
+	})
+	if err != nil {
+		t.Fatalf("failed to list audit events: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	update, create := events[0], events[1]
+
+	if update.Action != datastore.AuditActionUpdate || create.Action != datastore.AuditActionCreate {
+		t.Errorf("expected update and create events newest first, got %s and %s", update.Action, create.Action)
+	}
+
+	if create.Before != nil {
+		t.Errorf("expected no before snapshot on create, got %s", create.Before)
+	}
+
+	var before, after map[string]any
+	if err = json.Unmarshal(update.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(update.After, &after); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]any{nil, "Drama"}, []any{before["name"], after["name"]}); diff != "" {
+		t.Errorf("snapshot mismatch (-want +got):\n%s", diff)
+	}
+
+	if update.ActorID.Int64 != int64(actor.ID) || update.RequestID.String != "request-1" || update.IPAddress.String != "192.0.2.1" {
+		t.Errorf("expected the audit info to be recorded, got %+v", update)
+	}
+
+	page, err := ds.ListAuditEvents(context.Background(), datastore.AuditEventFilter{
+		ActorID:  actor.ID,
+		BeforeID: update.ID,
+		Limit:    10,
+	})
+	if err != nil {
+		t.Fatalf("failed to list audit events: %v", err)
+	}
+
+	if len(page) != 1 || page[0].ID != create.ID {
+		t.Errorf("expected only the create event before the update, got %v", page)
+	}
+}
@@ -0,0 +1,188 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// exportBatchSize is the number of rows fetched from a genre cursor at a time.
+const exportBatchSize = 500
+
+// ImportResult counts what an import did with the genres it was handed.
+type ImportResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// ExportGenres calls fn for every genre ordered by slug. The genres are read
+// through a cursor a batch at a time, in a read only snapshot so an export
+// is consistent however long it takes.
+func (ds *Store) ExportGenres(ctx context.Context, fn func(*Genre) error) error {
+	tx, err := ds.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("store: ExportGenres: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const declareQry = `
+	DECLARE genre_export NO SCROLL CURSOR FOR
+	SELECT id, slug, name, created_at
+	FROM genres
+	ORDER BY slug ASC`
+
+	if _, err = tx.Exec(ctx, declareQry); err != nil {
+		return fmt.Errorf("store: ExportGenres: could not declare cursor: %w", err)
+	}
+
+	return fetchGenres(ctx, tx, "ExportGenres", "genre_export", fn)
+}
+
+// fetchGenres calls fn for every genre of the declared cursor, fetching
+// exportBatchSize rows at a time. op names the method in the errors.
+func fetchGenres(ctx context.Context, tx pgx.Tx, op, cursor string, fn func(*Genre) error) error {
+	fetchQry := `FETCH FORWARD ` + strconv.Itoa(exportBatchSize) + ` FROM ` + cursor
+
+	for {
+		rows, err := tx.Query(ctx, fetchQry)
+		if err != nil {
+			return fmt.Errorf("store: %s: could not fetch: %w", op, err)
+		}
+
+		n := 0
+		for rows.Next() {
+			var genre Genre
+			err = rows.Scan(
+				&genre.ID,
+				&genre.Slug,
+				&genre.Name,
+				&genre.CreatedAt,
+			)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("store: %s: could not scan row: %w", op, err)
+			}
+
+			n++
+			if err = fn(&genre); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("store: %s: rows error: %w", op, err)
+		}
+
+		if n < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// ImportGenres upserts the genres next returns by slug until it returns
+// io.EOF, in a single transaction so an import either happens as a whole or
+// not at all. Genres that exist get the imported name, new ones keep the
+// imported creation time when it is set. Importing the same genres again
+// changes nothing, every change is recorded in the audit log.
+func (ds *Store) ImportGenres(ctx context.Context, next func() (*Genre, error)) (*ImportResult, error) {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("store: ImportGenres: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result := &ImportResult{}
+
+	for {
+		genre, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err = upsertGenre(ctx, tx, genre, result); err != nil {
+			return nil, fmt.Errorf("store: ImportGenres: genre %q: %w", genre.Slug, err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("store: ImportGenres: could not commit: %w", err)
+	}
+
+	return result, nil
+}
+
+// upsertGenre inserts the genre unless its slug exists, then locks the
+// existing one to update it. The insert waits for concurrent imports of the
+// same slug instead of failing on the unique constraint, a genre deleted
+// between both statements is inserted again.
+func upsertGenre(ctx context.Context, tx pgx.Tx, genre *Genre, result *ImportResult) error {
+	const insertQry = `
+	INSERT INTO genres (slug, name, created_at)
+	VALUES ($1, $2, COALESCE($3, CURRENT_TIMESTAMP))
+	ON CONFLICT (slug) DO NOTHING
+	RETURNING id, created_at`
+
+	const selectQry = `
+	SELECT id, slug, name, created_at
+	FROM genres WHERE slug = $1
+	FOR UPDATE`
+
+	createdAt := sql.NullTime{Time: genre.CreatedAt, Valid: !genre.CreatedAt.IsZero()}
+
+	var before Genre
+
+	for {
+		err := tx.QueryRow(ctx, insertQry, genre.Slug, genre.Name, createdAt).Scan(&genre.ID, &genre.CreatedAt)
+		if err == nil {
+			result.Created++
+			return insertAuditEvent(ctx, tx, AuditActionCreate, AuditEntityGenre, strconv.Itoa(genre.ID), nil, genre.snapshot())
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("could not insert: %w", err)
+		}
+
+		err = tx.QueryRow(ctx, selectQry, genre.Slug).Scan(
+			&before.ID,
+			&before.Slug,
+			&before.Name,
+			&before.CreatedAt,
+		)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("could not select: %w", err)
+		}
+	}
+
+	if before.Name == genre.Name {
+		result.Unchanged++
+		return nil
+	}
+
+	const updateQry = `
+	UPDATE genres
+	SET name = $2
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, updateQry, before.ID, genre.Name); err != nil {
+		return fmt.Errorf("could not update: %w", err)
+	}
+
+	after := before
+	after.Name = genre.Name
+
+	result.Updated++
+	return insertAuditEvent(ctx, tx, AuditActionUpdate, AuditEntityGenre, strconv.Itoa(before.ID), before.snapshot(), after.snapshot())
+}
@@ -0,0 +1,210 @@
+package datastore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+// genreSource hands out the genres like an import reads them.
+func genreSource(genres ...*datastore.Genre) func() (*datastore.Genre, error) {
+	return func() (*datastore.Genre, error) {
+		if len(genres) == 0 {
+			return nil, io.EOF
+		}
+		genre := genres[0]
+		genres = genres[1:]
+		return genre, nil
+	}
+}
+
+func TestExportGenres(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("exports all genres ordered by slug", func(t *testing.T) {
+		defer removeAllGenres(t, pool)
+
+		// more genres than fit in a batch of the cursor
+		var expected []string
+		for i := range 501 {
+			slug := fmt.Sprintf("genre-%03d", i)
+			storeGenre(t, pool, &datastore.Genre{Slug: slug})
+			expected = append(expected, slug)
+		}
+
+		var slugs []string
+		err := ds.ExportGenres(context.Background(), func(genre *datastore.Genre) error {
+			slugs = append(slugs, genre.Slug)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to export genres: %v", err)
+		}
+
+		if diff := cmp.Diff(expected, slugs); diff != "" {
+			t.Errorf("slugs mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("stops at the first error of fn", func(t *testing.T) {
+		defer removeAllGenres(t, pool)
+
+		storeGenre(t, pool, &datastore.Genre{Slug: "comedy"})
+		storeGenre(t, pool, &datastore.Genre{Slug: "drama"})
+
+		errStop := errors.New("stop")
+		calls := 0
+
+		err := ds.ExportGenres(context.Background(), func(genre *datastore.Genre) error {
+			calls++
+			return errStop
+		})
+		if !errors.Is(err, errStop) {
+			t.Fatalf("expected the error of fn, got %v", err)
+		}
+
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+}
+
+func TestImportGenres(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("upserts the genres by slug", func(t *testing.T) {
+		defer removeAllAuditEvents(t, pool)
+		defer removeAllGenres(t, pool)
+
+		dramaID := storeGenre(t, pool, &datastore.Genre{
+			Slug: "drama",
+			Name: sql.NullString{String: "Drama", Valid: true},
+		})
+		comedyID := storeGenre(t, pool, &datastore.Genre{Slug: "comedy"})
+
+		createdAt := time.Date(2025, 10, 14, 9, 45, 0, 0, time.UTC)
+
+		genres := []*datastore.Genre{
+			{Slug: "drama", Name: sql.NullString{String: "Drama", Valid: true}},
+			{Slug: "comedy", Name: sql.NullString{String: "Comedy", Valid: true}},
+			{Slug: "thriller", CreatedAt: createdAt},
+		}
+
+		result, err := ds.ImportGenres(context.Background(), genreSource(genres...))
+		if err != nil {
+			t.Fatalf("failed to import genres: %v", err)
+		}
+
+		if diff := cmp.Diff(&datastore.ImportResult{Created: 1, Updated: 1, Unchanged: 1}, result); diff != "" {
+			t.Errorf("result mismatch (-want +got):\n%s", diff)
+		}
+
+		got, err := ds.ListGenres(context.Background())
+		if err != nil {
+			t.Fatalf("failed to list genres: %v", err)
+		}
+
+		if len(got) != 3 {
+			t.Fatalf("expected 3 genres, got %d", len(got))
+		}
+
+		expectGenre(t, &datastore.Genre{
+			ID:        comedyID,
+			Slug:      "comedy",
+			Name:      sql.NullString{String: "Comedy", Valid: true},
+			CreatedAt: time.Now(),
+		}, got[0])
+
+		expectGenre(t, &datastore.Genre{
+			ID:        dramaID,
+			Slug:      "drama",
+			Name:      sql.NullString{String: "Drama", Valid: true},
+			CreatedAt: time.Now(),
+		}, got[1])
+
+		expectGenre(t, &datastore.Genre{
+			ID:        genres[2].ID,
+			Slug:      "thriller",
+			CreatedAt: createdAt,
+		}, got[2])
+
+		// importing again changes nothing
+		result, err = ds.ImportGenres(context.Background(), genreSource(genres...))
+		if err != nil {
+			t.Fatalf("failed to import genres: %v", err)
+		}
+
+		if diff := cmp.Diff(&datastore.ImportResult{Unchanged: 3}, result); diff != "" {
+			t.Errorf("result mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("imports a new slug concurrently", func(t *testing.T) {
+		defer removeAllAuditEvents(t, pool)
+		defer removeAllGenres(t, pool)
+
+		results := make([]*datastore.ImportResult, 2)
+		errs := make([]error, 2)
+
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Go(func() {
+				results[i], errs[i] = ds.ImportGenres(context.Background(), genreSource(&datastore.Genre{Slug: "drama"}))
+			})
+		}
+		wg.Wait()
+
+		if err := errors.Join(errs...); err != nil {
+			t.Fatalf("failed to import genres: %v", err)
+		}
+
+		total := datastore.ImportResult{}
+		for _, result := range results {
+			total.Created += result.Created
+			total.Updated += result.Updated
+			total.Unchanged += result.Unchanged
+		}
+
+		if diff := cmp.Diff(datastore.ImportResult{Created: 1, Unchanged: 1}, total); diff != "" {
+			t.Errorf("result mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("rolls back when next fails", func(t *testing.T) {
+		defer removeAllAuditEvents(t, pool)
+		defer removeAllGenres(t, pool)
+
+		errInvalid := errors.New("invalid")
+		source := genreSource(&datastore.Genre{Slug: "drama"})
+
+		_, err := ds.ImportGenres(context.Background(), func() (*datastore.Genre, error) {
+			genre, err := source()
+			if errors.Is(err, io.EOF) {
+				return nil, errInvalid
+			}
+			return genre, err
+		})
+		if !errors.Is(err, errInvalid) {
+			t.Fatalf("expected the error of next, got %v", err)
+		}
+
+		genres, err := ds.ListGenres(context.Background())
+		if err != nil {
+			t.Fatalf("failed to list genres: %v", err)
+		}
+
+		if len(genres) != 0 {
+			t.Errorf("expected 0 genres, got %d", len(genres))
+		}
+	})
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"database/sql"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type Genre struct {
@@ -28,7 +32,7 @@ func (ds *Store) ListGenres(ctx context.Context) ([]*Genre, error) {
 	SELECT id, slug, name, created_at
 	FROM genres ORDER BY slug ASC`
 
-	rows, err := ds.pool.Query(ctx, qry)
+	rows, err := ds.reader(ctx).Query(ctx, qry)
 	if err != nil {
 		return nil, fmt.Errorf("store: ListGenres: could not query: %w", err)
 	}
@@ -55,6 +59,119 @@ func (ds *Store) ListGenres(ctx context.Context) ([]*Genre, error) {
 	return genres, nil
 }
 
+// EachGenre calls fn for every genre ordered by slug, like ListGenres but
+// read through a cursor a batch at a time, so they are never all in memory.
+func (ds *Store) EachGenre(ctx context.Context, fn func(*Genre) error) error {
+	tx, err := ds.reader(ctx).BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("store: EachGenre: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const declareQry = `
+	DECLARE genre_each NO SCROLL CURSOR FOR
+	SELECT id, slug, name, created_at
+	FROM genres
+	ORDER BY slug ASC`
+
+	if _, err = tx.Exec(ctx, declareQry); err != nil {
+		return fmt.Errorf("store: EachGenre: could not declare cursor: %w", err)
+	}
+
+	return fetchGenres(ctx, tx, "EachGenre", "genre_each", fn)
+}
+
+// GenreFilter selects a page of genres ordered by slug.
+type GenreFilter struct {
+	// Search matches part of the slug or name, case insensitive
+	Search string
+	// AfterSlug continues the listing after the genre with this slug
+	AfterSlug string
+	Limit     int
+}
+
+func (ds *Store) ListGenresPage(ctx context.Context, filter GenreFilter) ([]*Genre, error) {
+	const qry = `
+	SELECT id, slug, name, created_at
+	FROM genres
+	WHERE ($1 = '' OR slug ILIKE '%' || $1 || '%' OR name ILIKE '%' || $1 || '%')
+	AND ($2 = '' OR slug > $2)
+	ORDER BY slug ASC
+	LIMIT $3`
+
+	genres, err := ds.queryGenres(ctx, qry, escapeLike(filter.Search), filter.AfterSlug, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("store: ListGenresPage: %w", err)
+	}
+
+	return genres, nil
+}
+
+// GetGenresByIDs returns the genres with the ids that exist, in no particular order.
+func (ds *Store) GetGenresByIDs(ctx context.Context, IDs []int) ([]*Genre, error) {
+	const qry = `
+	SELECT id, slug, name, created_at
+	FROM genres WHERE id = ANY($1)`
+
+	genres, err := ds.queryGenres(ctx, qry, IDs)
+	if err != nil {
+		return nil, fmt.Errorf("store: GetGenresByIDs: %w", err)
+	}
+
+	return genres, nil
+}
+
+// GetGenresBySlugs returns the genres with the slugs that exist, in no particular order.
+func (ds *Store) GetGenresBySlugs(ctx context.Context, slugs []string) ([]*Genre, error) {
+	const qry = `
+	SELECT id, slug, name, created_at
+	FROM genres WHERE slug = ANY($1)`
+
+	genres, err := ds.queryGenres(ctx, qry, slugs)
+	if err != nil {
+		return nil, fmt.Errorf("store: GetGenresBySlugs: %w", err)
+	}
+
+	return genres, nil
+}
+
+func (ds *Store) queryGenres(ctx context.Context, qry string, args ...any) ([]*Genre, error) {
+	rows, err := ds.reader(ctx).Query(ctx, qry, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query: %w", err)
+	}
+	defer rows.Close()
+
+	var genres []*Genre
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.Slug,
+			&genre.Name,
+			&genre.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return genres, nil
+}
+
+// escapeLike escapes the wildcards of LIKE patterns.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 func (ds *Store) GetGenre(ctx context.Context, ID int) (*Genre, error) {
 	var genre Genre
 
@@ -62,7 +179,7 @@ func (ds *Store) GetGenre(ctx context.Context, ID int) (*Genre, error) {
 	SELECT id, slug, name, created_at
 	FROM genres WHERE id=$1`
 
-	err := ds.pool.QueryRow(
+	err := ds.reader(ctx).QueryRow(
 		ctx,
 		qry,
 		ID,
@@ -88,11 +205,17 @@ func (ds *Store) InsertGenre(ctx context.Context, genre *Genre) error {
 		return errors.New("store: InsertGenre: genre is nil")
 	}
 
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: InsertGenre: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	const qry = `
 	INSERT INTO genres (slug, name)
 	VALUES ($1, $2) RETURNING id, created_at`
 
-	err := ds.pool.QueryRow(
+	err = tx.QueryRow(
 		ctx,
 		qry,
 		genre.Slug,
@@ -109,6 +232,15 @@ func (ds *Store) InsertGenre(ctx context.Context, genre *Genre) error {
 		return err
 	}
 
+	err = insertAuditEvent(ctx, tx, AuditActionCreate, AuditEntityGenre, strconv.Itoa(genre.ID), nil, genre.snapshot())
+	if err != nil {
+		return fmt.Errorf("store: InsertGenre: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: InsertGenre: could not commit: %w", err)
+	}
+
 	return nil
 }
 
@@ -117,12 +249,38 @@ func (ds *Store) UpdateGenre(ctx context.Context, genre *Genre) error {
 		return errors.New("store: UpdateGenre: genre is nil")
 	}
 
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: UpdateGenre: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const selectQry = `
+	SELECT id, slug, name, created_at
+	FROM genres WHERE id = $1
+	FOR UPDATE`
+
+	var before Genre
+
+	err = tx.QueryRow(ctx, selectQry, genre.ID).Scan(
+		&before.ID,
+		&before.Slug,
+		&before.Name,
+		&before.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrGenreNotFound
+		}
+		return err
+	}
+
 	const qry = `
 	UPDATE genres
 	SET slug = $2, name = $3
 	WHERE id = $1`
 
-	result, err := ds.pool.Exec(
+	_, err = tx.Exec(
 		ctx,
 		qry,
 		genre.ID,
@@ -137,9 +295,38 @@ func (ds *Store) UpdateGenre(ctx context.Context, genre *Genre) error {
 		return err
 	}
 
-	if result.RowsAffected() == 0 {
-		return ErrGenreNotFound
+	genre.CreatedAt = before.CreatedAt
+
+	err = insertAuditEvent(ctx, tx, AuditActionUpdate, AuditEntityGenre, strconv.Itoa(genre.ID), before.snapshot(), genre.snapshot())
+	if err != nil {
+		return fmt.Errorf("store: UpdateGenre: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: UpdateGenre: could not commit: %w", err)
 	}
 
 	return nil
 }
+
+// genreSnapshot is the representation of a genre in the audit log.
+type genreSnapshot struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      *string   `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (g *Genre) snapshot() *genreSnapshot {
+	snapshot := &genreSnapshot{
+		ID:        g.ID,
+		Slug:      g.Slug,
+		CreatedAt: g.CreatedAt,
+	}
+
+	if g.Name.Valid {
+		snapshot.Name = &g.Name.String
+	}
+
+	return snapshot
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/tommarien/movie-land/internal/datastore"
 )
@@ -302,3 +303,110 @@ func TestListGenres(t *testing.T) {
 		}
 	})
 }
+
+func TestEachGenre(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+	defer removeAllGenres(t, pool)
+
+	storeGenre(t, pool, &datastore.Genre{Slug: "drama"})
+	storeGenre(t, pool, &datastore.Genre{Slug: "comedy"})
+
+	var slugs []string
+	err := ds.EachGenre(context.Background(), func(genre *datastore.Genre) error {
+		slugs = append(slugs, genre.Slug)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate genres: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"comedy", "drama"}, slugs); diff != "" {
+		t.Errorf("slugs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestListGenresPage(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllGenres(t, pool)
+
+	for _, slug := range []string{"action", "comedy", "drama", "romantic-comedy"} {
+		storeGenre(t, pool, &datastore.Genre{Slug: slug})
+	}
+
+	slugs := func(genres []*datastore.Genre) []string {
+		var result []string
+		for _, g := range genres {
+			result = append(result, g.Slug)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		filter datastore.GenreFilter
+		want   []string
+	}{
+		{
+			name:   "returns the first page",
+			filter: datastore.GenreFilter{Limit: 2},
+			want:   []string{"action", "comedy"},
+		},
+		{
+			name:   "continues after the slug",
+			filter: datastore.GenreFilter{AfterSlug: "comedy", Limit: 2},
+			want:   []string{"drama", "romantic-comedy"},
+		},
+		{
+			name:   "matches part of the slug",
+			filter: datastore.GenreFilter{Search: "COMEDY", Limit: 10},
+			want:   []string{"comedy", "romantic-comedy"},
+		},
+		{
+			name:   "treats wildcards literally",
+			filter: datastore.GenreFilter{Search: "%", Limit: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			genres, err := ds.ListGenresPage(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("failed to list genres: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, slugs(genres)); diff != "" {
+				t.Errorf("slugs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetGenresByKeys(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllGenres(t, pool)
+
+	dramaID := storeGenre(t, pool, &datastore.Genre{Slug: "drama"})
+	comedyID := storeGenre(t, pool, &datastore.Genre{Slug: "comedy"})
+	storeGenre(t, pool, &datastore.Genre{Slug: "action"})
+
+	byIDs, err := ds.GetGenresByIDs(context.Background(), []int{dramaID, comedyID, -1})
+	if err != nil {
+		t.Fatalf("failed to get genres by ids: %v", err)
+	}
+	if len(byIDs) != 2 {
+		t.Errorf("expected 2 genres by ids, got %d", len(byIDs))
+	}
+
+	bySlugs, err := ds.GetGenresBySlugs(context.Background(), []string{"drama", "unknown"})
+	if err != nil {
+		t.Fatalf("failed to get genres by slugs: %v", err)
+	}
+	if len(bySlugs) != 1 || bySlugs[0].ID != dramaID {
+		t.Errorf("expected the drama genre by slug, got %v", bySlugs)
+	}
+}
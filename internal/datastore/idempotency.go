@@ -0,0 +1,126 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// IdempotencyRecord is the response to a request sent with an idempotency
+// key, the fingerprint tells whether a retry is the same request. A pending
+// record is a claim of a request still running, it has no response yet.
+type IdempotencyRecord struct {
+	Fingerprint []byte
+	Pending     bool
+	Status      int
+	Headers     map[string][]string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// ClaimIdempotencyKey claims the key of the scope for the request with the
+// fingerprint, by storing a pending record that expires at expiresAt. It
+// returns nil once claimed, or the record of the key when it is taken and has
+// not expired, pending or not. No lock is held after it returns, requests
+// waiting for a pending record poll it rather than tie up a connection.
+func (ds *Store) ClaimIdempotencyKey(ctx context.Context, scope, key string, fingerprint []byte, expiresAt time.Time) (*IdempotencyRecord, error) {
+	// an expired record of the key is replaced
+	const claimQry = `
+	INSERT INTO idempotency_keys (scope, key, fingerprint, expires_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (scope, key) DO UPDATE
+	SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL,
+		created_at = now(), expires_at = EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at <= now()`
+
+	const selectQry = `
+	SELECT fingerprint, status, headers, body, expires_at
+	FROM idempotency_keys
+	WHERE scope = $1 AND key = $2 AND expires_at > now()`
+
+	for {
+		tag, err := ds.pool.Exec(ctx, claimQry, scope, key, fingerprint, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("store: ClaimIdempotencyKey: could not insert: %w", err)
+		}
+		if tag.RowsAffected() == 1 {
+			return nil, nil
+		}
+
+		var (
+			existing IdempotencyRecord
+			status   *int
+		)
+
+		err = ds.pool.QueryRow(ctx, selectQry, scope, key).Scan(
+			&existing.Fingerprint,
+			&status,
+			&existing.Headers,
+			&existing.Body,
+			&existing.ExpiresAt,
+		)
+
+		// the record was released or expired in between, claim it again
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("store: ClaimIdempotencyKey: could not select: %w", err)
+		}
+
+		if status == nil {
+			existing.Pending = true
+		} else {
+			existing.Status = *status
+		}
+
+		return &existing, nil
+	}
+}
+
+// CompleteIdempotencyKey stores the response of record for the key claimed
+// with ClaimIdempotencyKey.
+func (ds *Store) CompleteIdempotencyKey(ctx context.Context, scope, key string, record *IdempotencyRecord) error {
+	const updateQry = `
+	UPDATE idempotency_keys
+	SET status = $3, headers = $4, body = $5, expires_at = $6
+	WHERE scope = $1 AND key = $2 AND status IS NULL`
+
+	_, err := ds.pool.Exec(
+		ctx,
+		updateQry,
+		scope,
+		key,
+		record.Status,
+		record.Headers,
+		record.Body,
+		record.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store: CompleteIdempotencyKey: could not update: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes the claim of the key, so a retry runs the
+// request again.
+func (ds *Store) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	_, err := ds.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status IS NULL`, scope, key)
+	if err != nil {
+		return fmt.Errorf("store: ReleaseIdempotencyKey: could not delete: %w", err)
+	}
+
+	return nil
+}
+
+func (ds *Store) DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time) error {
+	_, err := ds.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, before)
+	if err != nil {
+		return fmt.Errorf("store: DeleteIdempotencyKeysBefore: could not delete: %w", err)
+	}
+
+	return nil
+}
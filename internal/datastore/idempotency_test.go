@@ -0,0 +1,163 @@
+package datastore_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func removeAllIdempotencyKeys(t *testing.T, dbpool *pgxpool.Pool) {
+	_, err := dbpool.Exec(context.Background(), `DELETE FROM idempotency_keys`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllIdempotencyKeys(t, pool)
+
+	ctx := context.Background()
+	fingerprint := []byte{1, 2, 3}
+
+	existing, err := ds.ClaimIdempotencyKey(ctx, "user:1", "key-1", fingerprint, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	if existing != nil {
+		t.Fatalf("expected to claim the key, got %+v", existing)
+	}
+
+	existing, err = ds.ClaimIdempotencyKey(ctx, "user:1", "key-1", fingerprint, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	if existing == nil || !existing.Pending {
+		t.Fatalf("expected a pending record, got %+v", existing)
+	}
+
+	record := &datastore.IdempotencyRecord{
+		Fingerprint: fingerprint,
+		Status:      201,
+		Headers:     map[string][]string{"Content-Type": {"application/json"}},
+		Body:        []byte(`{"data":{"id":1}}`),
+		ExpiresAt:   time.Now().Add(time.Hour).Truncate(time.Microsecond),
+	}
+
+	if err = ds.CompleteIdempotencyKey(ctx, "user:1", "key-1", record); err != nil {
+		t.Fatalf("failed to complete key: %v", err)
+	}
+
+	existing, err = ds.ClaimIdempotencyKey(ctx, "user:1", "key-1", fingerprint, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	if diff := cmp.Diff(record, existing); diff != "" {
+		t.Errorf("record mismatch (-want +got):\n%s", diff)
+	}
+
+	// a completed record is not released
+	if err = ds.ReleaseIdempotencyKey(ctx, "user:1", "key-1"); err != nil {
+		t.Fatalf("failed to release key: %v", err)
+	}
+
+	// keys are scoped
+	existing, err = ds.ClaimIdempotencyKey(ctx, "user:2", "key-1", fingerprint, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("expected to claim the key of another scope, got %+v", existing)
+	}
+
+	if err = ds.ReleaseIdempotencyKey(ctx, "user:2", "key-1"); err != nil {
+		t.Fatalf("failed to release key: %v", err)
+	}
+
+	existing, err = ds.ClaimIdempotencyKey(ctx, "user:2", "key-1", fingerprint, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("expected to claim a released key, got %+v", existing)
+	}
+
+	if err = ds.DeleteIdempotencyKeysBefore(ctx, record.ExpiresAt.Add(time.Second)); err != nil {
+		t.Fatalf("failed to delete records: %v", err)
+	}
+
+	existing, err = ds.ClaimIdempotencyKey(ctx, "user:1", "key-1", fingerprint, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("expected the record to be deleted, got %+v", existing)
+	}
+}
+
+func TestClaimIdempotencyKeyExpired(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllIdempotencyKeys(t, pool)
+
+	ctx := context.Background()
+
+	if _, err := ds.ClaimIdempotencyKey(ctx, "user:1", "key-1", []byte{1}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+
+	existing, err := ds.ClaimIdempotencyKey(ctx, "user:1", "key-1", []byte{2}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("expected to claim an expired key, got %+v", existing)
+	}
+}
+
+func TestClaimIdempotencyKeyConcurrently(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllIdempotencyKeys(t, pool)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+		pending int
+	)
+
+	for range 5 {
+		wg.Go(func() {
+			existing, err := ds.ClaimIdempotencyKey(context.Background(), "user:1", "key-1", []byte{1}, time.Now().Add(time.Minute))
+			if err != nil {
+				t.Errorf("failed to claim key: %v", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if existing == nil {
+				claimed++
+			} else if existing.Pending {
+				pending++
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if claimed != 1 || pending != 4 {
+		t.Errorf("expected 1 claim and 4 pending records, got %d claims and %d pending", claimed, pending)
+	}
+}
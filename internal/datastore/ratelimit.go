@@ -0,0 +1,66 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RateLimitBucket is the token bucket of a rate limited client,
+// a bucket that was never updated has a zero UpdatedAt.
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// UpdateRateLimitBucket locks the bucket of the key while update changes it.
+func (ds *Store) UpdateRateLimitBucket(ctx context.Context, key string, update func(bucket *RateLimitBucket)) error {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: UpdateRateLimitBucket: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const selectQry = `
+	SELECT tokens, updated_at
+	FROM rate_limit_buckets
+	WHERE key = $1
+	FOR UPDATE`
+
+	bucket := RateLimitBucket{Key: key}
+
+	err = tx.QueryRow(ctx, selectQry, key).Scan(&bucket.Tokens, &bucket.UpdatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("store: UpdateRateLimitBucket: could not select: %w", err)
+	}
+
+	update(&bucket)
+
+	const upsertQry = `
+	INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (key) DO UPDATE
+	SET tokens = EXCLUDED.tokens, updated_at = EXCLUDED.updated_at`
+
+	if _, err = tx.Exec(ctx, upsertQry, key, bucket.Tokens, bucket.UpdatedAt); err != nil {
+		return fmt.Errorf("store: UpdateRateLimitBucket: could not upsert: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: UpdateRateLimitBucket: could not commit: %w", err)
+	}
+
+	return nil
+}
+
+func (ds *Store) DeleteRateLimitBucketsBefore(ctx context.Context, before time.Time) error {
+	_, err := ds.pool.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < $1`, before)
+	if err != nil {
+		return fmt.Errorf("store: DeleteRateLimitBucketsBefore: could not delete: %w", err)
+	}
+
+	return nil
+}
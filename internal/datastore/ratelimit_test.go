@@ -0,0 +1,62 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func removeAllRateLimitBuckets(t *testing.T, dbpool *pgxpool.Pool) {
+	_, err := dbpool.Exec(context.Background(), `DELETE FROM rate_limit_buckets`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateRateLimitBucket(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllRateLimitBuckets(t, pool)
+
+	now := time.Now().Truncate(time.Microsecond)
+
+	err := ds.UpdateRateLimitBucket(context.Background(), "read:ip:192.0.2.1", func(b *datastore.RateLimitBucket) {
+		if !b.UpdatedAt.IsZero() {
+			t.Errorf("expected a new bucket, got %+v", b)
+		}
+
+		b.Tokens = 4
+		b.UpdatedAt = now
+	})
+	if err != nil {
+		t.Fatalf("failed to update bucket: %v", err)
+	}
+
+	err = ds.UpdateRateLimitBucket(context.Background(), "read:ip:192.0.2.1", func(b *datastore.RateLimitBucket) {
+		if b.Tokens != 4 || !b.UpdatedAt.Equal(now) {
+			t.Errorf("expected the stored bucket, got %+v", b)
+		}
+
+		b.Tokens = 3
+	})
+	if err != nil {
+		t.Fatalf("failed to update bucket: %v", err)
+	}
+
+	if err = ds.DeleteRateLimitBucketsBefore(context.Background(), now.Add(time.Second)); err != nil {
+		t.Fatalf("failed to delete buckets: %v", err)
+	}
+
+	err = ds.UpdateRateLimitBucket(context.Background(), "read:ip:192.0.2.1", func(b *datastore.RateLimitBucket) {
+		if !b.UpdatedAt.IsZero() {
+			t.Errorf("expected the bucket to be deleted, got %+v", b)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to update bucket: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier runs the queries of the read only methods, on the primary or a
+// replica.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// ReplicaOptions configures the health checks of the read replicas.
+type ReplicaOptions struct {
+	// MaxLag is how far a replica may be behind the primary and still serve reads
+	MaxLag time.Duration
+	// CheckInterval is how often the lag of the replicas is checked
+	CheckInterval time.Duration
+	// CheckTimeout bounds a single check, the replica is unhealthy when it
+	// does not answer in time
+	CheckTimeout time.Duration
+}
+
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// NewWithReplicas returns a store reading from the replicas while they keep
+// up with the primary. The replicas count as unhealthy until
+// MonitorReplicas checked them.
+func NewWithReplicas(pool *pgxpool.Pool, replicas []*pgxpool.Pool, opts ReplicaOptions) *Store {
+	ds := New(pool)
+	ds.replicaOpts = opts
+
+	for _, p := range replicas {
+		if p == nil {
+			panic("store: replica pool is nil")
+		}
+		ds.replicas = append(ds.replicas, &replica{pool: p})
+	}
+
+	return ds
+}
+
+type primaryContextKey struct{}
+
+// WithPrimary makes the reads with the context go to the primary, for
+// requests that have to see their own writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// ReadsPrimary tells whether WithPrimary was called on the context.
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
+
+// reader returns a healthy replica in turn, or the primary when there is
+// none or the context asks for it.
+func (ds *Store) reader(ctx context.Context) querier {
+	if len(ds.replicas) == 0 || ReadsPrimary(ctx) {
+		return ds.pool
+	}
+
+	start := ds.nextReplica.Add(1)
+	for i := range uint64(len(ds.replicas)) {
+		r := ds.replicas[(start+i)%uint64(len(ds.replicas))]
+		if r.healthy.Load() {
+			return r.pool
+		}
+	}
+
+	return ds.pool
+}
+
+// MonitorReplicas checks the replication lag of the replicas right away and
+// every CheckInterval until the context is done. Replicas lagging more than
+// MaxLag, or failing the check, stop serving reads until they caught up.
+func (ds *Store) MonitorReplicas(ctx context.Context) {
+	if len(ds.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(ds.replicaOpts.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for i, r := range ds.replicas {
+			ds.checkReplica(ctx, i, r)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ds *Store) checkReplica(ctx context.Context, i int, r *replica) {
+	ctx, cancel := context.WithTimeout(ctx, ds.replicaOpts.CheckTimeout)
+	defer cancel()
+
+	lag, err := replicationLag(ctx, r.pool)
+
+	healthy := err == nil && lag <= ds.replicaOpts.MaxLag
+	if healthy == r.healthy.Swap(healthy) {
+		return
+	}
+
+	switch {
+	case healthy:
+		slog.Info("replica serves reads", "replica", i, "lag", lag)
+	case err != nil:
+		slog.Warn("replica stopped serving reads, check failed", "replica", i, "err", err)
+	default:
+		slog.Warn("replica stopped serving reads, lagging behind", "replica", i, "lag", lag, "max_lag", ds.replicaOpts.MaxLag)
+	}
+}
+
+// errReplicaNotStreaming fails the check of a replica that lost its primary,
+// it replayed all it received but receives nothing anymore.
+var errReplicaNotStreaming = errors.New("store: replicationLag: no WAL receiver is streaming from the primary")
+
+// replicationLag returns how far the replica is behind, nothing when it
+// replayed all it received as an idle primary writes no new transactions.
+// A WAL receiver whose status is hidden, from roles without
+// pg_read_all_stats, counts as streaming.
+func replicationLag(ctx context.Context, pool *pgxpool.Pool) (time.Duration, error) {
+	const qry = `
+	SELECT
+		pg_is_in_recovery(),
+		EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming'),
+		CASE
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END::float8`
+
+	var state replicaState
+	if err := pool.QueryRow(ctx, qry).Scan(&state.inRecovery, &state.streaming, &state.lagSeconds); err != nil {
+		return 0, fmt.Errorf("store: replicationLag: %w", err)
+	}
+
+	return state.lag()
+}
+
+// replicaState is what the check of a replica reads.
+type replicaState struct {
+	inRecovery bool
+	streaming  bool
+	lagSeconds float64
+}
+
+// lag is nothing for a server that is not a replica, like a promoted one.
+func (s replicaState) lag() (time.Duration, error) {
+	switch {
+	case !s.inRecovery:
+		return 0, nil
+	case !s.streaming:
+		return 0, errReplicaNotStreaming
+	}
+
+	return time.Duration(s.lagSeconds * float64(time.Second)), nil
+}
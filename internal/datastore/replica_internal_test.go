@@ -0,0 +1,47 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// the test database is never in recovery, so the states of a replica are
+// checked without one
+func TestReplicaStateLag(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       replicaState
+		expected    time.Duration
+		expectedErr error
+	}{
+		{
+			name:     "returns no lag for a server that is not a replica",
+			state:    replicaState{lagSeconds: 30},
+			expected: 0,
+		},
+		{
+			name:     "returns the lag of a streaming replica",
+			state:    replicaState{inRecovery: true, streaming: true, lagSeconds: 1.5},
+			expected: 1500 * time.Millisecond,
+		},
+		{
+			name:        "fails for a replica without a streaming WAL receiver",
+			state:       replicaState{inRecovery: true},
+			expectedErr: errReplicaNotStreaming,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lag, err := tt.state.lag()
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+
+			if lag != tt.expected {
+				t.Errorf("expected lag %s, got %s", tt.expected, lag)
+			}
+		})
+	}
+}
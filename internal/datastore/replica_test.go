@@ -0,0 +1,85 @@
+package datastore_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	dbpool := connect(t)
+
+	// the test database stands in for a replica, it is never in recovery so it never lags
+	replica, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_TEST_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { replica.Close() })
+
+	ds := datastore.NewWithReplicas(dbpool, []*pgxpool.Pool{replica}, datastore.ReplicaOptions{
+		MaxLag:        time.Second,
+		CheckInterval: time.Hour,
+		CheckTimeout:  time.Second,
+	})
+
+	acquired := func() int64 { return replica.Stat().AcquireCount() }
+
+	t.Run("reads from the primary until the replica is checked", func(t *testing.T) {
+		before := acquired()
+
+		if _, err := ds.ListGenres(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := acquired() - before; got != 0 {
+			t.Errorf("expected no reads from the replica, got %d", got)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ds.MonitorReplicas(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// wait for the first check to mark the replica healthy
+	deadline := time.Now().Add(5 * time.Second)
+	for acquired() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	t.Run("reads from the healthy replica", func(t *testing.T) {
+		before := acquired()
+
+		if _, err := ds.ListGenres(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := acquired() - before; got != 1 {
+			t.Errorf("expected 1 read from the replica, got %d", got)
+		}
+	})
+
+	t.Run("reads from the primary when asked to", func(t *testing.T) {
+		before := acquired()
+
+		if _, err := ds.GetGenre(datastore.WithPrimary(context.Background()), 1); err != nil && !errors.Is(err, datastore.ErrGenreNotFound) {
+			t.Fatal(err)
+		}
+
+		if got := acquired() - before; got != 0 {
+			t.Errorf("expected no reads from the replica, got %d", got)
+		}
+	})
+}
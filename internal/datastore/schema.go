@@ -0,0 +1,71 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrSchemaNotMigrated = errors.New("store: schema is not migrated")
+
+func (ds *Store) Ping(ctx context.Context) error {
+	return ds.pool.Ping(ctx)
+}
+
+// SchemaVersion returns the version of the latest migration goose applied,
+// walking its history like goose does so rolled back versions are skipped.
+func (ds *Store) SchemaVersion(ctx context.Context) (int64, error) {
+	const qry = `
+	SELECT version_id, is_applied
+	FROM goose_db_version
+	ORDER BY id DESC`
+
+	rows, err := ds.pool.Query(ctx, qry)
+	if isUndefinedTable(err) {
+		return 0, ErrSchemaNotMigrated
+	}
+	if err != nil {
+		return 0, fmt.Errorf("store: SchemaVersion: could not query: %w", err)
+	}
+	defer rows.Close()
+
+	rolledBack := make(map[int64]bool)
+
+	for rows.Next() {
+		var (
+			version int64
+			applied bool
+		)
+		if err := rows.Scan(&version, &applied); err != nil {
+			return 0, fmt.Errorf("store: SchemaVersion: could not scan row: %w", err)
+		}
+
+		if rolledBack[version] {
+			continue
+		}
+
+		if applied {
+			return version, nil
+		}
+
+		rolledBack[version] = true
+	}
+
+	if err = rows.Err(); isUndefinedTable(err) {
+		return 0, ErrSchemaNotMigrated
+	}
+	if err != nil {
+		return 0, fmt.Errorf("store: SchemaVersion: rows error: %w", err)
+	}
+
+	return 0, ErrSchemaNotMigrated
+}
+
+// isUndefinedTable tells whether the query failed as goose did not create
+// its version table yet.
+func isUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == undefinedTableCode
+}
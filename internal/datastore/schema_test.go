@@ -0,0 +1,32 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+	"github.com/tommarien/movie-land/migrations"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	if err := ds.Ping(context.Background()); err != nil {
+		t.Fatalf("failed to ping: %v", err)
+	}
+
+	want, err := migrations.LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ds.SchemaVersion(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get schema version: %v", err)
+	}
+
+	if got != want {
+		t.Errorf("expected the test database at version %d, got %d", want, got)
+	}
+}
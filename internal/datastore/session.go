@@ -0,0 +1,98 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Session struct {
+	TokenHash []byte
+	UserID    int
+	User      *User
+	// MFAPending is set while the user still has to pass the second factor
+	MFAPending    bool
+	MFAVerifiedAt sql.NullTime
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+var ErrSessionNotFound = errors.New("store: session not found")
+
+func (ds *Store) InsertSession(ctx context.Context, session *Session) error {
+	if session == nil {
+		return errors.New("store: InsertSession: session is nil")
+	}
+
+	const qry = `
+	INSERT INTO sessions (token_hash, user_id, mfa_pending, expires_at)
+	VALUES ($1, $2, $3, $4) RETURNING created_at`
+
+	return ds.pool.QueryRow(
+		ctx,
+		qry,
+		session.TokenHash,
+		session.UserID,
+		session.MFAPending,
+		session.ExpiresAt,
+	).Scan(
+		&session.CreatedAt,
+	)
+}
+
+// GetSession returns the session with the given token hash along with its
+// user, as long as the session has not expired yet.
+func (ds *Store) GetSession(ctx context.Context, tokenHash []byte) (*Session, error) {
+	session := Session{TokenHash: tokenHash}
+
+	const qry = userSelect + `,
+		s.mfa_pending, s.mfa_verified_at, s.created_at, s.expires_at
+	FROM sessions s
+	JOIN users u ON u.id = s.user_id
+	LEFT JOIN user_roles r ON r.user_id = u.id
+	WHERE s.token_hash = $1 AND s.expires_at > now()
+	GROUP BY u.id, s.token_hash`
+
+	user, err := scanUser(
+		ds.pool.QueryRow(ctx, qry, tokenHash),
+		&session.MFAPending,
+		&session.MFAVerifiedAt,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	session.UserID = user.ID
+	session.User = user
+
+	return &session, nil
+}
+
+// MarkSessionMFAVerified records the user just passed the second factor.
+func (ds *Store) MarkSessionMFAVerified(ctx context.Context, tokenHash []byte) error {
+	const qry = `
+	UPDATE sessions SET mfa_pending = FALSE, mfa_verified_at = now()
+	WHERE token_hash = $1 AND expires_at > now()`
+
+	result, err := ds.pool.Exec(ctx, qry, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (ds *Store) DeleteSession(ctx context.Context, tokenHash []byte) error {
+	_, err := ds.pool.Exec(ctx, `DELETE FROM sessions WHERE token_hash = $1`, tokenHash)
+	return err
+}
@@ -2,15 +2,27 @@ package datastore
 
 import (
 	"errors"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const uniqueConstraintViolationCode = "23505"
+const (
+	uniqueConstraintViolationCode = "23505"
+	undefinedTableCode            = "42P01"
+)
 
+// Store persists the data in Postgres. The read only methods of the catalog,
+// like ListGenres, read from a healthy replica when there are any.
 type Store struct {
+	// pool is the primary, every write and the reads that are not routed
+	// through reader go to it
 	pool *pgxpool.Pool
+
+	replicas    []*replica
+	replicaOpts ReplicaOptions
+	nextReplica atomic.Uint64
 }
 
 func New(pool *pgxpool.Pool) *Store {
@@ -28,3 +40,8 @@ func getConstraintViolationName(err error) string {
 	}
 	return ""
 }
+
+// Stat returns the statistics of the connection pool.
+func (ds *Store) Stat() *pgxpool.Stat {
+	return ds.pool.Stat()
+}
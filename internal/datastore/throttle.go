@@ -0,0 +1,221 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+	ThrottleScopeMFA     = "mfa"
+)
+
+const (
+	AuthEventLoginFailed     = "login_failed"
+	AuthEventMFAFailed       = "mfa_failed"
+	AuthEventThrottled       = "throttled"
+	AuthEventAccountLocked   = "account_locked"
+	AuthEventIPLocked        = "ip_locked"
+	AuthEventMFALocked       = "mfa_locked"
+	AuthEventAccountUnlocked = "account_unlocked"
+)
+
+// AuthThrottle counts the failed authentication attempts of an account or IP address.
+type AuthThrottle struct {
+	Scope        string
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  sql.NullTime
+}
+
+type AuthEvent struct {
+	ID        int
+	Event     string
+	Email     sql.NullString
+	IPAddress sql.NullString
+	UserID    sql.NullInt64
+	ActorID   sql.NullInt64
+	CreatedAt time.Time
+}
+
+var ErrAuthThrottleNotFound = errors.New("store: auth throttle not found")
+
+func (ds *Store) GetAuthThrottle(ctx context.Context, scope, key string) (*AuthThrottle, error) {
+	const qry = `
+	SELECT scope, key, failures, last_failed_at, locked_until
+	FROM auth_throttles
+	WHERE scope = $1 AND key = $2`
+
+	var throttle AuthThrottle
+
+	err := ds.pool.QueryRow(ctx, qry, scope, key).Scan(
+		&throttle.Scope,
+		&throttle.Key,
+		&throttle.Failures,
+		&throttle.LastFailedAt,
+		&throttle.LockedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAuthThrottleNotFound
+		}
+		return nil, err
+	}
+
+	return &throttle, nil
+}
+
+// RecordAuthAttempt counts an attempt as failed at the given time, before it
+// is checked, failures before resetBefore are forgotten and so is a lockout
+// that has ended. It returns the throttle as it was before, nil when there was
+// none, and after the attempt. The row is locked while it is read and
+// updated, so concurrent attempts see each other.
+func (ds *Store) RecordAuthAttempt(ctx context.Context, scope, key string, at, resetBefore time.Time) (before, after *AuthThrottle, err error) {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("store: RecordAuthAttempt: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const selectQry = `
+	SELECT scope, key, failures, last_failed_at, locked_until
+	FROM auth_throttles
+	WHERE scope = $1 AND key = $2
+	FOR UPDATE`
+
+	before = &AuthThrottle{}
+
+	err = tx.QueryRow(ctx, selectQry, scope, key).Scan(
+		&before.Scope,
+		&before.Key,
+		&before.Failures,
+		&before.LastFailedAt,
+		&before.LockedUntil,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		before = nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("store: RecordAuthAttempt: could not select: %w", err)
+	}
+
+	const upsertQry = `
+	INSERT INTO auth_throttles (scope, key, failures, last_failed_at)
+	VALUES ($1, $2, 1, $3)
+	ON CONFLICT (scope, key) DO UPDATE
+	SET failures = CASE
+			WHEN auth_throttles.last_failed_at < $4 THEN 1
+			ELSE auth_throttles.failures + 1
+		END,
+		last_failed_at = EXCLUDED.last_failed_at,
+		locked_until = CASE
+			WHEN auth_throttles.locked_until <= EXCLUDED.last_failed_at THEN NULL
+			ELSE auth_throttles.locked_until
+		END
+	RETURNING scope, key, failures, last_failed_at, locked_until`
+
+	after = &AuthThrottle{}
+
+	err = tx.QueryRow(ctx, upsertQry, scope, key, at, resetBefore).Scan(
+		&after.Scope,
+		&after.Key,
+		&after.Failures,
+		&after.LastFailedAt,
+		&after.LockedUntil,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("store: RecordAuthAttempt: could not upsert: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("store: RecordAuthAttempt: could not commit: %w", err)
+	}
+
+	// a concurrent attempt inserted the row after it was found missing, it
+	// failed just now
+	if before == nil && after.Failures > 1 {
+		before = &AuthThrottle{
+			Scope:        scope,
+			Key:          key,
+			Failures:     after.Failures - 1,
+			LastFailedAt: at,
+			LockedUntil:  after.LockedUntil,
+		}
+	}
+
+	return before, after, nil
+}
+
+// ForgiveAuthFailure uncounts an attempt recorded by RecordAuthAttempt that
+// succeeded.
+func (ds *Store) ForgiveAuthFailure(ctx context.Context, scope, key string) error {
+	const qry = `
+	UPDATE auth_throttles SET failures = failures - 1
+	WHERE scope = $1 AND key = $2 AND failures > 0`
+
+	if _, err := ds.pool.Exec(ctx, qry, scope, key); err != nil {
+		return fmt.Errorf("store: ForgiveAuthFailure: could not update: %w", err)
+	}
+
+	return nil
+}
+
+func (ds *Store) LockAuthThrottle(ctx context.Context, scope, key string, until time.Time) error {
+	const qry = `
+	UPDATE auth_throttles SET locked_until = $3
+	WHERE scope = $1 AND key = $2`
+
+	result, err := ds.pool.Exec(ctx, qry, scope, key, until)
+	if err != nil {
+		return fmt.Errorf("store: LockAuthThrottle: could not update: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrAuthThrottleNotFound
+	}
+
+	return nil
+}
+
+// ClearAuthThrottle forgets the failed attempts and lifts a lockout.
+func (ds *Store) ClearAuthThrottle(ctx context.Context, scope, key string) error {
+	_, err := ds.pool.Exec(ctx, `DELETE FROM auth_throttles WHERE scope = $1 AND key = $2`, scope, key)
+	if err != nil {
+		return fmt.Errorf("store: ClearAuthThrottle: could not delete: %w", err)
+	}
+
+	return nil
+}
+
+func (ds *Store) InsertAuthEvent(ctx context.Context, event *AuthEvent) error {
+	if event == nil {
+		return errors.New("store: InsertAuthEvent: event is nil")
+	}
+
+	const qry = `
+	INSERT INTO auth_events (event, email, ip_address, user_id, actor_id)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	err := ds.pool.QueryRow(
+		ctx,
+		qry,
+		event.Event,
+		event.Email,
+		event.IPAddress,
+		event.UserID,
+		event.ActorID,
+	).Scan(
+		&event.ID,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store: InsertAuthEvent: could not insert: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package datastore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func removeAllAuthThrottles(t *testing.T, dbpool *pgxpool.Pool) {
+	_, err := dbpool.Exec(context.Background(), `DELETE FROM auth_throttles`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordAuthAttempt(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	now := time.Now().Truncate(time.Microsecond)
+
+	t.Run("counts the failures of the key", func(t *testing.T) {
+		defer removeAllAuthThrottles(t, pool)
+
+		for i := range 3 {
+			_, throttle, err := ds.RecordAuthAttempt(context.Background(), datastore.ThrottleScopeAccount, "jane@example.com", now, now.Add(-time.Hour))
+			if err != nil {
+				t.Fatalf("failed to record attempt: %v", err)
+			}
+
+			if throttle.Failures != i+1 {
+				t.Errorf("expected %d failures, got %d", i+1, throttle.Failures)
+			}
+		}
+
+		throttle, err := ds.GetAuthThrottle(context.Background(), datastore.ThrottleScopeIP, "jane@example.com")
+		if !errors.Is(err, datastore.ErrAuthThrottleNotFound) {
+			t.Fatalf("expected scopes to be counted apart, got %v %v", throttle, err)
+		}
+	})
+
+	t.Run("restarts counting after the reset period", func(t *testing.T) {
+		defer removeAllAuthThrottles(t, pool)
+
+		earlier := now.Add(-2 * time.Hour)
+		if _, _, err := ds.RecordAuthAttempt(context.Background(), datastore.ThrottleScopeIP, "192.0.2.1", earlier, earlier.Add(-time.Hour)); err != nil {
+			t.Fatalf("failed to record attempt: %v", err)
+		}
+
+		_, throttle, err := ds.RecordAuthAttempt(context.Background(), datastore.ThrottleScopeIP, "192.0.2.1", now, now.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("failed to record attempt: %v", err)
+		}
+
+		if throttle.Failures != 1 {
+			t.Errorf("expected 1 failure, got %d", throttle.Failures)
+		}
+	})
+
+	t.Run("keeps an active lockout until it is cleared", func(t *testing.T) {
+		defer removeAllAuthThrottles(t, pool)
+
+		if _, _, err := ds.RecordAuthAttempt(context.Background(), datastore.ThrottleScopeAccount, "jane@example.com", now, now.Add(-time.Hour)); err != nil {
+			t.Fatalf("failed to record attempt: %v", err)
+		}
+
+		until := now.Add(15 * time.Minute)
+		if err := ds.LockAuthThrottle(context.Background(), datastore.ThrottleScopeAccount, "jane@example.com", until); err != nil {
+			t.Fatalf("failed to lock: %v", err)
+		}
+
+		_, throttle, err := ds.RecordAuthAttempt(context.Background(), datastore.ThrottleScopeAccount, "jane@example.com", now, now.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("failed to record attempt: %v", err)
+		}
+
+		if !throttle.LockedUntil.Valid || !throttle.LockedUntil.Time.Equal(until) {
+			t.Errorf("expected to stay locked until %v, got %v", until, throttle.LockedUntil)
+		}
+
+		if err = ds.ClearAuthThrottle(context.Background(), datastore.ThrottleScopeAccount, "jane@example.com"); err != nil {
+			t.Fatalf("failed to clear: %v", err)
+		}
+
+		_, err = ds.GetAuthThrottle(context.Background(), datastore.ThrottleScopeAccount, "jane@example.com")
+		if !errors.Is(err, datastore.ErrAuthThrottleNotFound) {
+			t.Fatalf("expected ErrAuthThrottleNotFound, got %v", err)
+		}
+	})
+}
+
+func TestRecordAuthAttemptConcurrently(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+	defer removeAllAuthThrottles(t, pool)
+
+	now := time.Now().Truncate(time.Microsecond)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		before []int
+	)
+
+	for range 5 {
+		wg.Go(func() {
+			throttle, _, err := ds.RecordAuthAttempt(context.Background(), datastore.ThrottleScopeIP, "192.0.2.1", now, now.Add(-time.Hour))
+			if err != nil {
+				t.Errorf("failed to record attempt: %v", err)
+				return
+			}
+
+			failures := 0
+			if throttle != nil {
+				failures = throttle.Failures
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			before = append(before, failures)
+		})
+	}
+
+	wg.Wait()
+
+	// every attempt sees the ones before it
+	slices.Sort(before)
+	if diff := cmp.Diff([]int{0, 1, 2, 3, 4}, before); diff != "" {
+		t.Errorf("failures before mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestForgiveAuthFailure(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+	defer removeAllAuthThrottles(t, pool)
+
+	now := time.Now().Truncate(time.Microsecond)
+
+	for range 2 {
+		if _, _, err := ds.RecordAuthAttempt(context.Background(), datastore.ThrottleScopeIP, "192.0.2.1", now, now.Add(-time.Hour)); err != nil {
+			t.Fatalf("failed to record attempt: %v", err)
+		}
+	}
+
+	if err := ds.ForgiveAuthFailure(context.Background(), datastore.ThrottleScopeIP, "192.0.2.1"); err != nil {
+		t.Fatalf("failed to forgive failure: %v", err)
+	}
+
+	throttle, err := ds.GetAuthThrottle(context.Background(), datastore.ThrottleScopeIP, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if throttle.Failures != 1 {
+		t.Errorf("expected 1 failure, got %d", throttle.Failures)
+	}
+}
+
+func TestInsertAuthEvent(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	defer removeAllUsers(t, pool)
+
+	user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+	event := &datastore.AuthEvent{
+		Event:     datastore.AuthEventLoginFailed,
+		Email:     sql.NullString{String: "jane@example.com", Valid: true},
+		IPAddress: sql.NullString{String: "192.0.2.1", Valid: true},
+		UserID:    sql.NullInt64{Int64: int64(user.ID), Valid: true},
+	}
+
+	if err := ds.InsertAuthEvent(context.Background(), event); err != nil {
+		t.Fatalf("failed to insert event: %v", err)
+	}
+
+	if event.ID == 0 {
+		t.Error("expected event.ID to be set")
+	}
+}
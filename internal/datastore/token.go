@@ -0,0 +1,200 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+// UserToken is a single-use token mailed to a user, only its hash is stored.
+type UserToken struct {
+	TokenHash []byte
+	UserID    int
+	Purpose   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+var (
+	ErrUserTokenNotFound     = errors.New("store: token not found, expired or already used")
+	ErrUserTokenLimitReached = errors.New("store: too many tokens issued to the user recently")
+)
+
+func (ds *Store) InsertUserToken(ctx context.Context, token *UserToken) error {
+	if token == nil {
+		return errors.New("store: InsertUserToken: token is nil")
+	}
+
+	const qry = `
+	INSERT INTO user_tokens (token_hash, user_id, purpose, expires_at)
+	VALUES ($1, $2, $3, $4) RETURNING created_at`
+
+	return ds.pool.QueryRow(
+		ctx,
+		qry,
+		token.TokenHash,
+		token.UserID,
+		token.Purpose,
+		token.ExpiresAt,
+	).Scan(
+		&token.CreatedAt,
+	)
+}
+
+// IssueUserToken stores the token unless the user was issued limit tokens
+// or more for its purpose since the given time, used or not, in which case it
+// returns ErrUserTokenLimitReached. The user row is locked while counting, so
+// concurrent requests cannot all pass the limit.
+func (ds *Store) IssueUserToken(ctx context.Context, token *UserToken, limit int, since time.Time) error {
+	if token == nil {
+		return errors.New("store: IssueUserToken: token is nil")
+	}
+
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: IssueUserToken: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, token.UserID)
+	if err != nil {
+		return fmt.Errorf("store: IssueUserToken: could not lock user: %w", err)
+	}
+
+	const countQry = `
+	SELECT count(*) FROM user_tokens
+	WHERE user_id = $1 AND purpose = $2 AND created_at >= $3`
+
+	var count int
+	if err = tx.QueryRow(ctx, countQry, token.UserID, token.Purpose, since).Scan(&count); err != nil {
+		return fmt.Errorf("store: IssueUserToken: could not count: %w", err)
+	}
+
+	if count >= limit {
+		return ErrUserTokenLimitReached
+	}
+
+	const insertQry = `
+	INSERT INTO user_tokens (token_hash, user_id, purpose, expires_at)
+	VALUES ($1, $2, $3, $4) RETURNING created_at`
+
+	err = tx.QueryRow(
+		ctx,
+		insertQry,
+		token.TokenHash,
+		token.UserID,
+		token.Purpose,
+		token.ExpiresAt,
+	).Scan(
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store: IssueUserToken: could not insert: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: IssueUserToken: could not commit: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailVerification consumes the email verification token and marks
+// the email address of its user as verified.
+func (ds *Store) ConfirmEmailVerification(ctx context.Context, tokenHash []byte) error {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: ConfirmEmailVerification: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	userID, err := consumeUserToken(ctx, tx, tokenHash, TokenPurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	const qry = `
+	UPDATE users SET email_verified_at = COALESCE(email_verified_at, now())
+	WHERE id = $1`
+
+	if _, err = tx.Exec(ctx, qry, userID); err != nil {
+		return fmt.Errorf("store: ConfirmEmailVerification: could not update user: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: ConfirmEmailVerification: could not commit: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword consumes the password reset token and replaces the password of
+// its user. As the user proved access to the mailbox, the email address is
+// verified as well. All other reset tokens and sessions of the user are revoked.
+func (ds *Store) ResetPassword(ctx context.Context, tokenHash []byte, passwordHash []byte) (int, error) {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("store: ResetPassword: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	userID, err := consumeUserToken(ctx, tx, tokenHash, TokenPurposePasswordReset)
+	if err != nil {
+		return 0, err
+	}
+
+	const qry = `
+	UPDATE users
+	SET password_hash = $2, email_verified_at = COALESCE(email_verified_at, now())
+	WHERE id = $1`
+
+	if _, err = tx.Exec(ctx, qry, userID, passwordHash); err != nil {
+		return 0, fmt.Errorf("store: ResetPassword: could not update user: %w", err)
+	}
+
+	const revokeTokensQry = `
+	UPDATE user_tokens SET used_at = now()
+	WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+
+	if _, err = tx.Exec(ctx, revokeTokensQry, userID, TokenPurposePasswordReset); err != nil {
+		return 0, fmt.Errorf("store: ResetPassword: could not revoke tokens: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+		return 0, fmt.Errorf("store: ResetPassword: could not revoke sessions: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("store: ResetPassword: could not commit: %w", err)
+	}
+
+	return userID, nil
+}
+
+func consumeUserToken(ctx context.Context, tx pgx.Tx, tokenHash []byte, purpose string) (int, error) {
+	var userID int
+
+	const qry = `
+	UPDATE user_tokens SET used_at = now()
+	WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+	RETURNING user_id`
+
+	err := tx.QueryRow(ctx, qry, tokenHash, purpose).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUserTokenNotFound
+		}
+		return 0, fmt.Errorf("store: could not consume token: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,200 @@
+package datastore_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func storeUserToken(t *testing.T, ds *datastore.Store, userID int, hash, purpose string, expiresAt time.Time) {
+	t.Helper()
+
+	err := ds.InsertUserToken(context.Background(), &datastore.UserToken{
+		TokenHash: []byte(hash),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("failed to insert token: %v", err)
+	}
+}
+
+func TestIssueUserToken(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	issue := func(userID int, hash, purpose string) error {
+		return ds.IssueUserToken(context.Background(), &datastore.UserToken{
+			TokenHash: []byte(hash),
+			UserID:    userID,
+			Purpose:   purpose,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, 2, time.Now().Add(-time.Minute))
+	}
+
+	t.Run("limits the tokens of the user per purpose", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		storeUserToken(t, ds, user.ID, "reset-1", datastore.TokenPurposePasswordReset, time.Now().Add(time.Hour))
+
+		if err := issue(user.ID, "reset-2", datastore.TokenPurposePasswordReset); err != nil {
+			t.Fatalf("failed to issue token: %v", err)
+		}
+
+		if err := issue(user.ID, "reset-3", datastore.TokenPurposePasswordReset); !errors.Is(err, datastore.ErrUserTokenLimitReached) {
+			t.Errorf("expected ErrUserTokenLimitReached, got %v", err)
+		}
+
+		if err := issue(user.ID, "verify-1", datastore.TokenPurposeEmailVerification); err != nil {
+			t.Errorf("expected the limit to hold per purpose, got %v", err)
+		}
+	})
+
+	t.Run("holds the limit for concurrent requests", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		var (
+			wg     sync.WaitGroup
+			issued atomic.Int32
+		)
+
+		for i := range 5 {
+			wg.Go(func() {
+				err := issue(user.ID, "reset-"+strconv.Itoa(i), datastore.TokenPurposePasswordReset)
+				switch {
+				case err == nil:
+					issued.Add(1)
+				case !errors.Is(err, datastore.ErrUserTokenLimitReached):
+					t.Errorf("failed to issue token: %v", err)
+				}
+			})
+		}
+
+		wg.Wait()
+
+		if got := issued.Load(); got != 2 {
+			t.Errorf("expected 2 tokens to be issued, got %d", got)
+		}
+	})
+}
+
+func TestConfirmEmailVerification(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("verifies the email address once", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+		storeUserToken(t, ds, user.ID, "verify", datastore.TokenPurposeEmailVerification, time.Now().Add(time.Hour))
+
+		if err := ds.ConfirmEmailVerification(context.Background(), []byte("verify")); err != nil {
+			t.Fatalf("failed to confirm: %v", err)
+		}
+
+		got, err := ds.GetUser(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if !got.EmailVerifiedAt.Valid {
+			t.Error("expected email to be verified")
+		}
+
+		err = ds.ConfirmEmailVerification(context.Background(), []byte("verify"))
+		if !errors.Is(err, datastore.ErrUserTokenNotFound) {
+			t.Fatalf("expected ErrUserTokenNotFound on reuse, got %v", err)
+		}
+	})
+
+	t.Run("returns ErrUserTokenNotFound for an expired token", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+		storeUserToken(t, ds, user.ID, "verify", datastore.TokenPurposeEmailVerification, time.Now().Add(-time.Minute))
+
+		err := ds.ConfirmEmailVerification(context.Background(), []byte("verify"))
+		if !errors.Is(err, datastore.ErrUserTokenNotFound) {
+			t.Fatalf("expected ErrUserTokenNotFound, got %v", err)
+		}
+	})
+
+	t.Run("returns ErrUserTokenNotFound for a token of another purpose", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+		storeUserToken(t, ds, user.ID, "reset", datastore.TokenPurposePasswordReset, time.Now().Add(time.Hour))
+
+		err := ds.ConfirmEmailVerification(context.Background(), []byte("reset"))
+		if !errors.Is(err, datastore.ErrUserTokenNotFound) {
+			t.Fatalf("expected ErrUserTokenNotFound, got %v", err)
+		}
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("sets the password and revokes other tokens and sessions", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+		expiresAt := time.Now().Add(time.Hour)
+
+		storeUserToken(t, ds, user.ID, "reset-1", datastore.TokenPurposePasswordReset, expiresAt)
+		storeUserToken(t, ds, user.ID, "reset-2", datastore.TokenPurposePasswordReset, expiresAt)
+
+		err := ds.InsertSession(context.Background(), &datastore.Session{
+			TokenHash: []byte("session"),
+			UserID:    user.ID,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatalf("failed to insert session: %v", err)
+		}
+
+		userID, err := ds.ResetPassword(context.Background(), []byte("reset-1"), []byte("hash"))
+		if err != nil {
+			t.Fatalf("failed to reset password: %v", err)
+		}
+
+		if userID != user.ID {
+			t.Errorf("expected user %d, got %d", user.ID, userID)
+		}
+
+		got, err := ds.GetUser(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if string(got.PasswordHash) != "hash" {
+			t.Errorf("expected password hash to be set, got %q", got.PasswordHash)
+		}
+
+		if !got.EmailVerifiedAt.Valid {
+			t.Error("expected email to be verified")
+		}
+
+		_, err = ds.ResetPassword(context.Background(), []byte("reset-2"), []byte("other"))
+		if !errors.Is(err, datastore.ErrUserTokenNotFound) {
+			t.Fatalf("expected other reset tokens to be revoked, got %v", err)
+		}
+
+		_, err = ds.GetSession(context.Background(), []byte("session"))
+		if !errors.Is(err, datastore.ErrSessionNotFound) {
+			t.Fatalf("expected sessions to be revoked, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTOTPAlreadyEnabled    = errors.New("store: two-factor authentication is already enabled")
+	ErrTOTPCodeReused        = errors.New("store: totp code was already used")
+	ErrRecoveryCodeNotFound  = errors.New("store: recovery code not found or already used")
+	ErrTOTPEnrolmentNotFound = errors.New("store: no pending two-factor enrolment")
+)
+
+// SetUserTOTPSecret stores the encrypted secret of a pending enrolment,
+// replacing the one of an earlier unfinished enrolment.
+func (ds *Store) SetUserTOTPSecret(ctx context.Context, userID int, secret []byte) error {
+	const qry = `
+	UPDATE users SET totp_secret = $2, totp_last_step = NULL
+	WHERE id = $1 AND totp_enabled_at IS NULL`
+
+	result, err := ds.pool.Exec(ctx, qry, userID, secret)
+	if err != nil {
+		return fmt.Errorf("store: SetUserTOTPSecret: could not update: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+// EnableUserTOTP finishes the pending enrolment and replaces the recovery
+// codes of the user with the given hashes.
+func (ds *Store) EnableUserTOTP(ctx context.Context, userID int, recoveryCodeHashes [][]byte) error {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: EnableUserTOTP: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const qry = `
+	UPDATE users SET totp_enabled_at = now()
+	WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`
+
+	result, err := tx.Exec(ctx, qry, userID)
+	if err != nil {
+		return fmt.Errorf("store: EnableUserTOTP: could not update: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTOTPEnrolmentNotFound
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("store: EnableUserTOTP: could not delete recovery codes: %w", err)
+	}
+
+	const insertQry = `
+	INSERT INTO user_recovery_codes (user_id, code_hash)
+	SELECT $1, unnest($2::bytea[])`
+
+	if _, err = tx.Exec(ctx, insertQry, userID, recoveryCodeHashes); err != nil {
+		return fmt.Errorf("store: EnableUserTOTP: could not insert recovery codes: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: EnableUserTOTP: could not commit: %w", err)
+	}
+
+	return nil
+}
+
+func (ds *Store) DisableUserTOTP(ctx context.Context, userID int) error {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: DisableUserTOTP: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const qry = `
+	UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+	WHERE id = $1`
+
+	if _, err = tx.Exec(ctx, qry, userID); err != nil {
+		return fmt.Errorf("store: DisableUserTOTP: could not update: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("store: DisableUserTOTP: could not delete recovery codes: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: DisableUserTOTP: could not commit: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeTOTPStep records the time step of an accepted code, it returns
+// ErrTOTPCodeReused when a code of the same or a later step was accepted before.
+func (ds *Store) ConsumeTOTPStep(ctx context.Context, userID int, step int64) error {
+	const qry = `
+	UPDATE users SET totp_last_step = $2
+	WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`
+
+	result, err := ds.pool.Exec(ctx, qry, userID, step)
+	if err != nil {
+		return fmt.Errorf("store: ConsumeTOTPStep: could not update: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the recovery code with the given hash as used.
+func (ds *Store) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) error {
+	const qry = `
+	UPDATE user_recovery_codes SET used_at = now()
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := ds.pool.Exec(ctx, qry, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("store: UseRecoveryCode: could not update: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
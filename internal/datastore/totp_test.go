@@ -0,0 +1,115 @@
+package datastore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func TestUserTOTP(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("enables the pending enrolment with its recovery codes", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		if err := ds.SetUserTOTPSecret(context.Background(), user.ID, []byte("secret")); err != nil {
+			t.Fatalf("failed to set secret: %v", err)
+		}
+
+		if err := ds.EnableUserTOTP(context.Background(), user.ID, [][]byte{[]byte("code-1"), []byte("code-2")}); err != nil {
+			t.Fatalf("failed to enable: %v", err)
+		}
+
+		got, err := ds.GetUser(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if !got.TOTPEnabledAt.Valid || string(got.TOTPSecret) != "secret" {
+			t.Errorf("expected totp to be enabled with the secret, got %v %q", got.TOTPEnabledAt, got.TOTPSecret)
+		}
+
+		err = ds.SetUserTOTPSecret(context.Background(), user.ID, []byte("other"))
+		if !errors.Is(err, datastore.ErrTOTPAlreadyEnabled) {
+			t.Fatalf("expected ErrTOTPAlreadyEnabled, got %v", err)
+		}
+
+		if err = ds.UseRecoveryCode(context.Background(), user.ID, []byte("code-1")); err != nil {
+			t.Fatalf("failed to use recovery code: %v", err)
+		}
+
+		err = ds.UseRecoveryCode(context.Background(), user.ID, []byte("code-1"))
+		if !errors.Is(err, datastore.ErrRecoveryCodeNotFound) {
+			t.Fatalf("expected ErrRecoveryCodeNotFound on reuse, got %v", err)
+		}
+	})
+
+	t.Run("returns ErrTOTPEnrolmentNotFound without a pending enrolment", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		err := ds.EnableUserTOTP(context.Background(), user.ID, nil)
+		if !errors.Is(err, datastore.ErrTOTPEnrolmentNotFound) {
+			t.Fatalf("expected ErrTOTPEnrolmentNotFound, got %v", err)
+		}
+	})
+
+	t.Run("rejects a step that is not after the last one", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		if err := ds.ConsumeTOTPStep(context.Background(), user.ID, 100); err != nil {
+			t.Fatalf("failed to consume step: %v", err)
+		}
+
+		for _, step := range []int64{100, 99} {
+			err := ds.ConsumeTOTPStep(context.Background(), user.ID, step)
+			if !errors.Is(err, datastore.ErrTOTPCodeReused) {
+				t.Fatalf("expected ErrTOTPCodeReused for step %d, got %v", step, err)
+			}
+		}
+
+		if err := ds.ConsumeTOTPStep(context.Background(), user.ID, 101); err != nil {
+			t.Fatalf("failed to consume step: %v", err)
+		}
+	})
+
+	t.Run("disables and removes the recovery codes", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		if err := ds.SetUserTOTPSecret(context.Background(), user.ID, []byte("secret")); err != nil {
+			t.Fatalf("failed to set secret: %v", err)
+		}
+
+		if err := ds.EnableUserTOTP(context.Background(), user.ID, [][]byte{[]byte("code-1")}); err != nil {
+			t.Fatalf("failed to enable: %v", err)
+		}
+
+		if err := ds.DisableUserTOTP(context.Background(), user.ID); err != nil {
+			t.Fatalf("failed to disable: %v", err)
+		}
+
+		got, err := ds.GetUser(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if got.TOTPEnabledAt.Valid || got.TOTPSecret != nil {
+			t.Error("expected totp to be disabled")
+		}
+
+		err = ds.UseRecoveryCode(context.Background(), user.ID, []byte("code-1"))
+		if !errors.Is(err, datastore.ErrRecoveryCodeNotFound) {
+			t.Fatalf("expected ErrRecoveryCodeNotFound, got %v", err)
+		}
+	})
+}
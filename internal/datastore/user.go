@@ -0,0 +1,232 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+)
+
+type User struct {
+	ID              int
+	Email           string
+	Name            sql.NullString
+	OIDCSubject     sql.NullString
+	PasswordHash    []byte
+	EmailVerifiedAt sql.NullTime
+	// TOTPSecret is encrypted, it is set during enrolment before TOTPEnabledAt
+	TOTPSecret    []byte
+	TOTPEnabledAt sql.NullTime
+	Roles         []string
+	CreatedAt     time.Time
+}
+
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrUserNotFound    = errors.New("store: user not found")
+	ErrUserEmailExists = errors.New("store: user with this email already exists")
+)
+
+// userSelect selects the columns scanned by scanUser, queries using it
+// have to join users as u and group by u.id.
+const userSelect = `
+	SELECT u.id, u.email, u.name, u.oidc_subject, u.password_hash, u.email_verified_at,
+		u.totp_secret, u.totp_enabled_at, u.created_at,
+		COALESCE(array_agg(r.role ORDER BY r.role) FILTER (WHERE r.role IS NOT NULL), '{}')`
+
+// scanUser scans the columns of userSelect, followed by the extra ones.
+func scanUser(row pgx.Row, extra ...any) (*User, error) {
+	var user User
+
+	dest := []any{
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.OIDCSubject,
+		&user.PasswordHash,
+		&user.EmailVerifiedAt,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.CreatedAt,
+		&user.Roles,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (ds *Store) GetUser(ctx context.Context, ID int) (*User, error) {
+	const qry = userSelect + `
+	FROM users u
+	LEFT JOIN user_roles r ON r.user_id = u.id
+	WHERE u.id = $1
+	GROUP BY u.id`
+
+	user, err := scanUser(ds.pool.QueryRow(ctx, qry, ID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (ds *Store) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	const qry = userSelect + `
+	FROM users u
+	LEFT JOIN user_roles r ON r.user_id = u.id
+	WHERE u.email = $1
+	GROUP BY u.id`
+
+	user, err := scanUser(ds.pool.QueryRow(ctx, qry, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// InsertUser inserts the user along with its roles, for users created by
+// operators rather than signing in through OIDC.
+func (ds *Store) InsertUser(ctx context.Context, user *User) error {
+	if user == nil {
+		return errors.New("store: InsertUser: user is nil")
+	}
+
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: InsertUser: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const qry = `
+	INSERT INTO users (email, name, password_hash, email_verified_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+
+	err = tx.QueryRow(
+		ctx,
+		qry,
+		user.Email,
+		user.Name,
+		user.PasswordHash,
+		user.EmailVerifiedAt,
+	).Scan(
+		&user.ID,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if getConstraintViolationName(err) != "" {
+			return ErrUserEmailExists
+		}
+		return fmt.Errorf("store: InsertUser: could not insert user: %w", err)
+	}
+
+	const rolesQry = `
+	INSERT INTO user_roles (user_id, role)
+	SELECT $1, unnest($2::text[])
+	ON CONFLICT DO NOTHING`
+
+	if _, err = tx.Exec(ctx, rolesQry, user.ID, user.Roles); err != nil {
+		return fmt.Errorf("store: InsertUser: could not insert roles: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: InsertUser: could not commit: %w", err)
+	}
+
+	return nil
+}
+
+// UpsertOIDCUser inserts the user or, when a user with the same OIDC subject
+// already exists, refreshes its email and name from the identity provider.
+func (ds *Store) UpsertOIDCUser(ctx context.Context, user *User) error {
+	if user == nil {
+		return errors.New("store: UpsertOIDCUser: user is nil")
+	}
+
+	if !user.OIDCSubject.Valid || user.OIDCSubject.String == "" {
+		return errors.New("store: UpsertOIDCUser: oidc subject is required")
+	}
+
+	const qry = `
+	INSERT INTO users (email, name, oidc_subject)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (oidc_subject) DO UPDATE
+	SET email = EXCLUDED.email, name = EXCLUDED.name
+	RETURNING id, totp_enabled_at, created_at`
+
+	err := ds.pool.QueryRow(
+		ctx,
+		qry,
+		user.Email,
+		user.Name,
+		user.OIDCSubject,
+	).Scan(
+		&user.ID,
+		&user.TOTPEnabledAt,
+		&user.CreatedAt,
+	)
+
+	if err != nil {
+		if getConstraintViolationName(err) != "" {
+			return ErrUserEmailExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// SetUserRoles replaces all roles of the user with the given ones.
+func (ds *Store) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: SetUserRoles: could not begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `DELETE FROM user_roles WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("store: SetUserRoles: could not delete roles: %w", err)
+	}
+
+	const qry = `
+	INSERT INTO user_roles (user_id, role)
+	SELECT $1, unnest($2::text[])
+	ON CONFLICT DO NOTHING`
+
+	if _, err = tx.Exec(ctx, qry, userID, roles); err != nil {
+		return fmt.Errorf("store: SetUserRoles: could not insert roles: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: SetUserRoles: could not commit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package datastore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+func removeAllUsers(t *testing.T, dbpool *pgxpool.Pool) {
+	_, err := dbpool.Exec(context.Background(), `DELETE FROM users`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func storeOIDCUser(t *testing.T, ds *datastore.Store, subject, email string) *datastore.User {
+	t.Helper()
+
+	user := &datastore.User{
+		Email:       email,
+		OIDCSubject: sql.NullString{String: subject, Valid: true},
+	}
+
+	if err := ds.UpsertOIDCUser(context.Background(), user); err != nil {
+		t.Fatalf("failed to upsert user: %v", err)
+	}
+
+	return user
+}
+
+func TestUpsertOIDCUser(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("inserts a new user", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		if user.ID == 0 {
+			t.Error("expected user.ID to be set")
+		}
+
+		if time.Until(user.CreatedAt).Abs() > 2*time.Second {
+			t.Errorf("expected user.CreatedAt to be close to now, got %v", user.CreatedAt)
+		}
+	})
+
+	t.Run("updates the user with the same subject", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		first := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+		second := storeOIDCUser(t, ds, "subject-1", "jane.doe@example.com")
+
+		if first.ID != second.ID {
+			t.Fatalf("expected the same user, got IDs %d and %d", first.ID, second.ID)
+		}
+
+		user, err := ds.GetUser(context.Background(), first.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if user.Email != "jane.doe@example.com" {
+			t.Errorf("expected email to be updated, got %s", user.Email)
+		}
+	})
+
+	t.Run("returns error when another subject uses the email", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		err := ds.UpsertOIDCUser(context.Background(), &datastore.User{
+			Email:       "jane@example.com",
+			OIDCSubject: sql.NullString{String: "subject-2", Valid: true},
+		})
+		if !errors.Is(err, datastore.ErrUserEmailExists) {
+			t.Fatalf("expected ErrUserEmailExists, got %v", err)
+		}
+	})
+}
+
+func TestInsertUser(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("inserts the user with its roles", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := &datastore.User{
+			Email:           "jane@example.com",
+			Name:            sql.NullString{String: "Jane", Valid: true},
+			PasswordHash:    []byte("hash"),
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			Roles:           []string{"editor", "admin"},
+		}
+
+		if err := ds.InsertUser(context.Background(), user); err != nil {
+			t.Fatalf("failed to insert user: %v", err)
+		}
+
+		got, err := ds.GetUserByEmail(context.Background(), "jane@example.com")
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if got.ID != user.ID || string(got.PasswordHash) != "hash" || !got.EmailVerifiedAt.Valid {
+			t.Errorf("expected the inserted user, got %+v", got)
+		}
+		if diff := cmp.Diff([]string{"admin", "editor"}, got.Roles); diff != "" {
+			t.Errorf("roles mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("returns ErrUserEmailExists for a taken email", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		err := ds.InsertUser(context.Background(), &datastore.User{Email: "jane@example.com"})
+		if !errors.Is(err, datastore.ErrUserEmailExists) {
+			t.Fatalf("expected ErrUserEmailExists, got %v", err)
+		}
+	})
+}
+
+func TestSetUserRoles(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("replaces the roles of the user", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		if err := ds.SetUserRoles(context.Background(), user.ID, []string{"editor"}); err != nil {
+			t.Fatalf("failed to set roles: %v", err)
+		}
+
+		if err := ds.SetUserRoles(context.Background(), user.ID, []string{"editor", "admin"}); err != nil {
+			t.Fatalf("failed to set roles: %v", err)
+		}
+
+		got, err := ds.GetUser(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if diff := cmp.Diff([]string{"admin", "editor"}, got.Roles); diff != "" {
+			t.Errorf("roles mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("removes all roles", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		if err := ds.SetUserRoles(context.Background(), user.ID, []string{"admin"}); err != nil {
+			t.Fatalf("failed to set roles: %v", err)
+		}
+
+		if err := ds.SetUserRoles(context.Background(), user.ID, nil); err != nil {
+			t.Fatalf("failed to set roles: %v", err)
+		}
+
+		got, err := ds.GetUser(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+
+		if len(got.Roles) != 0 {
+			t.Errorf("expected no roles, got %v", got.Roles)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	pool := connect(t)
+	ds := datastore.New(pool)
+
+	t.Run("returns the user of a valid session", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		err := ds.InsertSession(context.Background(), &datastore.Session{
+			TokenHash: []byte("hash"),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("failed to insert session: %v", err)
+		}
+
+		got, err := ds.GetSession(context.Background(), []byte("hash"))
+		if err != nil {
+			t.Fatalf("failed to get session: %v", err)
+		}
+
+		if got.User.ID != user.ID {
+			t.Errorf("expected user %d, got %d", user.ID, got.User.ID)
+		}
+	})
+
+	t.Run("returns ErrSessionNotFound for an expired session", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		err := ds.InsertSession(context.Background(), &datastore.Session{
+			TokenHash: []byte("hash"),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("failed to insert session: %v", err)
+		}
+
+		_, err = ds.GetSession(context.Background(), []byte("hash"))
+		if !errors.Is(err, datastore.ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("returns ErrSessionNotFound for a deleted session", func(t *testing.T) {
+		defer removeAllUsers(t, pool)
+
+		user := storeOIDCUser(t, ds, "subject-1", "jane@example.com")
+
+		err := ds.InsertSession(context.Background(), &datastore.Session{
+			TokenHash: []byte("hash"),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("failed to insert session: %v", err)
+		}
+
+		if err = ds.DeleteSession(context.Background(), []byte("hash")); err != nil {
+			t.Fatalf("failed to delete session: %v", err)
+		}
+
+		_, err = ds.GetSession(context.Background(), []byte("hash"))
+		if !errors.Is(err, datastore.ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound, got %v", err)
+		}
+	})
+}
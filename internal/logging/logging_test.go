@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewJSONHandler(&buf, nil)))
+
+	ctx := WithAttrs(context.Background(), slog.String("request_id", "abc"))
+	ctx = WithAttrs(ctx, slog.Int("user_id", 1))
+
+	logger.InfoContext(ctx, "hello", "key", "value")
+	logger.Info("without context")
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	logger.InfoContext(trace.ContextWithSpanContext(context.Background(), spanCtx), "traced")
+
+	var records []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		delete(record, "time")
+		records = append(records, record)
+	}
+
+	want := []map[string]any{
+		{"level": "INFO", "msg": "hello", "key": "value", "request_id": "abc", "user_id": float64(1)},
+		{"level": "INFO", "msg": "without context"},
+		{"level": "INFO", "msg": "traced", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"},
+	}
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Errorf("records mismatch (-want +got):\n%s", diff)
+	}
+}
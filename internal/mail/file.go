@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// LogMailer only logs the recipient and subject of the messages, it is meant
+// for local development. The bodies are left out, their links carry tokens
+// that take over accounts.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "mail: sending message", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// FileMailer writes every message as an .eml file into a directory,
+// it is meant for local development and tests.
+type FileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mail: create directory: %w", err)
+	}
+
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%d-%03d.eml", time.Now().UnixNano(), m.seq.Add(1))
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0o644); err != nil {
+		return fmt.Errorf("mail: write message: %w", err)
+	}
+
+	return nil
+}
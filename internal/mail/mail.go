@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// templates holds a template set per file by its name without extension, as
+// each file defines its own "subject" and "body".
+var templates = parseTemplates()
+
+func parseTemplates() map[string]*template.Template {
+	paths, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+
+	sets := make(map[string]*template.Template, len(paths))
+	for _, p := range paths {
+		sets[strings.TrimSuffix(path.Base(p), ".tmpl")] = template.Must(template.ParseFS(templateFS, p))
+	}
+
+	return sets
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers a single message, implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Render builds a message for the recipient from the named template, which
+// defines both a "subject" and a "body" block.
+func Render(to, name string, data any) (Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("mail: template %q not found", name)
+	}
+
+	var subject, body bytes.Buffer
+
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("mail: render subject of %q: %w", name, err)
+	}
+
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, fmt.Errorf("mail: render body of %q: %w", name, err)
+	}
+
+	return Message{
+		To:      to,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,156 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/mail"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    string
+		subject string
+	}{
+		{name: "email_verification", link: "https://movie-land.test/verify-email?token=abc", subject: "Verify your MovieLand email address"},
+		{name: "password_reset", link: "https://movie-land.test/reset-password?token=def", subject: "Reset your MovieLand password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := mail.Render("jane@example.com", tt.name, map[string]any{
+				"Link":      tt.link,
+				"ExpiresIn": "1h0m0s",
+			})
+			if err != nil {
+				t.Fatalf("failed to render: %v", err)
+			}
+
+			if msg.To != "jane@example.com" {
+				t.Errorf("expected recipient jane@example.com, got %q", msg.To)
+			}
+
+			if msg.Subject != tt.subject {
+				t.Errorf("expected subject %q, got %q", tt.subject, msg.Subject)
+			}
+
+			if !strings.Contains(msg.Body, tt.link) {
+				t.Errorf("expected body to contain the link, got:\n%s", msg.Body)
+			}
+		})
+	}
+
+	t.Run("returns an error for an unknown template", func(t *testing.T) {
+		if _, err := mail.Render("jane@example.com", "unknown", nil); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	mailer, err := mail.NewFileMailer(dir, "no-reply@movie-land.test")
+	if err != nil {
+		t.Fatalf("failed to create mailer: %v", err)
+	}
+
+	err = mailer.Send(context.Background(), mail.Message{
+		To:      "jane@example.com",
+		Subject: "Hello",
+		Body:    "Hi Jane",
+	})
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(entries))
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"From: no-reply@movie-land.test", "To: jane@example.com", "Subject: Hello", "Hi Jane"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected message to contain %q, got:\n%s", want, content)
+		}
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	err := mail.LogMailer{}.Send(context.Background(), mail.Message{
+		To:      "jane@example.com",
+		Subject: "Reset your MovieLand password",
+		Body:    "https://movie-land.test/reset-password?token=secret",
+	})
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if !strings.Contains(logs.String(), "jane@example.com") {
+		t.Errorf("expected the recipient to be logged, got %s", logs.String())
+	}
+
+	if strings.Contains(logs.String(), "secret") {
+		t.Errorf("expected the body not to be logged, got %s", logs.String())
+	}
+}
+
+func TestSMTPMailerGivesUp(t *testing.T) {
+	// the server accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	mailer := mail.NewSMTPMailer(mail.SMTPOptions{Host: "127.0.0.1", Port: addr.Port, From: "no-reply@movie-land.test"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- mailer.Send(ctx, mail.Message{To: "jane@example.com", Subject: "Hello", Body: "Hi Jane"})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error from a stuck server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Send to give up once the context is done")
+	}
+}
@@ -2,32 +2,163 @@ package pg
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// PoolOptions configures the pool, zero values keep the defaults of pgx and
+// the pool_ parameters of the connection string.
 type PoolOptions struct {
 	ConnString  string
 	PingTimeout time.Duration
+	// ConnectTimeout is how long Connect retries to reach the database, zero
+	// gives up after the first attempt
+	ConnectTimeout    time.Duration
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	StatementTimeout  time.Duration
+	ApplicationName   string
+	// SimpleProtocol sends queries without preparing them, for PgBouncer in
+	// transaction pooling mode
+	SimpleProtocol bool
 }
 
+// Connect creates the pool and pings the database, retrying with exponential
+// backoff until ConnectTimeout as the database may still be starting.
 func Connect(ctx context.Context, opts PoolOptions) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, opts.ConnString)
+	pool, err := Open(ctx, opts)
 	if err != nil {
-		return nil, fmt.Errorf("pool: could not create pool: %w", err)
+		return nil, err
 	}
 
-	pingCtx, cancel := context.WithTimeout(ctx, opts.PingTimeout)
-	defer cancel()
-
-	slog.Info("pinging database to verify connection", "timeout", opts.PingTimeout)
-	if err := pool.Ping(pingCtx); err != nil {
+	if err := ping(ctx, pool, opts); err != nil {
 		pool.Close()
 		return nil, fmt.Errorf("pool: could not ping database: %w", err)
 	}
 
 	return pool, nil
 }
+
+// Open creates the pool without connecting, the connections are made as
+// they are needed.
+func Open(ctx context.Context, opts PoolOptions) (*pgxpool.Pool, error) {
+	cfg, err := poolConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("pool: could not create pool: %w", err)
+	}
+
+	return pool, nil
+}
+
+func poolConfig(opts PoolOptions) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(opts.ConnString)
+	if err != nil {
+		return nil, fmt.Errorf("pool: could not parse connection string: %w", err)
+	}
+
+	cfg.ConnConfig.Tracer = newQueryTracer()
+
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		cfg.MinConns = opts.MinConns
+	}
+	if opts.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = opts.MaxConnIdleTime
+	}
+	if opts.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = opts.HealthCheckPeriod
+	}
+
+	params := cfg.ConnConfig.RuntimeParams
+	if opts.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+	}
+	if opts.ApplicationName != "" {
+		params["application_name"] = opts.ApplicationName
+	}
+
+	if opts.SimpleProtocol {
+		cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	}
+
+	return cfg, nil
+}
+
+// ping pings the database until it answers, the deadline passes or the error
+// is one that retrying does not fix.
+func ping(ctx context.Context, pool *pgxpool.Pool, opts PoolOptions) error {
+	deadline := time.Now().Add(opts.ConnectTimeout)
+
+	slog.Info("pinging database to verify connection", "timeout", opts.PingTimeout, "connect_timeout", opts.ConnectTimeout)
+
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancelPing := context.WithTimeout(ctx, opts.PingTimeout)
+		err := pool.Ping(pingCtx)
+		cancelPing()
+
+		if err == nil || !retryable(err) {
+			return err
+		}
+
+		delay := backoff(attempt)
+		if time.Until(deadline) < delay {
+			return err
+		}
+
+		slog.Warn("could not reach the database, retrying", "attempt", attempt, "delay", delay, "err", err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// retryable tells whether the database may answer the next attempt, it will
+// not once it rejected the credentials.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "28") {
+		return false
+	}
+
+	return true
+}
+
+// backoff doubles the delay with every attempt up to retryMaxDelay, jittered
+// between half and the full delay so replicas starting together spread out.
+func backoff(attempt int) time.Duration {
+	delay := min(float64(retryBaseDelay)*math.Pow(2, float64(attempt-1)), float64(retryMaxDelay))
+
+	half := time.Duration(delay / 2)
+	return half + rand.N(half+1)
+}
@@ -0,0 +1,171 @@
+package pg
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/tommarien/movie-land/internal/pg"
+
+// queryTracer emits a span for every query, the arguments are left out and
+// literals in the SQL are replaced so no values end up in the traces.
+type queryTracer struct {
+	tracer trace.Tracer
+}
+
+func newQueryTracer() *queryTracer {
+	return &queryTracer{tracer: otel.Tracer(tracerName)}
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := operationName(data.SQL)
+
+	name := semconv.DBSystemNamePostgreSQL.Value.AsString()
+	if operation != "" {
+		name = operation
+	}
+
+	ctx, _ = t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBQueryText(sanitizeSQL(data.SQL)),
+			semconv.DBOperationName(operation),
+		),
+	)
+
+	return ctx
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+
+	span.End()
+}
+
+// operationName returns the leading keyword of the statement, like SELECT.
+func operationName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return strings.ToUpper(fields[0])
+}
+
+// sanitizeSQL replaces string, dollar-quoted and numeric literals by ? and
+// collapses whitespace, placeholders like $1 are kept.
+func sanitizeSQL(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+
+	runes := []rune(sql)
+	space := false
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+
+		switch {
+		case r == '\'':
+			// skip to the closing quote, '' escapes a quote
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+
+		case unicode.IsDigit(r) && !partOfWord(runes, i):
+			for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+
+		case r == '$' && !partOfWord(runes, i):
+			if tag, ok := dollarQuoteTag(runes, i); ok {
+				// skip to the closing tag, the body may contain anything
+				i = closingDollarQuote(runes, i+len(tag), tag)
+				b.WriteByte('?')
+				continue
+			}
+
+			// keep placeholders along with their number
+			b.WriteRune(r)
+			for i+1 < len(runes) && unicode.IsDigit(runes[i+1]) {
+				i++
+				b.WriteRune(runes[i])
+			}
+
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// dollarQuoteTag returns the opening tag of the dollar-quoted string at i,
+// like $$ or $body$, tags cannot start with a digit so placeholders are none.
+func dollarQuoteTag(runes []rune, i int) ([]rune, bool) {
+	for j := i + 1; j < len(runes); j++ {
+		r := runes[j]
+		switch {
+		case r == '$':
+			return runes[i : j+1], true
+		case unicode.IsLetter(r) || r == '_' || (unicode.IsDigit(r) && j > i+1):
+		default:
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// closingDollarQuote returns the index of the last rune of the tag closing the
+// string that starts at i, or of the last rune when it is never closed.
+func closingDollarQuote(runes []rune, i int, tag []rune) int {
+	for ; i+len(tag) <= len(runes); i++ {
+		if slices.Equal(runes[i:i+len(tag)], tag) {
+			return i + len(tag) - 1
+		}
+	}
+
+	return len(runes) - 1
+}
+
+// partOfWord reports whether the digit at i belongs to an identifier, like the 2 in md5.
+func partOfWord(runes []rune, i int) bool {
+	if i == 0 {
+		return false
+	}
+
+	prev := runes[i-1]
+	return unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '_'
+}
@@ -0,0 +1,88 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql: `
+	SELECT id, slug, name
+	FROM genres
+	WHERE id = $1`,
+			want: "SELECT id, slug, name FROM genres WHERE id = $1",
+		},
+		{
+			sql:  "SELECT * FROM users WHERE email = 'jane@example.com' AND name = 'O''Brien'",
+			want: "SELECT * FROM users WHERE email = ? AND name = ?",
+		},
+		{
+			sql:  "SELECT md5(name) FROM genres LIMIT 10 OFFSET 2.5",
+			want: "SELECT md5(name) FROM genres LIMIT ? OFFSET ?",
+		},
+		{
+			sql:  "SELECT $$it's a secret$$, $tag$ends with $$ $tag$ FROM genres WHERE id = $1",
+			want: "SELECT ?, ? FROM genres WHERE id = $1",
+		},
+		{
+			sql:  "SELECT $body$never closed 'secret'",
+			want: "SELECT ?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := sanitizeSQL(tt.sql); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	tracer := &queryTracer{tracer: provider.Tracer(tracerName)}
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL:  "SELECT name FROM genres WHERE slug = 'drama' AND id = $1",
+		Args: []any{1},
+	})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "SELECT" {
+		t.Errorf("expected span name SELECT, got %q", span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected status error, got %v", span.Status().Code)
+	}
+
+	want := []attribute.KeyValue{
+		attribute.String("db.system.name", "postgresql"),
+		attribute.String("db.query.text", "SELECT name FROM genres WHERE slug = ? AND id = $1"),
+		attribute.String("db.operation.name", "SELECT"),
+	}
+	if diff := cmp.Diff(want, span.Attributes(), cmp.AllowUnexported(attribute.Value{})); diff != "" {
+		t.Errorf("attributes mismatch (-want +got):\n%s", diff)
+	}
+}
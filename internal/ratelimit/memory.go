@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type memoryEntry struct {
+	bucket Bucket
+	fullAt time.Time
+}
+
+// MemoryLimiter keeps the buckets in memory, the limits only hold for a single
+// instance of the app.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	bucket, result := limit.Take(m.buckets[key].bucket, now)
+	m.buckets[key] = memoryEntry{bucket: bucket, fullAt: now.Add(result.Reset)}
+
+	return result, nil
+}
+
+// sweep drops the buckets that have refilled completely,
+// they are no different from the buckets of new clients.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, entry := range m.buckets {
+		if !entry.fullAt.After(now) {
+			delete(m.buckets, key)
+		}
+	}
+}
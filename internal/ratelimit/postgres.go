@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/datastore"
+)
+
+type BucketStore interface {
+	UpdateRateLimitBucket(ctx context.Context, key string, update func(bucket *datastore.RateLimitBucket)) error
+	DeleteRateLimitBucketsBefore(ctx context.Context, before time.Time) error
+}
+
+// PostgresLimiter keeps the buckets in Postgres, so the limits hold across
+// all instances of the app.
+type PostgresLimiter struct {
+	store BucketStore
+	// staleAfter is the longest period of the limits in use,
+	// buckets that were not updated for longer are full
+	staleAfter time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresLimiter(store BucketStore, staleAfter time.Duration) *PostgresLimiter {
+	return &PostgresLimiter{
+		store:      store,
+		staleAfter: staleAfter,
+		now:        time.Now,
+	}
+}
+
+func (p *PostgresLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := p.now()
+	p.sweep(now)
+
+	var result Result
+
+	err := p.store.UpdateRateLimitBucket(ctx, key, func(b *datastore.RateLimitBucket) {
+		var bucket Bucket
+		bucket, result = limit.Take(Bucket{Tokens: b.Tokens, UpdatedAt: b.UpdatedAt}, now)
+
+		b.Tokens = bucket.Tokens
+		b.UpdatedAt = bucket.UpdatedAt
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// sweep deletes the stale buckets in the background, at most once per interval.
+func (p *PostgresLimiter) sweep(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.lastSweep) < sweepInterval {
+		return
+	}
+	p.lastSweep = now
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := p.store.DeleteRateLimitBucketsBefore(ctx, now.Add(-p.staleAfter)); err != nil {
+			slog.Warn("could not delete stale rate limit buckets", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+// Package ratelimit implements token bucket rate limiting. A bucket holds up to
+// Limit.Requests tokens and refills them evenly over Limit.Period, every request
+// takes one token.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// rate returns the number of tokens refilled per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until a token is available, zero when the request is allowed
+	RetryAfter time.Duration
+}
+
+// Bucket is the state of a client's bucket, the zero value is a full bucket.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Take refills the bucket for the time passed since its last update and takes
+// a token when one is available.
+func (l Limit) Take(b Bucket, now time.Time) (Bucket, Result) {
+	tokens := float64(l.Requests)
+	if !b.UpdatedAt.IsZero() {
+		elapsed := max(now.Sub(b.UpdatedAt).Seconds(), 0)
+		tokens = math.Min(tokens, b.Tokens+elapsed*l.rate())
+	}
+
+	result := Result{Limit: l.Requests}
+
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - tokens)
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = l.duration(float64(l.Requests) - tokens)
+
+	return Bucket{Tokens: tokens, UpdatedAt: now}, result
+}
+
+// duration returns the time it takes to refill the given number of tokens.
+func (l Limit) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate() * float64(time.Second))
+}
+
+// Limiter takes a token from the bucket of the key for every request.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
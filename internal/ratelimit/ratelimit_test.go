@@ -0,0 +1,91 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tommarien/movie-land/internal/ratelimit"
+)
+
+func TestTake(t *testing.T) {
+	limit := ratelimit.Limit{Requests: 2, Period: 2 * time.Second}
+	start := time.Date(2025, 10, 13, 8, 0, 0, 0, time.UTC)
+
+	t.Run("starts with a full bucket", func(t *testing.T) {
+		_, got := limit.Take(ratelimit.Bucket{}, start)
+
+		want := ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("result mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("denies once the bucket is empty", func(t *testing.T) {
+		bucket, _ := limit.Take(ratelimit.Bucket{}, start)
+		bucket, _ = limit.Take(bucket, start)
+
+		_, got := limit.Take(bucket, start.Add(500*time.Millisecond))
+
+		want := ratelimit.Result{
+			Allowed:    false,
+			Limit:      2,
+			Remaining:  0,
+			Reset:      1500 * time.Millisecond,
+			RetryAfter: 500 * time.Millisecond,
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("result mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("refills over the period without exceeding the limit", func(t *testing.T) {
+		bucket, _ := limit.Take(ratelimit.Bucket{}, start)
+		bucket, _ = limit.Take(bucket, start)
+
+		bucket, got := limit.Take(bucket, start.Add(time.Hour))
+
+		if !got.Allowed || got.Remaining != 1 {
+			t.Errorf("expected a full bucket to be allowed with 1 remaining, got %+v", got)
+		}
+
+		if bucket.Tokens != 1 {
+			t.Errorf("expected 1 token left, got %v", bucket.Tokens)
+		}
+	})
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	limit := ratelimit.Limit{Requests: 3, Period: time.Hour}
+
+	for i := range 3 {
+		result, err := limiter.Allow(context.Background(), "ip:192.0.2.1", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("expected request %d to be allowed with %d remaining, got %+v", i+1, 2-i, result)
+		}
+	}
+
+	result, err := limiter.Allow(context.Background(), "ip:192.0.2.1", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Allowed {
+		t.Error("expected the request beyond the limit to be denied")
+	}
+
+	result, err = limiter.Allow(context.Background(), "ip:192.0.2.2", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Allowed {
+		t.Error("expected another key to have its own bucket")
+	}
+}
@@ -0,0 +1,74 @@
+// Package secret encrypts small values, like TOTP secrets, before they are stored.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const KeySize = 32
+
+// Box seals and opens values with AES-256-GCM, every sealed value
+// carries its own random nonce as prefix.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secret: key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("secret: create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("secret: create gcm: %w", err)
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+// ParseKey decodes a base64 encoded key.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("secret: key is not valid base64: %w", err)
+	}
+
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secret: key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	return key, nil
+}
+
+func (b *Box) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (b *Box) Open(sealed []byte) ([]byte, error) {
+	size := b.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("secret: sealed value too short")
+	}
+
+	plaintext, err := b.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("secret: open: %w", err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,57 @@
+package secret_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tommarien/movie-land/internal/secret"
+)
+
+func TestBox(t *testing.T) {
+	box, err := secret.NewBox(bytes.Repeat([]byte{1}, secret.KeySize))
+	if err != nil {
+		t.Fatalf("failed to create box: %v", err)
+	}
+
+	t.Run("opens what it sealed", func(t *testing.T) {
+		sealed, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"))
+		if err != nil {
+			t.Fatalf("failed to seal: %v", err)
+		}
+
+		if bytes.Contains(sealed, []byte("JBSWY3DPEHPK3PXP")) {
+			t.Fatal("expected sealed value not to contain the plaintext")
+		}
+
+		opened, err := box.Open(sealed)
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+
+		if string(opened) != "JBSWY3DPEHPK3PXP" {
+			t.Errorf("expected JBSWY3DPEHPK3PXP, got %q", opened)
+		}
+	})
+
+	t.Run("refuses values sealed with another key", func(t *testing.T) {
+		other, err := secret.NewBox(bytes.Repeat([]byte{2}, secret.KeySize))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sealed, err := other.Seal([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = box.Open(sealed); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("refuses keys of the wrong size", func(t *testing.T) {
+		if _, err := secret.NewBox([]byte("short")); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,184 @@
+// Package tlsconfig serves TLS with certificates that are reloaded from disk,
+// so they can be rotated without a restart.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+// Reloader hands every TLS handshake the configuration loaded last. Reloads
+// only affect new connections, the open ones keep the certificate they
+// started with.
+type Reloader struct {
+	cfg     config.TLSConfig
+	current atomic.Pointer[tls.Config]
+
+	// mu serializes the reloads
+	mu     sync.Mutex
+	stamps []fileStamp
+}
+
+// fileStamp tells whether a file changed since it was loaded.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New loads the certificate, key and client CAs of the configuration.
+func New(cfg config.TLSConfig) (*Reloader, error) {
+	r := &Reloader{cfg: cfg}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Config returns the configuration to serve with, it looks up the loaded
+// configuration on every handshake.
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.cfg.Version(),
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Reload loads the files again, when they are invalid the configuration
+// loaded before stays in use.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// stamped before reading, so a change while reading is noticed next time
+	stamps, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	conf, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.current.Store(conf)
+	r.stamps = stamps
+
+	if leaf := conf.Certificates[0].Leaf; leaf != nil {
+		slog.Info("loaded tls certificate", "subject", leaf.Subject.String(), "not_after", leaf.NotAfter)
+	}
+
+	return nil
+}
+
+// Watch reloads the files when they change, checking every WatchInterval
+// until the context is done.
+func (r *Reloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := r.changed()
+		if err != nil {
+			slog.Warn("could not check tls files for changes", "err", err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			// files are often replaced one at a time, the next check tries again
+			slog.Warn("could not reload tls files, serving the previous ones", "err", err)
+		}
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientAuthEnabled() {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) stat() ([]fileStamp, error) {
+	var stamps []fileStamp
+
+	for _, name := range r.files() {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("tlsconfig: %w", err)
+		}
+		stamps = append(stamps, fileStamp{modTime: info.ModTime(), size: info.Size()})
+	}
+
+	return stamps, nil
+}
+
+func (r *Reloader) changed() (bool, error) {
+	stamps, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !slices.Equal(stamps, r.stamps), nil
+}
+
+func (r *Reloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tlsconfig: could not load key pair: %w", err)
+	}
+
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   r.cfg.Version(),
+		CipherSuites: r.cfg.CipherSuiteIDs(),
+		// the servers offer HTTP/2, the configuration of a handshake has to as well
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if r.cfg.ClientAuthEnabled() {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tlsconfig: could not read client CAs: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("tlsconfig: client CA file contains no certificates")
+		}
+
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.ClientAuth == config.TLSClientAuthRequire {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,264 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM encoded certificate and key of a leaf signed by the CA.
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes the file with a later modification time than before, so
+// changes are noticed however quickly they follow each other.
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	modTime := time.Now()
+	if info, err := os.Stat(name); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tlsFiles(t *testing.T) config.TLSConfig {
+	dir := t.TempDir()
+
+	return config.TLSConfig{
+		CertFile:      filepath.Join(dir, "tls.crt"),
+		KeyFile:       filepath.Join(dir, "tls.key"),
+		MinVersion:    "1.2",
+		ClientAuth:    config.TLSClientAuthOptional,
+		WatchInterval: 10 * time.Millisecond,
+	}
+}
+
+func servedSerial(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+
+	conf, err := r.Config().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conf.Certificates[0].Leaf.SerialNumber.Int64()
+}
+
+func TestReload(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsFiles(t)
+
+	cert, key := ca.issue(t, 10, "localhost", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+	writeFile(t, cfg.KeyFile, key)
+
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	if serial := servedSerial(t, r); serial != 10 {
+		t.Fatalf("expected serial 10, got %d", serial)
+	}
+
+	cert, key = ca.issue(t, 11, "localhost", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+	writeFile(t, cfg.KeyFile, key)
+
+	if err = r.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+
+	if serial := servedSerial(t, r); serial != 11 {
+		t.Errorf("expected serial 11 after reloading, got %d", serial)
+	}
+
+	// a certificate without its key is not loaded
+	cert, _ = ca.issue(t, 12, "localhost", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+
+	if err = r.Reload(); err == nil {
+		t.Fatal("expected an error for a mismatched key pair")
+	}
+
+	if serial := servedSerial(t, r); serial != 11 {
+		t.Errorf("expected the previous serial 11, got %d", serial)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsFiles(t)
+
+	cert, key := ca.issue(t, 10, "localhost", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+	writeFile(t, cfg.KeyFile, key)
+
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx)
+
+	cert, key = ca.issue(t, 11, "localhost", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.KeyFile, key)
+	writeFile(t, cfg.CertFile, cert)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedSerial(t, r) != 11 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the changed files to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsFiles(t)
+	cfg.ClientCAFile = filepath.Join(filepath.Dir(cfg.CertFile), "clients.crt")
+	cfg.ClientAuth = config.TLSClientAuthRequire
+
+	cert, key := ca.issue(t, 10, "localhost", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+	writeFile(t, cfg.KeyFile, key)
+	writeFile(t, cfg.ClientCAFile, ca.pem)
+
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	srv.TLS = r.Config()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: certs,
+		}}}
+	}
+
+	if _, err = client().Get(srv.URL); err == nil {
+		t.Error("expected a client without certificate to be refused")
+	}
+
+	clientCert, clientKey := ca.issue(t, 20, "ingest.internal", x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client(pair).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the client certificate to be accepted: %v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(body); got != "ingest.internal" {
+		t.Errorf("expected the verified client ingest.internal, got %q", got)
+	}
+}
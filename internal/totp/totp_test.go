@@ -0,0 +1,94 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/tommarien/movie-land/internal/totp"
+)
+
+// the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890"
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to the last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := totp.Code(rfcSecret, totp.Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got != tt.want {
+			t.Errorf("at %d: expected code %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		code   string
+		wantOK bool
+	}{
+		{name: "accepts the current code", at: now, code: "050471", wantOK: true},
+		{name: "accepts the code of the previous step", at: now.Add(totp.Period), code: "050471", wantOK: true},
+		{name: "rejects the code of two steps ago", at: now.Add(2 * totp.Period), code: "050471"},
+		{name: "rejects a wrong code", at: now, code: "123456"},
+		{name: "rejects a code of the wrong length", at: now, code: "50471"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := totp.Validate(rfcSecret, tt.code, tt.at)
+			if ok != tt.wantOK {
+				t.Fatalf("expected ok %v, got %v", tt.wantOK, ok)
+			}
+
+			if ok && step != totp.Step(now) {
+				t.Errorf("expected step %d, got %d", totp.Step(now), step)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("MovieLand", "jane@example.com", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("failed to parse uri: %v", err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("expected otpauth://totp, got %s://%s", u.Scheme, u.Host)
+	}
+
+	if u.Path != "/MovieLand:jane@example.com" {
+		t.Errorf("expected label MovieLand:jane@example.com, got %q", u.Path)
+	}
+
+	if got := u.Query().Get("secret"); got != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected secret JBSWY3DPEHPK3PXP, got %q", got)
+	}
+
+	if got := u.Query().Get("issuer"); got != "MovieLand" {
+		t.Errorf("expected issuer MovieLand, got %q", got)
+	}
+}
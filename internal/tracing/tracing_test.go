@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/tommarien/movie-land/internal/config"
+)
+
+func TestSetupStdout(t *testing.T) {
+	var buf bytes.Buffer
+
+	shutdown, err := Setup(context.Background(), config.TracingConfig{
+		Exporter:    config.TracingExporterStdout,
+		ServiceName: "movie-land-test",
+		SampleRatio: 1,
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test span")
+	span.End()
+
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"Name":"test span"`, `"Value":"movie-land-test"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected the exported span to contain %s, got %s", want, buf.String())
+		}
+	}
+}
@@ -2,7 +2,10 @@ package validator
 
 import (
 	"fmt"
+	"net/mail"
 	"regexp"
+	"slices"
+	"strings"
 )
 
 var slugRegex = regexp.MustCompile(`^[a-z-]+$`)
@@ -35,6 +38,34 @@ func (v *Validator) MaxLength(name, value string, maxLength int) {
 	}
 }
 
+func (v *Validator) MinLength(name, value string, minLength int) {
+	if value != "" && len(value) < minLength {
+		v.errors[name] = fmt.Sprintf("%s must be at least %d characters", name, minLength)
+	}
+}
+
+func (v *Validator) Email(name, value string) {
+	if value == "" {
+		return
+	}
+
+	if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+		v.errors[name] = fmt.Sprintf("%s must be a valid email address", name)
+	}
+}
+
+func (v *Validator) In(name, value string, allowed ...string) {
+	if value != "" && !slices.Contains(allowed, value) {
+		v.errors[name] = fmt.Sprintf("%s must be one of %s", name, strings.Join(allowed, ", "))
+	}
+}
+
+// HasError reports whether the field failed validation.
+func (v *Validator) HasError(name string) bool {
+	_, ok := v.errors[name]
+	return ok
+}
+
 func (v *Validator) IsValid() bool {
 	return len(v.errors) == 0
 }
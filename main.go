@@ -2,46 +2,23 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
 	"os"
 
-	"github.com/tommarien/movie-land/internal/api"
-	"github.com/tommarien/movie-land/internal/config"
-	"github.com/tommarien/movie-land/internal/datastore"
-	"github.com/tommarien/movie-land/internal/pg"
+	"github.com/tommarien/movie-land/internal/cli"
+	"github.com/tommarien/movie-land/internal/logging"
 )
 
 func main() {
-	if err := run(); err != nil {
-		slog.Error("uncaught error", "error", err)
-		os.Exit(1)
+	// the level is set once the config is parsed, the admin listener can change it
+	var logLevel slog.LevelVar
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel}))))
+
+	c := &cli.CLI{
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		LogLevel: &logLevel,
 	}
-}
-
-func run() error {
-	cfg, err := config.FromEnv()
-	if err != nil {
-		return fmt.Errorf("failed to parse envvars: %w", err)
-	}
-
-	ctx := context.Background()
-
-	pool, err := pg.Connect(ctx, pg.PoolOptions{
-		ConnString:  cfg.DatabaseUrl,
-		PingTimeout: cfg.DatabasePingTimeout,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to connect to db: %w", err)
-	}
-	defer pool.Close()
-
-	store := datastore.New(pool)
-
-	api := api.New(cfg, store)
-	if err = api.Start(ctx); err != nil {
-		return fmt.Errorf("failed to start api: %w", err)
-	}
-
-	return nil
+	os.Exit(c.Run(context.Background(), os.Args[1:]))
 }
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(254) UNIQUE NOT NULL,
+    name VARCHAR(100),
+    oidc_subject VARCHAR(255) UNIQUE,
+    created_at TIMESTAMP with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE user_roles (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'editor')),
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE sessions (
+    token_hash BYTEA PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP with time zone DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP with time zone NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE sessions;
+DROP TABLE user_roles;
+DROP TABLE users;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN password_hash BYTEA,
+    ADD COLUMN email_verified_at TIMESTAMP with time zone;
+
+CREATE TABLE user_tokens (
+    token_hash BYTEA PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose VARCHAR(40) NOT NULL CHECK (purpose IN ('email_verification', 'password_reset')),
+    created_at TIMESTAMP with time zone DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP with time zone NOT NULL,
+    used_at TIMESTAMP with time zone
+);
+
+CREATE INDEX user_tokens_user_id_purpose_idx ON user_tokens (user_id, purpose, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_tokens;
+
+ALTER TABLE users
+    DROP COLUMN email_verified_at,
+    DROP COLUMN password_hash;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN totp_secret BYTEA,
+    ADD COLUMN totp_enabled_at TIMESTAMP with time zone,
+    ADD COLUMN totp_last_step BIGINT;
+
+CREATE TABLE user_recovery_codes (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMP with time zone,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+ALTER TABLE sessions
+    ADD COLUMN mfa_pending BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN mfa_verified_at TIMESTAMP with time zone;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+    DROP COLUMN mfa_verified_at,
+    DROP COLUMN mfa_pending;
+
+DROP TABLE user_recovery_codes;
+
+ALTER TABLE users
+    DROP COLUMN totp_last_step,
+    DROP COLUMN totp_enabled_at,
+    DROP COLUMN totp_secret;
+-- +goose StatementEnd
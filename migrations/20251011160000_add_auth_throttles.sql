@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE auth_throttles (
+    scope TEXT NOT NULL CHECK (scope IN ('account', 'ip')),
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMP with time zone NOT NULL,
+    locked_until TIMESTAMP with time zone,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE TABLE auth_events (
+    id SERIAL PRIMARY KEY,
+    event TEXT NOT NULL,
+    email TEXT,
+    ip_address TEXT,
+    user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    actor_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_events_created_at_idx ON auth_events (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE auth_events;
+DROP TABLE auth_throttles;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE auth_throttles DROP CONSTRAINT auth_throttles_scope_check;
+ALTER TABLE auth_throttles ADD CONSTRAINT auth_throttles_scope_check CHECK (scope IN ('account', 'ip', 'mfa'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM auth_throttles WHERE scope = 'mfa';
+ALTER TABLE auth_throttles DROP CONSTRAINT auth_throttles_scope_check;
+ALTER TABLE auth_throttles ADD CONSTRAINT auth_throttles_scope_check CHECK (scope IN ('account', 'ip'));
+-- +goose StatementEnd
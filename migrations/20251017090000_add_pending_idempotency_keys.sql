@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE idempotency_keys
+    ALTER COLUMN status DROP NOT NULL,
+    ALTER COLUMN headers DROP NOT NULL,
+    ALTER COLUMN body DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM idempotency_keys WHERE status IS NULL;
+ALTER TABLE idempotency_keys
+    ALTER COLUMN status SET NOT NULL,
+    ALTER COLUMN headers SET NOT NULL,
+    ALTER COLUMN body SET NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,75 @@
+// Package migrations embeds the goose SQL migrations, so the binary knows the
+// schema version it was built for.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Versions returns the versions of the migrations in ascending order, goose
+// takes them from the numeric prefix of the file names.
+func Versions() ([]int64, error) {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrations: could not read: %w", err)
+	}
+
+	versions := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			return nil, fmt.Errorf("migrations: %s has no version prefix", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrations: %s has no version prefix", entry.Name())
+		}
+
+		versions = append(versions, version)
+	}
+
+	slices.Sort(versions)
+	return versions, nil
+}
+
+// LatestVersion returns the version of the newest migration, the schema
+// version the binary was built for.
+func LatestVersion() (int64, error) {
+	versions, err := Versions()
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+// NewProvider returns a goose provider applying the embedded migrations to
+// the Postgres database, so the goose binary is not needed. Migrating takes a
+// session level advisory lock, replicas starting together wait for the one
+// migrating, for up to 5 minutes.
+func NewProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("migrations: could not create locker: %w", err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, FS, goose.WithSessionLocker(locker))
+	if err != nil {
+		return nil, fmt.Errorf("migrations: could not create provider: %w", err)
+	}
+
+	return provider, nil
+}
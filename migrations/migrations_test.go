@@ -0,0 +1,74 @@
+package migrations
+
+import (
+	"database/sql"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestLatestVersion(t *testing.T) {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newest := entries[len(entries)-1].Name()
+
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(newest, strconv.FormatInt(latest, 10)+"_") {
+		t.Errorf("expected the version of %s, got %d", newest, latest)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != len(entries) {
+		t.Fatalf("expected %d versions, got %d", len(entries), len(versions))
+	}
+
+	if !slices.IsSorted(versions) {
+		t.Errorf("expected the versions in ascending order, got %v", versions)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	// sql.Open does not connect, listing the sources needs no database
+	db, err := sql.Open("pgx", "postgres://localhost:5432/movie-land")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	provider, err := NewProvider(db)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := provider.ListSources()
+	if len(sources) != len(entries) {
+		t.Errorf("expected %d migrations, got %d", len(entries), len(sources))
+	}
+}
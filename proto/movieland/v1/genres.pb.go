@@ -0,0 +1,706 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: movieland/v1/genres.proto
+
+package movielandv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Genre struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Slug  string                 `protobuf:"bytes,2,opt,name=slug,proto3" json:"slug,omitempty"`
+	// name is empty when the genre has none
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	CreateTime    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Genre) Reset() {
+	*x = Genre{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Genre) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Genre) ProtoMessage() {}
+
+func (x *Genre) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Genre.ProtoReflect.Descriptor instead.
+func (*Genre) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Genre) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Genre) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *Genre) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Genre) GetCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateTime
+	}
+	return nil
+}
+
+type GetGenreRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGenreRequest) Reset() {
+	*x = GetGenreRequest{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGenreRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGenreRequest) ProtoMessage() {}
+
+func (x *GetGenreRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGenreRequest.ProtoReflect.Descriptor instead.
+func (*GetGenreRequest) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetGenreRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type GetGenreResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Genre         *Genre                 `protobuf:"bytes,1,opt,name=genre,proto3" json:"genre,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGenreResponse) Reset() {
+	*x = GetGenreResponse{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGenreResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGenreResponse) ProtoMessage() {}
+
+func (x *GetGenreResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGenreResponse.ProtoReflect.Descriptor instead.
+func (*GetGenreResponse) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetGenreResponse) GetGenre() *Genre {
+	if x != nil {
+		return x.Genre
+	}
+	return nil
+}
+
+type ListGenresRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// page_size defaults to 20, with a maximum of 100
+	PageSize int32 `protobuf:"varint,1,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// page_token is the next_page_token of the previous page
+	PageToken string `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// search matches part of the slug or name, case insensitive
+	Search        string `protobuf:"bytes,3,opt,name=search,proto3" json:"search,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGenresRequest) Reset() {
+	*x = ListGenresRequest{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGenresRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGenresRequest) ProtoMessage() {}
+
+func (x *ListGenresRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGenresRequest.ProtoReflect.Descriptor instead.
+func (*ListGenresRequest) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListGenresRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListGenresRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *ListGenresRequest) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+type ListGenresResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Genres []*Genre               `protobuf:"bytes,1,rep,name=genres,proto3" json:"genres,omitempty"`
+	// next_page_token is empty on the last page
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGenresResponse) Reset() {
+	*x = ListGenresResponse{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGenresResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGenresResponse) ProtoMessage() {}
+
+func (x *ListGenresResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGenresResponse.ProtoReflect.Descriptor instead.
+func (*ListGenresResponse) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListGenresResponse) GetGenres() []*Genre {
+	if x != nil {
+		return x.Genres
+	}
+	return nil
+}
+
+func (x *ListGenresResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type StreamGenresRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// search matches part of the slug or name, case insensitive
+	Search        string `protobuf:"bytes,1,opt,name=search,proto3" json:"search,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamGenresRequest) Reset() {
+	*x = StreamGenresRequest{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamGenresRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamGenresRequest) ProtoMessage() {}
+
+func (x *StreamGenresRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamGenresRequest.ProtoReflect.Descriptor instead.
+func (*StreamGenresRequest) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StreamGenresRequest) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+type StreamGenresResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Genre         *Genre                 `protobuf:"bytes,1,opt,name=genre,proto3" json:"genre,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamGenresResponse) Reset() {
+	*x = StreamGenresResponse{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamGenresResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamGenresResponse) ProtoMessage() {}
+
+func (x *StreamGenresResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamGenresResponse.ProtoReflect.Descriptor instead.
+func (*StreamGenresResponse) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StreamGenresResponse) GetGenre() *Genre {
+	if x != nil {
+		return x.Genre
+	}
+	return nil
+}
+
+type CreateGenreRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Slug          string                 `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateGenreRequest) Reset() {
+	*x = CreateGenreRequest{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateGenreRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateGenreRequest) ProtoMessage() {}
+
+func (x *CreateGenreRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateGenreRequest.ProtoReflect.Descriptor instead.
+func (*CreateGenreRequest) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CreateGenreRequest) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *CreateGenreRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type CreateGenreResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Genre         *Genre                 `protobuf:"bytes,1,opt,name=genre,proto3" json:"genre,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateGenreResponse) Reset() {
+	*x = CreateGenreResponse{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateGenreResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateGenreResponse) ProtoMessage() {}
+
+func (x *CreateGenreResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateGenreResponse.ProtoReflect.Descriptor instead.
+func (*CreateGenreResponse) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CreateGenreResponse) GetGenre() *Genre {
+	if x != nil {
+		return x.Genre
+	}
+	return nil
+}
+
+type UpdateGenreRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Slug          string                 `protobuf:"bytes,2,opt,name=slug,proto3" json:"slug,omitempty"`
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateGenreRequest) Reset() {
+	*x = UpdateGenreRequest{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateGenreRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateGenreRequest) ProtoMessage() {}
+
+func (x *UpdateGenreRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateGenreRequest.ProtoReflect.Descriptor instead.
+func (*UpdateGenreRequest) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *UpdateGenreRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateGenreRequest) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *UpdateGenreRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type UpdateGenreResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Genre         *Genre                 `protobuf:"bytes,1,opt,name=genre,proto3" json:"genre,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateGenreResponse) Reset() {
+	*x = UpdateGenreResponse{}
+	mi := &file_movieland_v1_genres_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateGenreResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateGenreResponse) ProtoMessage() {}
+
+func (x *UpdateGenreResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_movieland_v1_genres_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateGenreResponse.ProtoReflect.Descriptor instead.
+func (*UpdateGenreResponse) Descriptor() ([]byte, []int) {
+	return file_movieland_v1_genres_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UpdateGenreResponse) GetGenre() *Genre {
+	if x != nil {
+		return x.Genre
+	}
+	return nil
+}
+
+var File_movieland_v1_genres_proto protoreflect.FileDescriptor
+
+const file_movieland_v1_genres_proto_rawDesc = "" +
+	"\n" +
+	"\x19movieland/v1/genres.proto\x12\fmovieland.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"|\n" +
+	"\x05Genre\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04slug\x18\x02 \x01(\tR\x04slug\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12;\n" +
+	"\vcreate_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"createTime\"!\n" +
+	"\x0fGetGenreRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"=\n" +
+	"\x10GetGenreResponse\x12)\n" +
+	"\x05genre\x18\x01 \x01(\v2\x13.movieland.v1.GenreR\x05genre\"g\n" +
+	"\x11ListGenresRequest\x12\x1b\n" +
+	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\x12\x16\n" +
+	"\x06search\x18\x03 \x01(\tR\x06search\"i\n" +
+	"\x12ListGenresResponse\x12+\n" +
+	"\x06genres\x18\x01 \x03(\v2\x13.movieland.v1.GenreR\x06genres\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"-\n" +
+	"\x13StreamGenresRequest\x12\x16\n" +
+	"\x06search\x18\x01 \x01(\tR\x06search\"A\n" +
+	"\x14StreamGenresResponse\x12)\n" +
+	"\x05genre\x18\x01 \x01(\v2\x13.movieland.v1.GenreR\x05genre\"<\n" +
+	"\x12CreateGenreRequest\x12\x12\n" +
+	"\x04slug\x18\x01 \x01(\tR\x04slug\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"@\n" +
+	"\x13CreateGenreResponse\x12)\n" +
+	"\x05genre\x18\x01 \x01(\v2\x13.movieland.v1.GenreR\x05genre\"L\n" +
+	"\x12UpdateGenreRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04slug\x18\x02 \x01(\tR\x04slug\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\"@\n" +
+	"\x13UpdateGenreResponse\x12)\n" +
+	"\x05genre\x18\x01 \x01(\v2\x13.movieland.v1.GenreR\x05genre2\xab\x03\n" +
+	"\fGenreService\x12I\n" +
+	"\bGetGenre\x12\x1d.movieland.v1.GetGenreRequest\x1a\x1e.movieland.v1.GetGenreResponse\x12O\n" +
+	"\n" +
+	"ListGenres\x12\x1f.movieland.v1.ListGenresRequest\x1a .movieland.v1.ListGenresResponse\x12W\n" +
+	"\fStreamGenres\x12!.movieland.v1.StreamGenresRequest\x1a\".movieland.v1.StreamGenresResponse0\x01\x12R\n" +
+	"\vCreateGenre\x12 .movieland.v1.CreateGenreRequest\x1a!.movieland.v1.CreateGenreResponse\x12R\n" +
+	"\vUpdateGenre\x12 .movieland.v1.UpdateGenreRequest\x1a!.movieland.v1.UpdateGenreResponseB@Z>github.com/tommarien/movie-land/proto/movieland/v1;movielandv1b\x06proto3"
+
+var (
+	file_movieland_v1_genres_proto_rawDescOnce sync.Once
+	file_movieland_v1_genres_proto_rawDescData []byte
+)
+
+func file_movieland_v1_genres_proto_rawDescGZIP() []byte {
+	file_movieland_v1_genres_proto_rawDescOnce.Do(func() {
+		file_movieland_v1_genres_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_movieland_v1_genres_proto_rawDesc), len(file_movieland_v1_genres_proto_rawDesc)))
+	})
+	return file_movieland_v1_genres_proto_rawDescData
+}
+
+var file_movieland_v1_genres_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_movieland_v1_genres_proto_goTypes = []any{
+	(*Genre)(nil),                 // 0: movieland.v1.Genre
+	(*GetGenreRequest)(nil),       // 1: movieland.v1.GetGenreRequest
+	(*GetGenreResponse)(nil),      // 2: movieland.v1.GetGenreResponse
+	(*ListGenresRequest)(nil),     // 3: movieland.v1.ListGenresRequest
+	(*ListGenresResponse)(nil),    // 4: movieland.v1.ListGenresResponse
+	(*StreamGenresRequest)(nil),   // 5: movieland.v1.StreamGenresRequest
+	(*StreamGenresResponse)(nil),  // 6: movieland.v1.StreamGenresResponse
+	(*CreateGenreRequest)(nil),    // 7: movieland.v1.CreateGenreRequest
+	(*CreateGenreResponse)(nil),   // 8: movieland.v1.CreateGenreResponse
+	(*UpdateGenreRequest)(nil),    // 9: movieland.v1.UpdateGenreRequest
+	(*UpdateGenreResponse)(nil),   // 10: movieland.v1.UpdateGenreResponse
+	(*timestamppb.Timestamp)(nil), // 11: google.protobuf.Timestamp
+}
+var file_movieland_v1_genres_proto_depIdxs = []int32{
+	11, // 0: movieland.v1.Genre.create_time:type_name -> google.protobuf.Timestamp
+	0,  // 1: movieland.v1.GetGenreResponse.genre:type_name -> movieland.v1.Genre
+	0,  // 2: movieland.v1.ListGenresResponse.genres:type_name -> movieland.v1.Genre
+	0,  // 3: movieland.v1.StreamGenresResponse.genre:type_name -> movieland.v1.Genre
+	0,  // 4: movieland.v1.CreateGenreResponse.genre:type_name -> movieland.v1.Genre
+	0,  // 5: movieland.v1.UpdateGenreResponse.genre:type_name -> movieland.v1.Genre
+	1,  // 6: movieland.v1.GenreService.GetGenre:input_type -> movieland.v1.GetGenreRequest
+	3,  // 7: movieland.v1.GenreService.ListGenres:input_type -> movieland.v1.ListGenresRequest
+	5,  // 8: movieland.v1.GenreService.StreamGenres:input_type -> movieland.v1.StreamGenresRequest
+	7,  // 9: movieland.v1.GenreService.CreateGenre:input_type -> movieland.v1.CreateGenreRequest
+	9,  // 10: movieland.v1.GenreService.UpdateGenre:input_type -> movieland.v1.UpdateGenreRequest
+	2,  // 11: movieland.v1.GenreService.GetGenre:output_type -> movieland.v1.GetGenreResponse
+	4,  // 12: movieland.v1.GenreService.ListGenres:output_type -> movieland.v1.ListGenresResponse
+	6,  // 13: movieland.v1.GenreService.StreamGenres:output_type -> movieland.v1.StreamGenresResponse
+	8,  // 14: movieland.v1.GenreService.CreateGenre:output_type -> movieland.v1.CreateGenreResponse
+	10, // 15: movieland.v1.GenreService.UpdateGenre:output_type -> movieland.v1.UpdateGenreResponse
+	11, // [11:16] is the sub-list for method output_type
+	6,  // [6:11] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_movieland_v1_genres_proto_init() }
+func file_movieland_v1_genres_proto_init() {
+	if File_movieland_v1_genres_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_movieland_v1_genres_proto_rawDesc), len(file_movieland_v1_genres_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_movieland_v1_genres_proto_goTypes,
+		DependencyIndexes: file_movieland_v1_genres_proto_depIdxs,
+		MessageInfos:      file_movieland_v1_genres_proto_msgTypes,
+	}.Build()
+	File_movieland_v1_genres_proto = out.File
+	file_movieland_v1_genres_proto_goTypes = nil
+	file_movieland_v1_genres_proto_depIdxs = nil
+}
@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: movieland/v1/genres.proto
+
+package movielandv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GenreService_GetGenre_FullMethodName     = "/movieland.v1.GenreService/GetGenre"
+	GenreService_ListGenres_FullMethodName   = "/movieland.v1.GenreService/ListGenres"
+	GenreService_StreamGenres_FullMethodName = "/movieland.v1.GenreService/StreamGenres"
+	GenreService_CreateGenre_FullMethodName  = "/movieland.v1.GenreService/CreateGenre"
+	GenreService_UpdateGenre_FullMethodName  = "/movieland.v1.GenreService/UpdateGenre"
+)
+
+// GenreServiceClient is the client API for GenreService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GenreService manages the genres of the catalog, on the same store as the
+// REST and GraphQL endpoints.
+type GenreServiceClient interface {
+	// GetGenre fails with NOT_FOUND for an unknown id.
+	GetGenre(ctx context.Context, in *GetGenreRequest, opts ...grpc.CallOption) (*GetGenreResponse, error)
+	// ListGenres pages through the genres ordered by slug.
+	ListGenres(ctx context.Context, in *ListGenresRequest, opts ...grpc.CallOption) (*ListGenresResponse, error)
+	// StreamGenres sends every genre ordered by slug, without paging.
+	StreamGenres(ctx context.Context, in *StreamGenresRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamGenresResponse], error)
+	// CreateGenre fails with INVALID_ARGUMENT for an invalid genre and with
+	// ALREADY_EXISTS when the slug is in use.
+	CreateGenre(ctx context.Context, in *CreateGenreRequest, opts ...grpc.CallOption) (*CreateGenreResponse, error)
+	// UpdateGenre replaces the slug and name of a genre, it fails like
+	// CreateGenre and with NOT_FOUND for an unknown id.
+	UpdateGenre(ctx context.Context, in *UpdateGenreRequest, opts ...grpc.CallOption) (*UpdateGenreResponse, error)
+}
+
+type genreServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGenreServiceClient(cc grpc.ClientConnInterface) GenreServiceClient {
+	return &genreServiceClient{cc}
+}
+
+func (c *genreServiceClient) GetGenre(ctx context.Context, in *GetGenreRequest, opts ...grpc.CallOption) (*GetGenreResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetGenreResponse)
+	err := c.cc.Invoke(ctx, GenreService_GetGenre_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *genreServiceClient) ListGenres(ctx context.Context, in *ListGenresRequest, opts ...grpc.CallOption) (*ListGenresResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListGenresResponse)
+	err := c.cc.Invoke(ctx, GenreService_ListGenres_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *genreServiceClient) StreamGenres(ctx context.Context, in *StreamGenresRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamGenresResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GenreService_ServiceDesc.Streams[0], GenreService_StreamGenres_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamGenresRequest, StreamGenresResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GenreService_StreamGenresClient = grpc.ServerStreamingClient[StreamGenresResponse]
+
+func (c *genreServiceClient) CreateGenre(ctx context.Context, in *CreateGenreRequest, opts ...grpc.CallOption) (*CreateGenreResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateGenreResponse)
+	err := c.cc.Invoke(ctx, GenreService_CreateGenre_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *genreServiceClient) UpdateGenre(ctx context.Context, in *UpdateGenreRequest, opts ...grpc.CallOption) (*UpdateGenreResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateGenreResponse)
+	err := c.cc.Invoke(ctx, GenreService_UpdateGenre_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GenreServiceServer is the server API for GenreService service.
+// All implementations must embed UnimplementedGenreServiceServer
+// for forward compatibility.
+//
+// GenreService manages the genres of the catalog, on the same store as the
+// REST and GraphQL endpoints.
+type GenreServiceServer interface {
+	// GetGenre fails with NOT_FOUND for an unknown id.
+	GetGenre(context.Context, *GetGenreRequest) (*GetGenreResponse, error)
+	// ListGenres pages through the genres ordered by slug.
+	ListGenres(context.Context, *ListGenresRequest) (*ListGenresResponse, error)
+	// StreamGenres sends every genre ordered by slug, without paging.
+	StreamGenres(*StreamGenresRequest, grpc.ServerStreamingServer[StreamGenresResponse]) error
+	// CreateGenre fails with INVALID_ARGUMENT for an invalid genre and with
+	// ALREADY_EXISTS when the slug is in use.
+	CreateGenre(context.Context, *CreateGenreRequest) (*CreateGenreResponse, error)
+	// UpdateGenre replaces the slug and name of a genre, it fails like
+	// CreateGenre and with NOT_FOUND for an unknown id.
+	UpdateGenre(context.Context, *UpdateGenreRequest) (*UpdateGenreResponse, error)
+	mustEmbedUnimplementedGenreServiceServer()
+}
+
+// UnimplementedGenreServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGenreServiceServer struct{}
+
+func (UnimplementedGenreServiceServer) GetGenre(context.Context, *GetGenreRequest) (*GetGenreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGenre not implemented")
+}
+func (UnimplementedGenreServiceServer) ListGenres(context.Context, *ListGenresRequest) (*ListGenresResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGenres not implemented")
+}
+func (UnimplementedGenreServiceServer) StreamGenres(*StreamGenresRequest, grpc.ServerStreamingServer[StreamGenresResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamGenres not implemented")
+}
+func (UnimplementedGenreServiceServer) CreateGenre(context.Context, *CreateGenreRequest) (*CreateGenreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateGenre not implemented")
+}
+func (UnimplementedGenreServiceServer) UpdateGenre(context.Context, *UpdateGenreRequest) (*UpdateGenreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateGenre not implemented")
+}
+func (UnimplementedGenreServiceServer) mustEmbedUnimplementedGenreServiceServer() {}
+func (UnimplementedGenreServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeGenreServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GenreServiceServer will
+// result in compilation errors.
+type UnsafeGenreServiceServer interface {
+	mustEmbedUnimplementedGenreServiceServer()
+}
+
+func RegisterGenreServiceServer(s grpc.ServiceRegistrar, srv GenreServiceServer) {
+	// If the following call pancis, it indicates UnimplementedGenreServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GenreService_ServiceDesc, srv)
+}
+
+func _GenreService_GetGenre_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGenreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenreServiceServer).GetGenre(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GenreService_GetGenre_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenreServiceServer).GetGenre(ctx, req.(*GetGenreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GenreService_ListGenres_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGenresRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenreServiceServer).ListGenres(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GenreService_ListGenres_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenreServiceServer).ListGenres(ctx, req.(*ListGenresRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GenreService_StreamGenres_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamGenresRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GenreServiceServer).StreamGenres(m, &grpc.GenericServerStream[StreamGenresRequest, StreamGenresResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GenreService_StreamGenresServer = grpc.ServerStreamingServer[StreamGenresResponse]
+
+func _GenreService_CreateGenre_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateGenreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenreServiceServer).CreateGenre(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GenreService_CreateGenre_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenreServiceServer).CreateGenre(ctx, req.(*CreateGenreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GenreService_UpdateGenre_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateGenreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenreServiceServer).UpdateGenre(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GenreService_UpdateGenre_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenreServiceServer).UpdateGenre(ctx, req.(*UpdateGenreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GenreService_ServiceDesc is the grpc.ServiceDesc for GenreService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GenreService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "movieland.v1.GenreService",
+	HandlerType: (*GenreServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetGenre",
+			Handler:    _GenreService_GetGenre_Handler,
+		},
+		{
+			MethodName: "ListGenres",
+			Handler:    _GenreService_ListGenres_Handler,
+		},
+		{
+			MethodName: "CreateGenre",
+			Handler:    _GenreService_CreateGenre_Handler,
+		},
+		{
+			MethodName: "UpdateGenre",
+			Handler:    _GenreService_UpdateGenre_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamGenres",
+			Handler:       _GenreService_StreamGenres_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "movieland/v1/genres.proto",
+}